@@ -5,4 +5,5 @@ go 1.15
 require (
 	github.com/ardabasaran/go-fourier v0.0.0-20190312022224-70b8b6ca705b
 	github.com/ldsec/lattigo/v2 v2.1.1
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f
 )
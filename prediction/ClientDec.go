@@ -1,12 +1,14 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/binary"
 	"encoding/csv"
 	"fmt"
 	"github.com/ldsec/idash21_Task2/prediction/client"
 	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
 	"log"
 	"math"
 	"os"
@@ -45,43 +47,112 @@ func main() {
 
 	predictions = predictions[:nbGenomes]
 
-	// Writes the scores in a .csv file
-	resf, err := os.Open(lib.GenomeDataPath)
-	if err != nil {
+	// "ClientDec debug" measures the noise of the decrypted scores against the quantized scores of the
+	// pre-processed genomes of temps/preprocessed.binary (written by make pro), and compares it with its estimate
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		debugNoise(client, predictions)
+	}
+
+	// If the model detects the genomes of unknown lineages, the predicted strain (or "unknown")
+	// is written after the scores. If the model is calibrated, the calibrated probabilities of
+	// the strains are written instead of the scores.
+	var openSet *predictor.OpenSet
+	var calibration *predictor.Calibration
+	if info, err := predictor.LoadModelInfo(lib.ModelPath + predictor.ModelInfoFile); err == nil {
+		openSet, calibration = info.OpenSet, info.Calibration
+	} else if !os.IsNotExist(err) {
 		log.Fatal(err)
 	}
-	defer resf.Close()
-	scanner := bufio.NewScanner(resf)
 
+	strains := make([]string, lib.NbStrains)
+	for name, label := range lib.StrainsMap {
+		strains[label] = name
+	}
+
+	// IDs of the genomes, the records of the FASTA file spanning one or several lines
+	ids := []string{}
+	for r := range preprocessing.ReadRecords(context.Background(), lib.GenomeDataPath, nbGenomes) {
+		if r.Err != nil {
+			log.Fatal(r.Err)
+		}
+		ids = append(ids, r.ID)
+	}
+
+	if len(ids) != nbGenomes {
+		log.Fatalf("%d genomes decrypted but %d genomes in %s", nbGenomes, len(ids), lib.GenomeDataPath)
+	}
+
+	// Writes the scores in a .csv file
 	predf, err := os.Create("results/prediction.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer predf.Close()
 
 	w := csv.NewWriter(predf)
-	defer w.Flush()
 
-	var i int
-	var data = make([]string, 5)
-	for scanner.Scan() {
+	var data = make([]string, 1+lib.NbStrains)
+	var probs = make([]float64, lib.NbStrains)
+	if openSet != nil {
+		data = append(data, "")
+	}
+	for i, pred := range predictions {
+
+		data[0] = ">" + ids[i]
+		if calibration != nil {
+			calibration.Probabilities(pred, probs)
+			for j := 0; j < lib.NbStrains; j++ {
+				data[1+j] = fmt.Sprintf("%f", probs[j])
+			}
+		} else {
+			for j := 0; j < lib.NbStrains; j++ {
+				data[1+j] = fmt.Sprintf("%f", pred[j])
+			}
+		}
 
-		if i == nbGenomes<<1 {
-			break
+		if openSet != nil {
+			if label := openSet.Predict(pred); label == -1 {
+				data[1+lib.NbStrains] = predictor.UnknownStrain
+			} else {
+				data[1+lib.NbStrains] = strains[label]
+			}
 		}
 
-		if i&1 == 0 {
+		if err = w.Write(data); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-			pred := predictions[i>>1]
+	w.Flush()
+	if err = w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
 
-			data[0] = scanner.Text()
-			data[1] = fmt.Sprintf("%f", pred[0])
-			data[2] = fmt.Sprintf("%f", pred[1])
-			data[3] = fmt.Sprintf("%f", pred[2])
-			data[4] = fmt.Sprintf("%f", pred[3])
+// debugNoise prints the estimated and the measured noise of the decrypted scores of the pre-processed genomes.
+func debugNoise(client *client.Client, predictions [][]float64) {
 
-			if err = w.Write(data); err != nil {
-				log.Fatal(err)
-			}
-		}
+	hashes := lib.LoadHashes("temps/preprocessed.binary")
+	if len(hashes) != len(predictions) {
+		log.Fatalf("%d genomes pre-processed but %d genomes decrypted", len(hashes), len(predictions))
+	}
+
+	p := predictor.NewPredictor(client.Parameters())
+	p.LoadModel(lib.ModelPath)
 
-		i++
+	quantized := make([][]float64, len(hashes))
+	for i := range hashes {
+		quantized[i] = make([]float64, p.NbStrains())
+		p.PredictQuantized(hashes[i], quantized[i])
 	}
+
+	estimate := p.EstimateNoise()
+
+	strains := make([]string, lib.NbStrains)
+	for name, label := range lib.StrainsMap {
+		strains[label] = name
+	}
+
+	fmt.Println(estimate)
+	fmt.Println(predictor.CompareNoise(estimate, predictor.MeasureNoise(quantized, predictions), strains))
 }
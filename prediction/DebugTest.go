@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"github.com/ldsec/idash21_Task2/prediction/client"
+	"github.com/ldsec/idash21_Task2/prediction/eval"
 	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
 	"github.com/ldsec/idash21_Task2/prediction/server"
 	"github.com/ldsec/lattigo/v2/ckks"
 	"os"
@@ -57,7 +61,7 @@ func main() {
 	// Pre-processing & Encryption
 	client := client.NewClient()
 
-	client.ProcessAndEncrypt("model/X.binary", nbGenomes)
+	client.ProcessAndEncryptFASTA(lib.GenomeDataPath, nbGenomes)
 
 	// Prediction
 	server := server.NewServer()
@@ -90,60 +94,57 @@ func main() {
 
 	predictions = predictions[:nbGenomes]
 
-	Ybyte := lib.FileToByteBuffer("model/Y.binary")
-
-	TP := []int{0, 0, 0, 0}
-	TN := []int{0, 0, 0, 0}
-	FP := []int{0, 0, 0, 0}
-	FN := []int{0, 0, 0, 0}
-	for i, pred := range predictions {
-		idx := 0
-		max := -4294967296.0
-		for j, v := range pred {
-			if v > max {
-				idx = j
-				max = v
-			}
+	// Calibrated probabilities of the strains if the model is calibrated, softmax of the scores otherwise
+	var calibration *predictor.Calibration
+	var openSet *predictor.OpenSet
+	if info, err := predictor.LoadModelInfo(lib.ModelPath + predictor.ModelInfoFile); err == nil {
+		calibration, openSet = info.Calibration, info.OpenSet
+	} else if !os.IsNotExist(err) {
+		panic(err)
+	}
+
+	// Labels of the genomes, given their ID. If the model detects the genomes of unknown lineages,
+	// the genomes of lineages outside of the label set are evaluated in the open-set metrics.
+	labeler, err := lib.ConfiguredLabeler()
+	if err != nil {
+		panic(err)
+	}
+
+	known, labels, unknown := [][]float64{}, []int{}, [][]float64{}
+	i := 0
+	for r := range preprocessing.ReadRecords(context.Background(), lib.GenomeDataPath, nbGenomes) {
+		if r.Err != nil {
+			panic(r.Err)
 		}
 
-		if idx != int(Ybyte[i]) {
-			FP[idx]++
-			for i := range FN {
-				if i != idx {
-					FN[i]++
-				}
+		lineage, err := labeler.Lineage(r.ID)
+		if err != nil {
+			panic(err)
+		}
+
+		label, err := labeler.Labels().Label(lineage)
+		if err != nil {
+			if openSet == nil {
+				panic(err)
 			}
+			unknown = append(unknown, predictions[i])
 		} else {
-			TP[idx]++
-			for i := range TN {
-				if i != idx {
-					TN[i]++
-				}
-			}
+			known = append(known, predictions[i])
+			labels = append(labels, label)
 		}
+
+		i++
 	}
-	fmt.Println("True  positives :", TP)
-	fmt.Println("True  Negatives :", TN)
-	fmt.Println("False Positives :", FP)
-	fmt.Println("False Negatives :", FN)
-	fmt.Println()
 
-	macro := 0.0
-	microNum := 0.0
-	microDen := 0.0
-	for i := range TP {
-		macroNum := float64(TP[i])
-		macroDen := float64(TP[i] + FP[i])
-		if macroDen != 0 {
-			macro += macroNum / macroDen
-		}
-		microNum += float64(TP[i])
-		microDen += float64(FP[i] + TP[i])
+	report, err := eval.Evaluate(eval.Probabilities(known, calibration), labels, labeler.Labels().Names(), lib.CalibrationBins)
+	if err != nil {
+		panic(err)
 	}
 
-	macro /= float64(4)
-	micro := microNum / microDen
+	if openSet != nil {
+		openSetReport := eval.NewOpenSetReport(openSet, known, labels, unknown)
+		report.OpenSet = &openSetReport
+	}
 
-	fmt.Printf("Macro AUC: %f\n", macro)
-	fmt.Printf("Micro AUC: %f\n", micro)
+	fmt.Println(report)
 }
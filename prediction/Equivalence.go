@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/client"
+	"github.com/ldsec/idash21_Task2/prediction/eval"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
+	"github.com/ldsec/idash21_Task2/prediction/server"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"log"
+	"os"
+)
+
+// Checks that the encryption does not change the predictions of the genomes pre-processed in temps/preprocessed.binary
+// (make pro), with the secret key in keys/ (make key). The hashes are predicted in plaintext with float and quantized
+// hashes and weights, and encrypted as by make enc, pred and dec. Prints the comparison, writes the comparison of each
+// genome in results/equivalence.csv and exits with status 1 if a quantized and an encrypted predicted strain differ.
+func main() {
+
+	var err error
+
+	// Plaintext hashes
+	hashes := lib.LoadHashes("temps/preprocessed.binary")
+	nbGenomes := len(hashes)
+
+	// Plaintext predictions
+	params, err := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := predictor.NewPredictor(params)
+	p.LoadModel(lib.ModelPath)
+
+	float := make([][]float64, nbGenomes)
+	quantized := make([][]float64, nbGenomes)
+	for i := range hashes {
+		float[i] = make([]float64, p.NbStrains())
+		quantized[i] = make([]float64, p.NbStrains())
+		p.PredictPlaintext(hashes[i], float[i])
+		p.PredictQuantized(hashes[i], quantized[i])
+	}
+
+	// Encrypted predictions : ProcessAndEncrypt -> PredictBatch -> DecryptBatchTranspose
+	client := client.NewClient()
+	client.ProcessAndEncrypt("temps/preprocessed.binary")
+
+	server := server.NewServer()
+
+	nbBatches := int(binary.LittleEndian.Uint64(lib.FileToByteBuffer(lib.NbBatchToPredict)))
+	for i := 0; i < nbBatches; i++ {
+		server.PredictBatch(i)
+	}
+
+	decryptor := client.NewDecryptor()
+
+	encrypted := [][]float64{}
+	for i := 0; i < nbBatches; i++ {
+		ciphertexts := lib.UnmarshalBatch32(lib.EncryptedBatchPredIndexPath(i))
+		encrypted = append(encrypted, decryptor.DecryptBatchTranspose(ciphertexts)...)
+	}
+
+	encrypted = encrypted[:nbGenomes]
+
+	report, err := eval.NewEquivalenceReport(float, quantized, encrypted, lib.HashScale*lib.ModelScale)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(report)
+
+	// IDs of the pre-processed genomes, the first of lib.GenomeDataPath
+	ids := []string{}
+	for r := range preprocessing.ReadRecords(context.Background(), lib.GenomeDataPath, nbGenomes) {
+		if r.Err != nil {
+			log.Fatal(r.Err)
+		}
+		ids = append(ids, r.ID)
+	}
+
+	if len(ids) != nbGenomes {
+		log.Fatalf("%d genomes pre-processed but %d genomes in %s", nbGenomes, len(ids), lib.GenomeDataPath)
+	}
+
+	fw, err := os.Create("results/equivalence.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = report.WriteCSV(fw, ids); err != nil {
+		log.Fatal(err)
+	}
+
+	if err = fw.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	if report.Disagreements > 0 {
+		os.Exit(1)
+	}
+}
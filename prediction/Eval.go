@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/eval"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Evaluates the predictions of results/prediction.csv, written by ClientDec, against the lineages of the genomes
+// (read from their ID or from lib.MetadataPath, see lib/labels.go). Prints the metrics and writes
+// them in results/evaluation.json, results/evaluation.csv and results/confusion.csv. If the predictions have the
+// predicted strain or "unknown" column, the genomes of lineages outside of the label set are evaluated as unknown
+// genomes in the open-set metrics, the closed-set metrics being those of the genomes of known lineages.
+func main() {
+
+	var err error
+
+	// Scores are calibrated probabilities if the model is calibrated
+	var calibration *predictor.Calibration
+	if info, err := predictor.LoadModelInfo(lib.ModelPath + predictor.ModelInfoFile); err == nil {
+		calibration = info.Calibration
+	} else if !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+
+	labeler, err := lib.ConfiguredLabeler()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fr, err := os.Open("results/prediction.csv")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fr.Close()
+
+	// The records have the same number of fields, the predicted strain or "unknown"
+	// being written after the scores if the model detects the genomes of unknown lineages
+	r := csv.NewReader(fr)
+
+	records, err := r.ReadAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(records) == 0 {
+		log.Fatal("results/prediction.csv : no prediction")
+	}
+
+	if len(records[0]) != 1+lib.NbStrains && len(records[0]) != 2+lib.NbStrains {
+		log.Fatalf("results/prediction.csv : %d fields, expected %d or %d", len(records[0]), 1+lib.NbStrains, 2+lib.NbStrains)
+	}
+
+	openSet := len(records[0]) == 2+lib.NbStrains
+
+	names := labeler.Labels().Names()
+
+	// Genomes of known lineages, for the closed-set metrics
+	var scores [][]float64
+	var knownLabels []int
+
+	// All the genomes, a genome of an unknown lineage or predicted as unknown being labeled -1, for the open-set metrics
+	var labels, predictions, closed []int
+
+	for i, record := range records {
+
+		lineage, err := labeler.Lineage(strings.TrimPrefix(record[0], ">"))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Without open set, a lineage outside of the label set (without unknown class) is an error
+		label, err := labeler.Labels().Label(lineage)
+		if err != nil {
+			if !openSet {
+				log.Fatalf("results/prediction.csv line %d : %s", i+1, err)
+			}
+			label = -1
+		}
+
+		s := make([]float64, lib.NbStrains)
+		for j := range s {
+			if s[j], err = strconv.ParseFloat(record[1+j], 64); err != nil {
+				log.Fatalf("results/prediction.csv line %d : %s", i+1, err)
+			}
+		}
+
+		if label != -1 {
+			scores = append(scores, s)
+			knownLabels = append(knownLabels, label)
+		}
+
+		if openSet {
+
+			prediction, ok := labeler.Labels().Index(record[1+lib.NbStrains])
+			if !ok {
+				if record[1+lib.NbStrains] != predictor.UnknownStrain {
+					log.Fatalf("results/prediction.csv line %d : predicted strain %s is not in the label set", i+1, record[1+lib.NbStrains])
+				}
+				prediction = -1
+			}
+
+			labels = append(labels, label)
+			predictions = append(predictions, prediction)
+			closed = append(closed, predictor.MaxIndex(s))
+		}
+	}
+
+	var probs [][]float64
+	if calibration != nil {
+		probs = scores
+	} else {
+		probs = eval.Probabilities(scores, nil)
+	}
+
+	report, err := eval.Evaluate(probs, knownLabels, names, lib.CalibrationBins)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The predictions have no confidence, the AUROC is not computed
+	if openSet {
+		openSetReport, err := eval.EvaluateOpenSet(labels, predictions, closed, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report.OpenSet = &openSetReport
+	}
+
+	fmt.Println(report)
+
+	lib.WriteFile("results/evaluation.json", report.WriteJSON)
+	lib.WriteFile("results/evaluation.csv", report.WriteCSV)
+	lib.WriteFile("results/confusion.csv", report.WriteConfusionCSV)
+}
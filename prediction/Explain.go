@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/explain"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Explains the prediction of the i-th genome (from 0) of lib.GenomeDataPath, in plaintext on the client side :
+// prints the k-mers contributing the most to the score of the predicted strain and writes the contributions
+// of the coefficients of the hash in results/explain_{i}_coefficients.csv, of the k-mers in results/explain_{i}_kmers.csv,
+// and their heatmap in the FCGR space in results/explain_{i}.png (downsampled for large windows). The predicted strain is the strain of largest
+// quantized score, which is the strain of largest decrypted score up to the encryption noise. The explained
+// score is the score of the quantized model evaluated by the server, for the hash before its quantization.
+// Requires the "dct" or "dct-sparse" feature extractor.
+func main() {
+
+	args := os.Args[1:]
+	if len(args) == 0 {
+		panic("NEED GENOME INDEX")
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil || index < 0 {
+		log.Fatalf("invalid genome index %s", args[0])
+	}
+
+	topK := 20
+	if len(args) > 1 {
+		if topK, err = strconv.Atoi(args[1]); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	hasher, ok := preprocessing.NewFeatureExtractor(1).(explain.Hasher)
+	if !ok {
+		log.Fatalf("the explanations require the dct or dct-sparse feature extractor, not %s", lib.FeatureExtractor)
+	}
+
+	// Reads the genome
+	ctx, cancel := context.WithCancel(context.Background())
+	var record preprocessing.Record
+	var nbRecords int
+	for r := range preprocessing.ReadRecords(ctx, lib.GenomeDataPath, index+1) {
+		if r.Err != nil {
+			log.Fatal(r.Err)
+		}
+		record = r
+		nbRecords++
+	}
+	cancel()
+
+	if nbRecords != index+1 {
+		log.Fatalf("%s has %d genomes", lib.GenomeDataPath, nbRecords)
+	}
+
+	// Model
+	params, err := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	p := predictor.NewPredictor(params)
+	p.LoadModel(lib.ModelPath)
+	floatWeights, floatBias := p.Model()
+
+	// The encrypted prediction evaluates the weights quantized with lib.ModelScale and the bias with
+	// lib.HashScale * lib.ModelScale : the explained score is the score of the quantized model
+	weights := make([][]float64, len(floatWeights))
+	bias := make([]float64, len(floatBias))
+	for c := range weights {
+		weights[c] = make([]float64, len(floatWeights[c]))
+		for j, w := range floatWeights[c] {
+			weights[c][j] = predictor.Quantize(w, lib.ModelScale) / lib.ModelScale
+		}
+		bias[c] = predictor.Quantize(floatBias[c], lib.HashScale*lib.ModelScale) / (lib.HashScale * lib.ModelScale)
+	}
+
+	strains := make([]string, lib.NbStrains)
+	for name, label := range lib.StrainsMap {
+		strains[label] = name
+	}
+
+	// Prediction and explanation of the score of the predicted strain
+	fcgr, hash := explain.Genome(hasher, record.Sequence)
+
+	scores := make([]float64, p.NbStrains())
+	p.PredictQuantized(hash, scores)
+	strain := predictor.MaxIndex(scores)
+
+	floatScores := make([]float64, p.NbStrains())
+	p.PredictPlaintext(hash, floatScores)
+
+	e := explain.Explain(hasher, strain, weights[strain], bias[strain], fcgr, hash)
+	kmers := e.Kmers()
+
+	fmt.Printf("Genome %d : %s\n", index, record.ID)
+	fmt.Printf("Predicted strain : %s, score %f (bias %f), float model score %f\n", strains[strain], e.Score, e.Bias, floatScores[strain])
+	fmt.Printf("%d empty cells of value %g : contribution %f\n", e.NbEmpty, e.Empty, e.EmptyContribution)
+	fmt.Printf("Top %d contributing k-mers :\n", topK)
+	for i := 0; i < topK && i < len(kmers); i++ {
+		fmt.Printf("%s %12.6f\n", kmers[i].Kmer, kmers[i].Contribution)
+	}
+
+	prefix := fmt.Sprintf("results/explain_%d", index)
+
+	lib.WriteFile(prefix+"_coefficients.csv", e.WriteCoefficientsCSV)
+	lib.WriteFile(prefix+"_kmers.csv", func(w io.Writer) error { return explain.WriteKmersCSV(w, kmers) })
+
+	// Heatmap of 512 x 512 pixels, of the blocks of the k-mers of the same suffix for the windows larger than explain.MaxHeatmapWindow
+	level := hasher.Window()
+	if level > explain.MaxHeatmapWindow {
+		level = explain.MaxHeatmapWindow
+	}
+	cellSize := 512 >> level
+	lib.WriteFile(prefix+".png", func(w io.Writer) error { return e.WriteHeatmapPNG(w, cellSize) })
+}
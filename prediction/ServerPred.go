@@ -12,8 +12,12 @@ func main() {
 	// Read the number of batches to predict
 	nbBatches := int(binary.LittleEndian.Uint64(lib.FileToByteBuffer(lib.NbBatchToPredict)))
 
-	// For each batch (file), predicts the values
-	for i := 0; i < nbBatches; i++ {
-		server.PredictBatch(i)
+	// Predicts all the batches (files), the work is split across
+	// batches, classes and hash coefficients
+	batchIndices := make([]int, nbBatches)
+	for i := range batchIndices {
+		batchIndices[i] = i
 	}
+
+	server.PredictBatches(batchIndices)
 }
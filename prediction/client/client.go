@@ -1,9 +1,11 @@
 package client
 
 import (
+	"bufio"
 	"encoding/binary"
 	"github.com/ldsec/idash21_Task2/prediction/lib"
 	"github.com/ldsec/lattigo/v2/ckks"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -36,26 +38,65 @@ func NewClient() (c *Client) {
 	return
 }
 
+// Parameters returns the parameters of the scheme.
+func (c *Client) Parameters() *ckks.Parameters {
+	return c.params
+}
+
+// ProcessAndEncrypt reads the pre-processed genomes at the given path and encrypts them.
+// The genomes are streamed from the file by batches of N, so that only one batch
+// of hashes (and its transpose) is held in memory at any time.
 func (c *Client) ProcessAndEncrypt(path string) {
 
-	// Encryptor
-	encryptor := c.NewEncryptor(lib.NbGoRoutines)
+	var fr *os.File
+	var err error
+	if fr, err = os.Open(path); err != nil {
+		panic(err)
+	}
+	defer fr.Close()
+
+	reader := bufio.NewReader(fr)
 
-	processedGenomesBytes := lib.FileToByteBuffer(path)
+	// Reads the number of pre-processed genomes
+	buff := make([]byte, lib.HashSize<<3)
+	if _, err = io.ReadFull(reader, buff[:8]); err != nil {
+		panic(err)
+	}
+	nbGenomes := int(binary.LittleEndian.Uint64(buff[:8]))
+
+	bw := c.newBatchWriter()
 
-	// Reads the pre-processed genomes
-	nbGenomes := int(binary.LittleEndian.Uint64(processedGenomesBytes[:8]))
-	processedGenomesBytes = processedGenomesBytes[8:]
-	hashes := make([][]float64, nbGenomes)
-	for i := range hashes {
-		hashes[i] = make([]float64, lib.HashSize)
-		for j := range hashes[i] {
-			hashes[i][j] = math.Float64frombits(binary.LittleEndian.Uint64(processedGenomesBytes[j<<3 : (j+1)<<3]))
+	hash := make([]float64, lib.HashSize)
+	for i := 0; i < nbGenomes; i++ {
+
+		if _, err = io.ReadFull(reader, buff); err != nil {
+			panic(err)
 		}
-		processedGenomesBytes = processedGenomesBytes[lib.HashSize<<3:]
+
+		for j := range hash {
+			hash[j] = math.Float64frombits(binary.LittleEndian.Uint64(buff[j<<3 : (j+1)<<3]))
+		}
+
+		bw.Add(hash)
 	}
 
-	// Transpose the matrix of pre-processed genomes
+	bw.Close()
+}
+
+// batchWriter collects hashes, and encrypts and writes a batch as soon as N hashes are collected.
+type batchWriter struct {
+	c         *Client
+	encryptor *Encryptor
+	ranges    [][2]int
+	block     [][]float64
+	n         int
+	nbBatches int
+	nbGenomes int
+}
+
+func (c *Client) newBatchWriter() (bw *batchWriter) {
+
+	// Transposed batch of pre-processed genomes
 	//
 	// 	   Hashes 			     # Genomes
 	// 	  ________		       _______________
@@ -67,16 +108,39 @@ func (c *Client) ProcessAndEncrypt(path string) {
 	// e |			    	e |7  7  d  2
 	// s |5bb282af...		s |2  b  8  a
 	//	 |				      |a  4  2  f
+	block := make([][]float64, lib.HashSize)
+	for i := range block {
+		block[i] = make([]float64, c.params.N())
+	}
 
-	hashTransposed := make([][]float64, lib.HashSize)
-	for i := range hashTransposed {
-		hashTransposed[i] = make([]float64, nbGenomes)
+	return &batchWriter{
+		c:         c,
+		encryptor: c.NewEncryptor(lib.NbGoRoutines),
+		ranges:    lib.SplitRange(lib.HashSize, lib.NbGoRoutines), // Range of ciphertexts encrypted by each Go routine
+		block:     block,
 	}
+}
 
-	for i := 0; i < nbGenomes; i++ {
-		for j := 0; j < lib.HashSize; j++ {
-			hashTransposed[j][i] = hashes[i][j]
-		}
+// Add appends the hash of the next genome to the current batch.
+func (bw *batchWriter) Add(hash []float64) {
+
+	for j := range bw.block {
+		bw.block[j][bw.n] = hash[j]
+	}
+
+	bw.n++
+	bw.nbGenomes++
+
+	if bw.n == len(bw.block[0]) {
+		bw.Flush()
+	}
+}
+
+// Flush encrypts the current batch and writes it in its own file.
+func (bw *batchWriter) Flush() {
+
+	if bw.n == 0 {
+		return
 	}
 
 	//*************************** HASHES ENCRYPTION *******************************
@@ -89,64 +153,57 @@ func (c *Client) ProcessAndEncrypt(path string) {
 	// per batch of H hashes
 	// Each batch is encrypted in a different file
 
-	// Number of batches
-	nbBatches := int(math.Ceil(float64(nbGenomes) / float64(c.params.N())))
+	ciphertexts := encryptBatch(bw.encryptor, 0, bw.n, bw.block, bw.ranges)
+
+	lib.MarshalBatchSeeded32(lib.EncryptedBatchIndexPath(bw.nbBatches), ciphertexts, bw.encryptor.GetSeeds(), bw.ranges)
+
+	bw.nbBatches++
+	bw.n = 0
+}
+
+// Close flushes the last batch and saves how many batches and genomes were encrypted.
+func (bw *batchWriter) Close() {
+
+	bw.Flush()
 
-	// Saves how many batches are encrypted
 	var fw *os.File
 	var err error
-	// Creates the files containing the compressed ciphertexts
 	if fw, err = os.Create(lib.NbBatchToPredict); err != nil {
 		panic(err)
 	}
 	defer fw.Close()
 
 	buff := make([]byte, 8)
-	binary.LittleEndian.PutUint64(buff, uint64(nbBatches))
+	binary.LittleEndian.PutUint64(buff, uint64(bw.nbBatches))
 	fw.Write(buff)
-	binary.LittleEndian.PutUint64(buff, uint64(nbGenomes))
+	binary.LittleEndian.PutUint64(buff, uint64(bw.nbGenomes))
 	fw.Write(buff)
+}
 
-	// Number of ciphertext per Go routine
-	nbCipherPerGoRoutine := int(math.Ceil(float64(lib.HashSize) / float64(lib.NbGoRoutines)))
+// encryptBatch reseeds the encryptor and encrypts the genomes [startGenome, endGenome) of the transposed hashes.
+// The g-th worker of the encryptor encrypts the hash coefficients [ranges[g][0], ranges[g][1]).
+func encryptBatch(encryptor *Encryptor, startGenome, endGenome int, hashTransposed [][]float64, ranges [][2]int) (ciphertexts []*ckks.Ciphertext) {
 
-	ciphertexts := make([]*ckks.Ciphertext, lib.HashSize)
+	encryptor.Seed()
 
-	// Number of batch
-	for i := 0; i < nbBatches; i++ {
+	ciphertexts = make([]*ckks.Ciphertext, len(hashTransposed))
 
-		encryptor.Seed()
+	var wg sync.WaitGroup
+	wg.Add(len(ranges))
+	for g := range ranges {
 
-		var wg sync.WaitGroup
-		wg.Add(lib.NbGoRoutines)
-		for g := 0; g < lib.NbGoRoutines; g++ {
+		go func(worker, startHash, endHash int) {
 
-			start := g * nbCipherPerGoRoutine
-			end := (g + 1) * nbCipherPerGoRoutine
+			tmp := encryptor.Encrypt(worker, startGenome, endGenome, hashTransposed[startHash:endHash])
 
-			if g == lib.NbGoRoutines-1 {
-				end = lib.HashSize
+			for j := startHash; j < endHash; j++ {
+				ciphertexts[j] = tmp[j-startHash]
 			}
 
-			go func(worker, startHash, endHash int) {
-
-				startGenome := i * int(c.params.N())
-				endGenome := (i + 1) * int(c.params.N())
-				if endGenome > nbGenomes {
-					endGenome = nbGenomes
-				}
-
-				tmp := encryptor.Encrypt(worker, startGenome, endGenome, hashTransposed[startHash:endHash])
-
-				for j := startHash; j < endHash; j++ {
-					ciphertexts[j] = tmp[j-startHash]
-				}
-
-				wg.Done()
-			}(g, start, end)
-		}
-		wg.Wait()
-
-		lib.MarshalBatchSeeded32(lib.EncryptedBatchIndexPath(i), ciphertexts, encryptor.GetSeeds())
+			wg.Done()
+		}(g, ranges[g][0], ranges[g][1])
 	}
+	wg.Wait()
+
+	return
 }
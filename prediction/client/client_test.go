@@ -0,0 +1,78 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/lattigo/v2/ckks"
+)
+
+func newTestClient(t *testing.T) *Client {
+	params, err := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params.SetScale(lib.HashScale)
+
+	sk := ckks.NewKeyGenerator(params).GenSecretKeyGaussian()
+
+	return &Client{params: params, sk: sk}
+}
+
+func TestEncryptBatchSeeded(t *testing.T) {
+
+	c := newTestClient(t)
+
+	nbGoRoutines := 4
+	nbGenomes := 100
+
+	encryptor := c.NewEncryptor(nbGoRoutines)
+	decryptor := c.NewDecryptor()
+
+	// Hash sizes not divisible by the number of Go routines, and smaller than it
+	for _, hashSize := range []int{250, 255, 256, 3} {
+
+		t.Run(fmt.Sprintf("HashSize=%d", hashSize), func(t *testing.T) {
+
+			hashTransposed := make([][]float64, hashSize)
+			for i := range hashTransposed {
+				hashTransposed[i] = make([]float64, nbGenomes)
+				for j := range hashTransposed[i] {
+					hashTransposed[i][j] = 2*rand.Float64() - 1
+				}
+			}
+
+			ranges := lib.SplitRange(hashSize, nbGoRoutines)
+
+			if ranges[0][0] != 0 || ranges[len(ranges)-1][1] != hashSize {
+				t.Fatalf("ranges %v do not cover [0, %d)", ranges, hashSize)
+			}
+
+			ciphertexts := encryptBatch(encryptor, 0, nbGenomes, hashTransposed, ranges)
+
+			path := filepath.Join(t.TempDir(), "batch.binary")
+
+			lib.MarshalBatchSeeded32(path, ciphertexts, encryptor.GetSeeds(), ranges)
+
+			ciphertexts = lib.UnmarshalBatchSeeded32(path)
+
+			if len(ciphertexts) != hashSize {
+				t.Fatalf("unmarshaled %d ciphertexts, want %d", len(ciphertexts), hashSize)
+			}
+
+			pred := decryptor.DecryptBatch(ciphertexts)
+
+			for i := range hashTransposed {
+				for j := range hashTransposed[i] {
+					if math.Abs(pred[i][j]-hashTransposed[i][j]) > 1e-3 {
+						t.Fatalf("coefficient %d of genome %d: have %f, want %f", i, j, pred[i][j], hashTransposed[i][j])
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
+)
+
+// ProcessAndEncryptFASTA pre-processes and encrypts the first nbGenomes genomes of the FASTA file at the given path.
+// The genomes are read, hashed by a pool of lib.NbHashingWorkers workers and fed in order to the encryptor
+// through channels. A batch is encrypted and written as soon as N hashes are ready, and the plaintext
+// hashes are never written on disk.
+func (c *Client) ProcessAndEncryptFASTA(path string, nbGenomes int) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Feature extractor selected in lib (by default Chaos Game Representation + 2D Discret Cosine II hasher)
+	hasher := preprocessing.NewFeatureExtractor(lib.NbHashingWorkers)
+
+	records := preprocessing.ReadRecords(ctx, path, nbGenomes)
+
+	// Transposes and encrypts the hashes in the order of the file
+	bw := c.newBatchWriter()
+
+	for res := range preprocessing.NewWorkerPool(hasher).HashAll(ctx, records) {
+		if res.Err != nil {
+			panic(res.Err)
+		}
+		bw.Add(res.Hash)
+	}
+
+	bw.Close()
+}
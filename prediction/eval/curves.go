@@ -0,0 +1,85 @@
+package eval
+
+import (
+	"sort"
+)
+
+type rankedSample struct {
+	score    float64
+	positive bool
+}
+
+// rank returns the samples sorted by decreasing score.
+func rank(positives, negatives []float64) (samples []rankedSample) {
+
+	samples = make([]rankedSample, 0, len(positives)+len(negatives))
+	for _, s := range positives {
+		samples = append(samples, rankedSample{s, true})
+	}
+	for _, s := range negatives {
+		samples = append(samples, rankedSample{s, false})
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].score > samples[j].score })
+
+	return
+}
+
+// AUROC returns the area under the ROC curve of a score that should be larger for the positive samples
+// than for the negative ones, which is the probability that a random positive sample has a larger score
+// than a random negative sample (ties counting for one half).
+func AUROC(positives, negatives []float64) float64 {
+
+	samples := rank(positives, negatives)
+
+	// Sum of the ranks (in increasing order) of the positive samples (Mann-Whitney U), ties sharing their mean rank
+	var rankSum float64
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].score == samples[i].score {
+			j++
+		}
+		rank := float64(2*len(samples)-i-j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].positive {
+				rankSum += rank
+			}
+		}
+		i = j
+	}
+
+	nPos, nNeg := float64(len(positives)), float64(len(negatives))
+
+	return (rankSum - nPos*(nPos+1)/2) / (nPos * nNeg)
+}
+
+// AveragePrecision returns the area under the precision-recall curve of a score that should be larger for the
+// positive samples than for the negative ones : the mean over the thresholds, weighted by the increase of the
+// recall, of the precision of the samples of score at least the threshold.
+func AveragePrecision(positives, negatives []float64) (ap float64) {
+
+	samples := rank(positives, negatives)
+
+	var tp, fp int
+	for i := 0; i < len(samples); {
+
+		// Tied samples are above a threshold together
+		var newTP int
+		j := i
+		for j < len(samples) && samples[j].score == samples[i].score {
+			if samples[j].positive {
+				newTP++
+			} else {
+				fp++
+			}
+			j++
+		}
+
+		tp += newTP
+		ap += float64(newTP) / float64(len(positives)) * float64(tp) / float64(tp+fp)
+
+		i = j
+	}
+
+	return
+}
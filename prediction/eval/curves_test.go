@@ -0,0 +1,39 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAUROC(t *testing.T) {
+
+	if a := AUROC([]float64{3, 4, 5}, []float64{0, 1, 2}); a != 1 {
+		t.Fatalf("separated samples : AUROC %f", a)
+	}
+
+	if a := AUROC([]float64{1, 1}, []float64{1, 1}); a != 0.5 {
+		t.Fatalf("tied samples : AUROC %f", a)
+	}
+
+	// 5 of the 6 pairs are ordered
+	if a := AUROC([]float64{2, 4}, []float64{1, 3, 0}); math.Abs(a-5.0/6) > 1e-12 {
+		t.Fatalf("AUROC %f, expected %f", a, 5.0/6)
+	}
+}
+
+func TestAveragePrecision(t *testing.T) {
+
+	if ap := AveragePrecision([]float64{3, 4, 5}, []float64{0, 1, 2}); ap != 1 {
+		t.Fatalf("separated samples : AP %f", ap)
+	}
+
+	// Ranking + - + - - : precisions 1 and 2/3 at the recalls 1/2 and 1
+	if ap := AveragePrecision([]float64{5, 3}, []float64{4, 2, 1}); math.Abs(ap-(1+2.0/3)/2) > 1e-12 {
+		t.Fatalf("AP %f, expected %f", ap, (1+2.0/3)/2)
+	}
+
+	// All the samples tied : precision 2/5 at recall 1
+	if ap := AveragePrecision([]float64{1, 1}, []float64{1, 1, 1}); math.Abs(ap-0.4) > 1e-12 {
+		t.Fatalf("tied samples : AP %f", ap)
+	}
+}
@@ -0,0 +1,124 @@
+package eval
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"io"
+	"math"
+	"strconv"
+)
+
+// GenomeEquivalence compares the scores of a genome predicted in plaintext, with float and quantized
+// hashes and weights, and encrypted.
+type GenomeEquivalence struct {
+	FloatError     float64 `json:"float_error"` // Largest difference between a float and a quantized score
+	Error          float64 `json:"error"`       // Largest difference between a quantized and an encrypted score
+	FloatLabel     int     `json:"float_label"`
+	QuantizedLabel int     `json:"quantized_label"`
+	EncryptedLabel int     `json:"encrypted_label"`
+}
+
+// EquivalenceReport compares the predictions of genomes in plaintext and encrypted. The quantized scores are
+// the encrypted scores without the encryption noise, and are multiples of 1/Scale : the noise does not change
+// a score once rounded to a multiple of 1/Scale as long as the error is below 1/(2*Scale).
+type EquivalenceReport struct {
+	Genomes            []GenomeEquivalence `json:"genomes"`
+	Scale              float64             `json:"scale"`               // Scale of the quantized scores, HashScale * ModelScale
+	MaxFloatError      float64             `json:"max_float_error"`     // Largest difference between a float and a quantized score
+	MaxError           float64             `json:"max_error"`           // Largest difference between a quantized and an encrypted score
+	MeanError          float64             `json:"mean_error"`          // Mean over the genomes of their largest difference between a quantized and an encrypted score
+	Disagreements      int                 `json:"disagreements"`       // Number of genomes whose quantized and encrypted predicted strains differ
+	FloatDisagreements int                 `json:"float_disagreements"` // Number of genomes whose float and encrypted predicted strains differ
+	Bits               float64             `json:"bits"`                // Precision in bits of the encrypted scores, log2(Scale) minus LostBits
+	LostBits           float64             `json:"lost_bits"`           // Bits of the quantized scores lost to the encryption noise, max(0, log2(MaxError * Scale))
+}
+
+// NewEquivalenceReport compares the float, quantized and encrypted scores of the genomes, the quantized scores
+// being multiples of 1/scale.
+func NewEquivalenceReport(float, quantized, encrypted [][]float64, scale float64) (r *EquivalenceReport, err error) {
+
+	if len(float) != len(quantized) || len(float) != len(encrypted) {
+		return nil, fmt.Errorf("%d float, %d quantized and %d encrypted predictions", len(float), len(quantized), len(encrypted))
+	}
+
+	if len(float) == 0 {
+		return nil, fmt.Errorf("no genome to compare")
+	}
+
+	r = &EquivalenceReport{Genomes: make([]GenomeEquivalence, len(float)), Scale: scale}
+
+	for i := range float {
+
+		if len(float[i]) != len(quantized[i]) || len(float[i]) != len(encrypted[i]) {
+			return nil, fmt.Errorf("genome %d : %d float, %d quantized and %d encrypted scores", i, len(float[i]), len(quantized[i]), len(encrypted[i]))
+		}
+
+		g := &r.Genomes[i]
+		for c := range float[i] {
+			g.FloatError = math.Max(g.FloatError, math.Abs(float[i][c]-quantized[i][c]))
+			g.Error = math.Max(g.Error, math.Abs(quantized[i][c]-encrypted[i][c]))
+		}
+
+		g.FloatLabel, g.QuantizedLabel, g.EncryptedLabel = predictor.MaxIndex(float[i]), predictor.MaxIndex(quantized[i]), predictor.MaxIndex(encrypted[i])
+
+		if g.QuantizedLabel != g.EncryptedLabel {
+			r.Disagreements++
+		}
+
+		if g.FloatLabel != g.EncryptedLabel {
+			r.FloatDisagreements++
+		}
+
+		r.MaxFloatError = math.Max(r.MaxFloatError, g.FloatError)
+		r.MaxError = math.Max(r.MaxError, g.Error)
+		r.MeanError += g.Error
+	}
+
+	r.MeanError /= float64(len(float))
+	r.LostBits = lostBits(r.MaxError, scale)
+	r.Bits = math.Log2(scale) - r.LostBits
+
+	return
+}
+
+// lostBits returns the number of bits of a score of resolution 1/scale lost to an error.
+func lostBits(err, scale float64) float64 {
+	if err*scale <= 1 {
+		return 0
+	}
+	return math.Log2(err * scale)
+}
+
+func (r *EquivalenceReport) String() string {
+	return fmt.Sprintf("Equivalence on %d genomes : %d quantized/encrypted and %d float/encrypted label disagreements, "+
+		"max. error %.3e (mean %.3e), max. float error %.3e, precision %.2f bits (%.2f of %.2f bits lost to the encryption noise)",
+		len(r.Genomes), r.Disagreements, r.FloatDisagreements, r.MaxError, r.MeanError, r.MaxFloatError, r.Bits, r.LostBits, math.Log2(r.Scale))
+}
+
+// WriteCSV writes the comparison of each genome in CSV, one record
+// "id,float_error,error,lost_bits,float_label,quantized_label,encrypted_label" per genome after a header.
+func (r *EquivalenceReport) WriteCSV(w io.Writer, ids []string) error {
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'e', 6, 64)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "float_error", "error", "lost_bits", "float_label", "quantized_label", "encrypted_label"})
+
+	for i, g := range r.Genomes {
+		cw.Write([]string{
+			ids[i],
+			format(g.FloatError),
+			format(g.Error),
+			strconv.FormatFloat(lostBits(g.Error, r.Scale), 'f', 2, 64),
+			strconv.Itoa(g.FloatLabel),
+			strconv.Itoa(g.QuantizedLabel),
+			strconv.Itoa(g.EncryptedLabel),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEquivalenceReport(t *testing.T) {
+
+	scale := 1024.0
+
+	float := [][]float64{{1, 0.5}, {0.2, 0.3}, {0.4, 0.4001}}
+	quantized := [][]float64{{1, 0.5}, {0.2, 0.3}, {0.4, 0.4}}
+	encrypted := [][]float64{{1 + 1e-4, 0.5}, {0.2, 0.3 - 8/scale}, {0.4 + 1/scale, 0.4}}
+
+	r, err := NewEquivalenceReport(float, quantized, encrypted, scale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The third genome is a tie broken differently in float and encrypted
+	if r.Disagreements != 0 || r.FloatDisagreements != 1 {
+		t.Fatalf("%d quantized and %d float disagreements", r.Disagreements, r.FloatDisagreements)
+	}
+
+	if math.Abs(r.MaxError-8/scale) > 1e-12 || math.Abs(r.MaxFloatError-1e-4) > 1e-12 {
+		t.Fatalf("max. error %g, max. float error %g", r.MaxError, r.MaxFloatError)
+	}
+
+	// An error of 8/scale loses 3 of the 10 bits of the quantized scores
+	if math.Abs(r.LostBits-3) > 1e-9 || math.Abs(r.Bits-7) > 1e-9 {
+		t.Fatalf("%f bits lost, precision %f bits", r.LostBits, r.Bits)
+	}
+
+	var buff bytes.Buffer
+	if err = r.WriteCSV(&buff, []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "b,") || !strings.Contains(lines[2], ",3.00,") {
+		t.Fatalf("CSV\n%s", buff.String())
+	}
+
+	if _, err = NewEquivalenceReport(float, quantized[1:], encrypted, scale); err == nil {
+		t.Fatal("different numbers of genomes accepted")
+	}
+}
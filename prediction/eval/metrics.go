@@ -0,0 +1,281 @@
+// Package eval computes the metrics of the predictions of a model given the ground-truth labels of the genomes.
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ClassMetrics are the one-vs-rest metrics of a class.
+type ClassMetrics struct {
+	Name      string  `json:"name"`
+	Support   int     `json:"support"` // Number of samples of the class
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+	ROCAUC    float64 `json:"roc_auc"` // Area under the ROC curve of the probability of the class
+	PRAUC     float64 `json:"pr_auc"`  // Average precision of the probability of the class
+}
+
+// Report are the metrics of the predictions of a model. The AUCs of a class without samples, or without samples
+// of the other classes, are 0 and left out of the macro averages.
+type Report struct {
+	Samples  int     `json:"samples"`
+	Accuracy float64 `json:"accuracy"`
+	LogLoss  float64 `json:"log_loss"` // Mean negative log-likelihood of the labels, the probabilities being clipped to [1e-15, 1-1e-15]
+	ECE      float64 `json:"ece"`      // Expected calibration error of the reliability diagram
+
+	MacroPrecision float64 `json:"macro_precision"`
+	MacroRecall    float64 `json:"macro_recall"`
+	MacroF1        float64 `json:"macro_f1"`
+	MacroROCAUC    float64 `json:"macro_roc_auc"`
+	MacroPRAUC     float64 `json:"macro_pr_auc"`
+	MicroROCAUC    float64 `json:"micro_roc_auc"` // Area under the ROC curve of all the (sample, class) pairs
+
+	Classes     []ClassMetrics     `json:"classes"`
+	Confusion   [][]int            `json:"confusion"` // Confusion[i][j] is the number of samples of class i predicted as class j
+	Reliability ReliabilityDiagram `json:"reliability"`
+
+	OpenSet *OpenSetReport `json:"open_set,omitempty"` // Detection of the genomes of unknown lineages, if the predictions have it
+}
+
+// Probabilities returns the probabilities of the classes given the scores : the calibrated probabilities
+// if the calibration is not nil, and the softmax of the scores otherwise.
+func Probabilities(scores [][]float64, calibration *predictor.Calibration) (probs [][]float64) {
+	probs = make([][]float64, len(scores))
+	for i := range scores {
+		probs[i] = make([]float64, len(scores[i]))
+		if calibration != nil {
+			calibration.Probabilities(scores[i], probs[i])
+		} else {
+			copy(probs[i], scores[i])
+			predictor.SoftMax(probs[i])
+		}
+	}
+	return
+}
+
+// Evaluate returns the metrics of the predictions of the probabilities of the classes, of the given names,
+// for samples of the given labels, with a reliability diagram of nbBins bins.
+func Evaluate(probs [][]float64, labels []int, names []string, nbBins int) (r *Report, err error) {
+
+	if len(probs) == 0 {
+		return nil, fmt.Errorf("no sample to evaluate")
+	}
+
+	if len(probs) != len(labels) {
+		return nil, fmt.Errorf("%d predictions but %d labels", len(probs), len(labels))
+	}
+
+	nbClasses := len(names)
+
+	r = &Report{Samples: len(probs), Classes: make([]ClassMetrics, nbClasses), Confusion: make([][]int, nbClasses)}
+	for i := range r.Confusion {
+		r.Confusion[i] = make([]int, nbClasses)
+	}
+
+	for i := range probs {
+
+		if len(probs[i]) != nbClasses {
+			return nil, fmt.Errorf("sample %d has %d probabilities but there are %d classes", i, len(probs[i]), nbClasses)
+		}
+
+		if labels[i] < 0 || labels[i] >= nbClasses {
+			return nil, fmt.Errorf("label %d of sample %d is not a class", labels[i], i)
+		}
+
+		prediction := predictor.MaxIndex(probs[i])
+		r.Confusion[labels[i]][prediction]++
+
+		if prediction == labels[i] {
+			r.Accuracy++
+		}
+
+		r.LogLoss -= math.Log(math.Min(math.Max(probs[i][labels[i]], 1e-15), 1-1e-15))
+	}
+
+	n := float64(r.Samples)
+	r.Accuracy /= n
+	r.LogLoss /= n
+
+	var microPositives, microNegatives []float64
+	var nbAUCs int
+	for c := range r.Classes {
+
+		m := &r.Classes[c]
+		m.Name = names[c]
+
+		var predicted int
+		for i := range r.Confusion {
+			m.Support += r.Confusion[c][i]
+			predicted += r.Confusion[i][c]
+		}
+
+		tp := float64(r.Confusion[c][c])
+		if predicted > 0 {
+			m.Precision = tp / float64(predicted)
+		}
+		if m.Support > 0 {
+			m.Recall = tp / float64(m.Support)
+		}
+		if m.Precision+m.Recall > 0 {
+			m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+
+		r.MacroPrecision += m.Precision
+		r.MacroRecall += m.Recall
+		r.MacroF1 += m.F1
+
+		var positives, negatives []float64
+		for i := range probs {
+			if labels[i] == c {
+				positives = append(positives, probs[i][c])
+			} else {
+				negatives = append(negatives, probs[i][c])
+			}
+		}
+
+		microPositives = append(microPositives, positives...)
+		microNegatives = append(microNegatives, negatives...)
+
+		if len(positives) > 0 && len(negatives) > 0 {
+			m.ROCAUC = AUROC(positives, negatives)
+			m.PRAUC = AveragePrecision(positives, negatives)
+			r.MacroROCAUC += m.ROCAUC
+			r.MacroPRAUC += m.PRAUC
+			nbAUCs++
+		}
+	}
+
+	r.MacroPrecision /= float64(nbClasses)
+	r.MacroRecall /= float64(nbClasses)
+	r.MacroF1 /= float64(nbClasses)
+
+	if nbAUCs > 0 {
+		r.MacroROCAUC /= float64(nbAUCs)
+		r.MacroPRAUC /= float64(nbAUCs)
+	}
+
+	if len(microNegatives) > 0 {
+		r.MicroROCAUC = AUROC(microPositives, microNegatives)
+	}
+
+	r.Reliability = NewReliabilityDiagram(probs, labels, nbBins)
+	r.ECE = r.Reliability.ECE()
+
+	return
+}
+
+// String returns the report as text : the global metrics, the metrics of each class, the confusion matrix
+// and the open-set metrics.
+func (r *Report) String() string {
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Samples   : %d\n", r.Samples)
+	fmt.Fprintf(&sb, "Accuracy  : %.4f\n", r.Accuracy)
+	fmt.Fprintf(&sb, "Log-loss  : %.4f\n", r.LogLoss)
+	fmt.Fprintf(&sb, "ECE       : %.4f\n", r.ECE)
+	fmt.Fprintf(&sb, "ROC-AUC   : macro %.4f, micro %.4f\n", r.MacroROCAUC, r.MicroROCAUC)
+	fmt.Fprintf(&sb, "PR-AUC    : macro %.4f\n", r.MacroPRAUC)
+	fmt.Fprintf(&sb, "Precision : macro %.4f\n", r.MacroPrecision)
+	fmt.Fprintf(&sb, "Recall    : macro %.4f\n", r.MacroRecall)
+	fmt.Fprintf(&sb, "F1        : macro %.4f\n", r.MacroF1)
+	fmt.Fprintln(&sb)
+
+	width := len("class")
+	for _, m := range r.Classes {
+		if len(m.Name) > width {
+			width = len(m.Name)
+		}
+	}
+
+	fmt.Fprintf(&sb, "%-*s %8s %9s %9s %9s %9s %9s\n", width, "class", "support", "precision", "recall", "f1", "roc-auc", "pr-auc")
+	for _, m := range r.Classes {
+		fmt.Fprintf(&sb, "%-*s %8d %9.4f %9.4f %9.4f %9.4f %9.4f\n", width, m.Name, m.Support, m.Precision, m.Recall, m.F1, m.ROCAUC, m.PRAUC)
+	}
+	fmt.Fprintln(&sb)
+
+	fmt.Fprintf(&sb, "Confusion matrix (rows : true class, columns : predicted class)\n")
+	fmt.Fprintf(&sb, "%-*s", width, "")
+	for _, m := range r.Classes {
+		fmt.Fprintf(&sb, " %*s", width, m.Name)
+	}
+	fmt.Fprintln(&sb)
+	for i, m := range r.Classes {
+		fmt.Fprintf(&sb, "%-*s", width, m.Name)
+		for _, count := range r.Confusion[i] {
+			fmt.Fprintf(&sb, " %*d", width, count)
+		}
+		fmt.Fprintln(&sb)
+	}
+
+	if r.OpenSet != nil {
+		fmt.Fprintln(&sb)
+		fmt.Fprintln(&sb, r.OpenSet)
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// WriteJSON writes the report in JSON.
+func (r *Report) WriteJSON(w io.Writer) (err error) {
+	var buff []byte
+	if buff, err = json.MarshalIndent(r, "", "\t"); err != nil {
+		return
+	}
+	_, err = w.Write(append(buff, '\n'))
+	return
+}
+
+// WriteCSV writes the metrics of the classes in CSV, one record "class,support,precision,recall,f1,roc_auc,pr_auc"
+// per class after a header, followed by the macro averages in a record of class "macro".
+func (r *Report) WriteCSV(w io.Writer) error {
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 6, 64)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"class", "support", "precision", "recall", "f1", "roc_auc", "pr_auc"})
+
+	for _, m := range r.Classes {
+		cw.Write([]string{m.Name, strconv.Itoa(m.Support), format(m.Precision), format(m.Recall), format(m.F1), format(m.ROCAUC), format(m.PRAUC)})
+	}
+
+	cw.Write([]string{"macro", strconv.Itoa(r.Samples), format(r.MacroPrecision), format(r.MacroRecall), format(r.MacroF1), format(r.MacroROCAUC), format(r.MacroPRAUC)})
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteConfusionCSV writes the confusion matrix in CSV : a header of the predicted classes, then one record per
+// true class, starting with its name.
+func (r *Report) WriteConfusionCSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+
+	record := []string{"true\\predicted"}
+	for _, m := range r.Classes {
+		record = append(record, m.Name)
+	}
+	cw.Write(record)
+
+	for i, m := range r.Classes {
+		record = record[:0]
+		record = append(record, m.Name)
+		for _, count := range r.Confusion[i] {
+			record = append(record, strconv.Itoa(count))
+		}
+		cw.Write(record)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
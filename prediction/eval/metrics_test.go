@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+
+	names := []string{"A", "B", "C"}
+
+	probs := [][]float64{
+		{0.8, 0.1, 0.1}, // A as A
+		{0.6, 0.3, 0.1}, // A as A
+		{0.2, 0.7, 0.1}, // A as B
+		{0.1, 0.8, 0.1}, // B as B
+		{0.5, 0.4, 0.1}, // B as A
+		{0.1, 0.2, 0.7}, // C as C
+	}
+	labels := []int{0, 0, 0, 1, 1, 2}
+
+	r, err := Evaluate(probs, labels, names, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confusion := [][]int{{2, 1, 0}, {1, 1, 0}, {0, 0, 1}}
+	for i := range confusion {
+		for j := range confusion[i] {
+			if r.Confusion[i][j] != confusion[i][j] {
+				t.Fatalf("confusion matrix %v, expected %v", r.Confusion, confusion)
+			}
+		}
+	}
+
+	if math.Abs(r.Accuracy-4.0/6) > 1e-12 {
+		t.Fatalf("accuracy %f", r.Accuracy)
+	}
+
+	logLoss := -(math.Log(0.8) + math.Log(0.6) + math.Log(0.2) + math.Log(0.8) + math.Log(0.4) + math.Log(0.7)) / 6
+	if math.Abs(r.LogLoss-logLoss) > 1e-12 {
+		t.Fatalf("log-loss %f, expected %f", r.LogLoss, logLoss)
+	}
+
+	// A : precision 2/3, recall 2/3 ; B : precision 1/2, recall 1/2 ; C : precision 1, recall 1
+	expected := []ClassMetrics{
+		{Name: "A", Support: 3, Precision: 2.0 / 3, Recall: 2.0 / 3, F1: 2.0 / 3},
+		{Name: "B", Support: 2, Precision: 0.5, Recall: 0.5, F1: 0.5},
+		{Name: "C", Support: 1, Precision: 1, Recall: 1, F1: 1},
+	}
+
+	for c, m := range expected {
+		got := r.Classes[c]
+		if got.Name != m.Name || got.Support != m.Support || math.Abs(got.Precision-m.Precision) > 1e-12 ||
+			math.Abs(got.Recall-m.Recall) > 1e-12 || math.Abs(got.F1-m.F1) > 1e-12 {
+			t.Fatalf("class %d : %+v, expected %+v", c, got, m)
+		}
+	}
+
+	if math.Abs(r.MacroF1-(2.0/3+0.5+1)/3) > 1e-12 {
+		t.Fatalf("macro F1 %f", r.MacroF1)
+	}
+
+	// A : positives 0.8, 0.6, 0.2, negatives 0.1, 0.5, 0.1 : 8 of the 9 pairs are ordered
+	if math.Abs(r.Classes[0].ROCAUC-8.0/9) > 1e-12 {
+		t.Fatalf("ROC-AUC of A %f", r.Classes[0].ROCAUC)
+	}
+
+	// C is separated from the other classes
+	if r.Classes[2].ROCAUC != 1 || r.Classes[2].PRAUC != 1 {
+		t.Fatalf("AUCs of C %f %f", r.Classes[2].ROCAUC, r.Classes[2].PRAUC)
+	}
+
+	var buff bytes.Buffer
+	if err = r.WriteJSON(&buff); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Report
+	if err = json.Unmarshal(buff.Bytes(), &decoded); err != nil || decoded.Classes[1].Name != "B" {
+		t.Fatalf("JSON %s : %v", buff.String(), err)
+	}
+
+	buff.Reset()
+	if err = r.WriteCSV(&buff); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buff.String()), "\n"); len(lines) != 5 || !strings.HasPrefix(lines[4], "macro,6,") {
+		t.Fatalf("CSV\n%s", buff.String())
+	}
+
+	buff.Reset()
+	if err = r.WriteConfusionCSV(&buff); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buff.String()), "\n"); len(lines) != 4 || lines[2] != "B,1,1,0" {
+		t.Fatalf("confusion CSV\n%s", buff.String())
+	}
+
+	if _, err = Evaluate(probs, labels[1:], names, 10); err == nil {
+		t.Fatal("probabilities and labels of different lengths accepted")
+	}
+
+	if _, err = Evaluate(probs, []int{0, 0, 0, 1, 1, 3}, names, 10); err == nil {
+		t.Fatal("label out of the classes accepted")
+	}
+}
+
+func TestProbabilities(t *testing.T) {
+
+	scores := [][]float64{{1, 2, 3}}
+
+	probs := Probabilities(scores, nil)
+	calibrated := Probabilities(scores, &predictor.Calibration{Temperature: 2})
+
+	if scores[0][0] != 1 {
+		t.Fatal("the scores are modified")
+	}
+
+	sum := math.Exp(0.5) + math.Exp(1) + math.Exp(1.5)
+	if math.Abs(calibrated[0][2]-math.Exp(1.5)/sum) > 1e-12 {
+		t.Fatalf("calibrated probabilities %v", calibrated[0])
+	}
+
+	if calibrated[0][2] >= probs[0][2] {
+		t.Fatal("a temperature larger than 1 must decrease the largest probability")
+	}
+}
@@ -0,0 +1,125 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+)
+
+// OpenSetReport are the metrics of the detection of the genomes of unknown lineages.
+type OpenSetReport struct {
+	Known             int     `json:"known"`               // Number of genomes of known lineages
+	Unknown           int     `json:"unknown"`             // Number of genomes of unknown lineages
+	KnownAccepted     float64 `json:"known_accepted"`      // Fraction of the known genomes predicted as a strain
+	UnknownRejected   float64 `json:"unknown_rejected"`    // Fraction of the unknown genomes predicted as unknown
+	AUROC             float64 `json:"auroc"`               // Area under the ROC curve of the confidence separating known and unknown genomes
+	ClosedSetAccuracy float64 `json:"closed_set_accuracy"` // Accuracy on the known genomes without abstention
+	OpenSetAccuracy   float64 `json:"open_set_accuracy"`   // Fraction of the known genomes predicted as their strain and of the unknown genomes predicted as unknown
+}
+
+// NewOpenSetReport evaluates the open set on the scores of genomes of known lineages, of the given labels,
+// and on the scores of genomes of unknown lineages.
+func NewOpenSetReport(o *predictor.OpenSet, known [][]float64, labels []int, unknown [][]float64) (r OpenSetReport) {
+
+	n := len(known) + len(unknown)
+
+	allLabels := make([]int, 0, n)
+	predictions := make([]int, 0, n)
+	closed := make([]int, 0, n)
+	confidences := make([]float64, 0, n)
+
+	for i, scores := range known {
+		allLabels = append(allLabels, labels[i])
+		predictions = append(predictions, o.Predict(scores))
+		closed = append(closed, predictor.MaxIndex(scores))
+		confidences = append(confidences, predictor.Confidence(o.Confidence, scores))
+	}
+
+	for _, scores := range unknown {
+		allLabels = append(allLabels, -1)
+		predictions = append(predictions, o.Predict(scores))
+		closed = append(closed, predictor.MaxIndex(scores))
+		confidences = append(confidences, predictor.Confidence(o.Confidence, scores))
+	}
+
+	r, err := EvaluateOpenSet(allLabels, predictions, closed, confidences)
+	if err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+// EvaluateOpenSet returns the open-set metrics of the predictions of genomes of the given labels, the label of
+// a genome of an unknown lineage and the prediction of a genome predicted as unknown being -1. The closed
+// predictions are the strains of largest score, without abstention. The confidences of the predictions give
+// the AUROC, which is 0 if they are nil or if there are no known or no unknown genomes.
+func EvaluateOpenSet(labels, predictions, closed []int, confidences []float64) (r OpenSetReport, err error) {
+
+	if len(predictions) != len(labels) || len(closed) != len(labels) || (confidences != nil && len(confidences) != len(labels)) {
+		return r, fmt.Errorf("%d labels but %d predictions, %d closed predictions and %d confidences", len(labels), len(predictions), len(closed), len(confidences))
+	}
+
+	if len(labels) == 0 {
+		return r, fmt.Errorf("no genome to evaluate")
+	}
+
+	var accepted, correct, openCorrect, rejected int
+	var knownConfidences, unknownConfidences []float64
+	for i := range labels {
+
+		if labels[i] == -1 {
+
+			r.Unknown++
+
+			if predictions[i] == -1 {
+				rejected++
+			}
+
+			if confidences != nil {
+				unknownConfidences = append(unknownConfidences, confidences[i])
+			}
+
+			continue
+		}
+
+		r.Known++
+
+		if predictions[i] != -1 {
+			accepted++
+		}
+
+		if closed[i] == labels[i] {
+			correct++
+		}
+
+		if predictions[i] == labels[i] {
+			openCorrect++
+		}
+
+		if confidences != nil {
+			knownConfidences = append(knownConfidences, confidences[i])
+		}
+	}
+
+	if r.Known > 0 {
+		r.KnownAccepted = float64(accepted) / float64(r.Known)
+		r.ClosedSetAccuracy = float64(correct) / float64(r.Known)
+	}
+
+	if r.Unknown > 0 {
+		r.UnknownRejected = float64(rejected) / float64(r.Unknown)
+	}
+
+	if len(knownConfidences) > 0 && len(unknownConfidences) > 0 {
+		r.AUROC = AUROC(knownConfidences, unknownConfidences)
+	}
+
+	r.OpenSetAccuracy = float64(openCorrect+rejected) / float64(r.Known+r.Unknown)
+
+	return
+}
+
+func (r OpenSetReport) String() string {
+	return fmt.Sprintf("Open set on %d known and %d unknown genomes : known accepted %.4f, unknown rejected %.4f, AUROC %.4f, closed-set accuracy %.4f, open-set accuracy %.4f",
+		r.Known, r.Unknown, r.KnownAccepted, r.UnknownRejected, r.AUROC, r.ClosedSetAccuracy, r.OpenSetAccuracy)
+}
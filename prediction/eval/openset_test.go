@@ -0,0 +1,48 @@
+package eval
+
+import (
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"math"
+	"testing"
+)
+
+func TestOpenSetReport(t *testing.T) {
+
+	openSet := &predictor.OpenSet{Confidence: predictor.ConfidenceMaxSoftmax, Threshold: 0.5, Acceptance: 0.9}
+
+	known := [][]float64{{5, 0}, {0, 5}, {0.1, 0}, {5, 0}}
+	labels := []int{0, 1, 0, 1}
+	unknown := [][]float64{{0, 0.1}, {5, 0}}
+
+	r := NewOpenSetReport(openSet, known, labels, unknown)
+
+	if r.KnownAccepted != 1 || r.ClosedSetAccuracy != 0.75 || r.UnknownRejected != 0 {
+		t.Fatalf("%s", r)
+	}
+
+	openSet.Threshold = 0.55
+	r = NewOpenSetReport(openSet, known, labels, unknown)
+
+	if r.KnownAccepted != 0.75 || r.UnknownRejected != 0.5 || r.OpenSetAccuracy != 3.0/6 {
+		t.Fatalf("%s", r)
+	}
+
+	// Of the 8 (known, unknown) pairs, 3 are ordered and 4 are tied
+	if math.Abs(r.AUROC-5.0/8) > 1e-12 {
+		t.Fatalf("AUROC %f", r.AUROC)
+	}
+
+	// From the predictions, without the confidences
+	r, err := EvaluateOpenSet([]int{0, 1, -1, -1}, []int{0, -1, -1, 1}, []int{0, 0, 1, 1}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.KnownAccepted != 0.5 || r.UnknownRejected != 0.5 || r.ClosedSetAccuracy != 0.5 || r.OpenSetAccuracy != 0.5 || r.AUROC != 0 {
+		t.Fatalf("%s", r)
+	}
+
+	if _, err = EvaluateOpenSet([]int{0, 1}, []int{0}, []int{0, 1}, nil); err == nil {
+		t.Fatal("missing prediction accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package eval
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ReliabilityBin is the set of predictions whose confidence, the probability of the predicted strain,
+// is in [Lower, Upper).
+type ReliabilityBin struct {
+	Lower      float64 `json:"lower"`
+	Upper      float64 `json:"upper"`
+	Count      int     `json:"count"`      // Number of predictions
+	Confidence float64 `json:"confidence"` // Mean confidence of the predictions
+	Accuracy   float64 `json:"accuracy"`   // Fraction of the predictions that are correct
+}
+
+// ReliabilityDiagram compares the confidence of the predictions with their accuracy, in bins of equal width of
+// the confidence. The probabilities of a perfectly calibrated model have the accuracy of their confidence.
+type ReliabilityDiagram []ReliabilityBin
+
+// NewReliabilityDiagram returns the reliability diagram in nbBins bins of the predictions of the probabilities
+// of the strains, of the given labels.
+func NewReliabilityDiagram(probs [][]float64, labels []int, nbBins int) ReliabilityDiagram {
+
+	d := make(ReliabilityDiagram, nbBins)
+	for i := range d {
+		d[i].Lower, d[i].Upper = float64(i)/float64(nbBins), float64(i+1)/float64(nbBins)
+	}
+
+	for i := range probs {
+
+		prediction := predictor.MaxIndex(probs[i])
+		confidence := probs[i][prediction]
+
+		bin := int(confidence * float64(nbBins))
+		if bin >= nbBins {
+			bin = nbBins - 1
+		}
+
+		d[bin].Count++
+		d[bin].Confidence += confidence
+		if prediction == labels[i] {
+			d[bin].Accuracy++
+		}
+	}
+
+	for i := range d {
+		if d[i].Count > 0 {
+			d[i].Confidence /= float64(d[i].Count)
+			d[i].Accuracy /= float64(d[i].Count)
+		}
+	}
+
+	return d
+}
+
+// ECE returns the expected calibration error : the mean over the predictions of the difference between
+// the accuracy and the confidence of their bin.
+func (d ReliabilityDiagram) ECE() (ece float64) {
+
+	var n int
+	for _, b := range d {
+		ece += float64(b.Count) * math.Abs(b.Accuracy-b.Confidence)
+		n += b.Count
+	}
+
+	if n == 0 {
+		return 0
+	}
+
+	return ece / float64(n)
+}
+
+// WriteCSV writes the bins in CSV, one record "lower,upper,count,confidence,accuracy" per bin after a header.
+func (d ReliabilityDiagram) WriteCSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"lower", "upper", "count", "confidence", "accuracy"})
+
+	for _, b := range d {
+		cw.Write([]string{
+			strconv.FormatFloat(b.Lower, 'g', -1, 64),
+			strconv.FormatFloat(b.Upper, 'g', -1, 64),
+			strconv.Itoa(b.Count),
+			strconv.FormatFloat(b.Confidence, 'f', 6, 64),
+			strconv.FormatFloat(b.Accuracy, 'f', 6, 64),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// String draws the diagram as text, one line per non-empty bin, the bar being the accuracy and '|' the confidence.
+func (d ReliabilityDiagram) String() string {
+
+	const width = 40
+
+	var sb strings.Builder
+	for _, b := range d {
+
+		if b.Count == 0 {
+			continue
+		}
+
+		bar := []byte(strings.Repeat("#", int(math.Round(b.Accuracy*width))) + strings.Repeat(" ", width+1))[:width+1]
+		bar[int(math.Round(b.Confidence*width))] = '|'
+
+		fmt.Fprintf(&sb, "[%.2f, %.2f) %6d  %s  confidence %.3f, accuracy %.3f\n", b.Lower, b.Upper, b.Count, bar, b.Confidence, b.Accuracy)
+	}
+
+	fmt.Fprintf(&sb, "ECE %.4f", d.ECE())
+
+	return sb.String()
+}
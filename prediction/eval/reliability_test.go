@@ -0,0 +1,52 @@
+package eval
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestReliabilityDiagram(t *testing.T) {
+
+	probs := [][]float64{
+		{0.95, 0.05}, // correct
+		{0.05, 0.95}, // wrong
+		{0.7, 0.3},   // correct
+		{0.35, 0.65}, // correct
+		{1, 0},       // correct, last bin
+	}
+	labels := []int{0, 0, 0, 1, 0}
+
+	d := NewReliabilityDiagram(probs, labels, 4)
+
+	if len(d) != 4 || d[3].Upper != 1 {
+		t.Fatalf("bins %v", d)
+	}
+
+	// Confidences 0.95, 0.95 and 1 in [0.75, 1), 0.7 and 0.65 in [0.5, 0.75)
+	counts := []int{0, 0, 2, 3}
+	for i := range d {
+		if d[i].Count != counts[i] {
+			t.Fatalf("bin %d : %d predictions, expected %d", i, d[i].Count, counts[i])
+		}
+	}
+
+	if math.Abs(d[3].Confidence-2.9/3) > 1e-12 || math.Abs(d[3].Accuracy-2.0/3) > 1e-12 {
+		t.Fatalf("last bin : confidence %f, accuracy %f", d[3].Confidence, d[3].Accuracy)
+	}
+
+	ece := (2*math.Abs(1-0.675) + 3*math.Abs(2.0/3-2.9/3)) / 5
+	if math.Abs(d.ECE()-ece) > 1e-12 {
+		t.Fatalf("ECE %f, expected %f", d.ECE(), ece)
+	}
+
+	var buff bytes.Buffer
+	if err := d.WriteCSV(&buff); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buff.String()), "\n"); len(lines) != 5 || lines[0] != "lower,upper,count,confidence,accuracy" {
+		t.Fatalf("CSV\n%s", buff.String())
+	}
+}
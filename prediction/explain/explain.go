@@ -0,0 +1,357 @@
+// Package explain decomposes the score of a strain for a genome, in plaintext, into the contributions of the
+// coefficients of its hash and of the k-mers of its FCGR matrix.
+package explain
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// MaxHeatmapWindow is the largest window of the heatmap drawn by WriteHeatmapPNG, 512 x 512 cells : the heatmaps of
+// larger windows are downsampled (see Heatmap).
+const MaxHeatmapWindow = 9
+
+// Explanation decomposes the score w . hash + b of a strain for a genome. The hash is the selection of the
+// coefficients of the orthonormal 2D DCTII of the normalized n x n FCGR matrix F of the genome, so the score is also
+// <F, G> + b, where G is the 2D DCTIII of the matrix whose selected coefficients are the weights w and the others
+// are zero : the k-mer (x, y) contributes F[x][y] * G[x][y], G[x][y] being the sum of w[j] * c_u[x] * c_v[y] over
+// the selected coefficients (u, v), c_u being the u-th DCTII basis vector (see preprocessing.DCTIIBasis).
+// G is only computed at the non-empty cells of F, the k-mers of the genome. The empty cells, which all have the
+// value Empty, contribute Empty * (n * w(0, 0) - the sum of G over the non-empty cells) together, as G sums to n
+// times the weight of the coefficient (0, 0) (zero if it is not selected). The contributions of the coefficients,
+// and of the k-mers with the empty cells, both sum to Score - Bias.
+type Explanation struct {
+	Strain            int
+	Score             float64
+	Bias              float64
+	Coefficients      []CoefficientContribution // Contribution of each coefficient of the hash, in the order of the hash
+	Empty             float64                   // Normalized value of the empty cells of the FCGR matrix
+	NbEmpty           int                       // Number of empty cells of the FCGR matrix
+	EmptyContribution float64                   // Sum of the contributions of the empty cells
+	fcgr              FCGR
+	gradient          []float64 // G at the entries of fcgr
+	weights           []float64
+	coefficients      [][2]int
+	kmers             []KmerContribution
+}
+
+// FCGR is a normalized FCGR matrix of size 2^Window x 2^Window, stored as its non-empty cells.
+type FCGR struct {
+	Window  int
+	Entries []preprocessing.SparseEntry // Non-empty cells, sorted by row and column
+	Empty   float64                     // Value of the other cells
+}
+
+// CoefficientContribution is the contribution w[j] * hash[j] of the j-th coefficient of the hash.
+type CoefficientContribution struct {
+	Row, Column  int // Indexes of the coefficient in the DCTII of the FCGR matrix
+	Weight       float64
+	Value        float64
+	Contribution float64
+}
+
+// KmerContribution is the contribution of a k-mer, whose normalized count in the FCGR matrix is Value.
+type KmerContribution struct {
+	Kmer         string
+	X, Y         int
+	Value        float64
+	Contribution float64
+}
+
+// Hasher is a feature extractor whose hash is a selection of the coefficients of the orthonormal 2D DCTII of the
+// normalized FCGR matrix of the genome : the DCTHasher, whose FCGR matrix is dense, and the SparseDCTHasher, whose
+// FCGR matrix is the list of its non-empty cells.
+type Hasher interface {
+	Hash(worker int, dna string)
+	GetHash(worker int) []float64
+	MapCGR(worker int, dna string)
+	Window() int
+	Coefficients() [][2]int
+}
+
+// sparseHasher is a Hasher exposing the non-empty cells of its FCGR matrix (SparseDCTHasher).
+type sparseHasher interface {
+	GetEntries(worker int) []preprocessing.SparseEntry
+	GetEmpty(worker int) float64
+}
+
+// denseHasher is a Hasher exposing its dense FCGR matrix (DCTHasher).
+type denseHasher interface {
+	GetCGR(worker int) [][]float64
+}
+
+// Explain decomposes the score of the strain of the given weights and bias for the genome of the given hash and
+// normalized FCGR matrix, computed by the hasher (see Genome).
+func Explain(hasher Hasher, strain int, weights []float64, bias float64, fcgr FCGR, hash []float64) *Explanation {
+
+	coefficients := hasher.Coefficients()
+
+	if len(weights) != len(coefficients) || len(hash) != len(coefficients) {
+		panic(fmt.Errorf("%d weights and %d coefficients but the hasher selects %d coefficients", len(weights), len(hash), len(coefficients)))
+	}
+
+	if fcgr.Window != hasher.Window() {
+		panic(fmt.Errorf("FCGR matrix of window %d but the hasher has window %d", fcgr.Window, hasher.Window()))
+	}
+
+	e := &Explanation{
+		Strain:       strain,
+		Bias:         bias,
+		Score:        bias,
+		Coefficients: make([]CoefficientContribution, len(coefficients)),
+		Empty:        fcgr.Empty,
+		fcgr:         fcgr,
+		gradient:     make([]float64, len(fcgr.Entries)),
+		weights:      weights,
+		coefficients: coefficients,
+		kmers:        make([]KmerContribution, len(fcgr.Entries)),
+	}
+
+	var weight00 float64
+	for j, c := range coefficients {
+		e.Coefficients[j] = CoefficientContribution{Row: c[0], Column: c[1], Weight: weights[j], Value: hash[j], Contribution: weights[j] * hash[j]}
+		e.Score += weights[j] * hash[j]
+		if c[0] == 0 && c[1] == 0 {
+			weight00 += weights[j]
+		}
+	}
+
+	// Gradient of the score in the FCGR space at the non-empty cells
+	n := 1 << fcgr.Window
+	rows, cols := blockSize(coefficients)
+	cu, cv := make([]float64, rows), make([]float64, cols)
+
+	var sum float64
+	for i, entry := range fcgr.Entries {
+
+		for u := range cu {
+			cu[u] = preprocessing.DCTIIBasis(n, u, entry.X)
+		}
+
+		for v := range cv {
+			cv[v] = preprocessing.DCTIIBasis(n, v, entry.Y)
+		}
+
+		var g float64
+		for j, c := range coefficients {
+			g += weights[j] * cu[c[0]] * cv[c[1]]
+		}
+
+		e.gradient[i] = g
+		sum += g
+
+		e.kmers[i] = KmerContribution{
+			Kmer:         preprocessing.SubString2D(entry.X, entry.Y, fcgr.Window),
+			X:            entry.X,
+			Y:            entry.Y,
+			Value:        entry.Value,
+			Contribution: entry.Value * g,
+		}
+	}
+
+	e.NbEmpty = n*n - len(fcgr.Entries)
+	e.EmptyContribution = fcgr.Empty * (float64(n)*weight00 - sum)
+
+	sort.SliceStable(e.kmers, func(i, j int) bool { return math.Abs(e.kmers[i].Contribution) > math.Abs(e.kmers[j].Contribution) })
+
+	return e
+}
+
+// Genome returns the normalized FCGR matrix and the hash of the genome computed by the first worker of the hasher.
+func Genome(hasher Hasher, dna string) (fcgr FCGR, hash []float64) {
+
+	hasher.MapCGR(0, dna)
+
+	// The hasher may overwrite its FCGR matrix when hashing
+	fcgr.Window = hasher.Window()
+	switch h := hasher.(type) {
+	case sparseHasher:
+		fcgr.Entries = append([]preprocessing.SparseEntry{}, h.GetEntries(0)...)
+		fcgr.Empty = h.GetEmpty(0)
+	case denseHasher:
+		for x, row := range h.GetCGR(0) {
+			for y, value := range row {
+				if value != 0 {
+					fcgr.Entries = append(fcgr.Entries, preprocessing.SparseEntry{X: x, Y: y, Value: value})
+				}
+			}
+		}
+	default:
+		panic(fmt.Errorf("the hasher exposes neither the entries nor the dense matrix of its FCGR matrix"))
+	}
+
+	hasher.Hash(0, dna)
+
+	return fcgr, append([]float64{}, hasher.GetHash(0)...)
+}
+
+// Kmers returns the contributions of the k-mers present in the FCGR matrix (its non-empty cells), by decreasing
+// absolute contribution. They sum to Score - Bias - EmptyContribution.
+func (e *Explanation) Kmers() []KmerContribution {
+	return e.kmers
+}
+
+// Heatmap returns the contributions of the cells of the FCGR matrix summed over blocks, as a dense matrix of size
+// 2^level x 2^level, level being the smaller of the window and maxWindow : the block (X, Y) gathers the k-mers (x, y)
+// whose last level bases are SubString2D(X, Y, level), that is x >> (window - level) = X and y >> (window - level) = Y.
+// For level = window, the block (x, y) is the contribution of the k-mer (x, y) (see MapSubString2D). The heatmap
+// costs O((4^level + 2^window) * h) for h rows and columns of the selected coefficients, instead of 4^window.
+func (e *Explanation) Heatmap(maxWindow int) (heatmap [][]float64) {
+
+	window := e.fcgr.Window
+	level := window
+	if level > maxWindow {
+		level = maxWindow
+	}
+
+	n, size, shift := 1<<window, 1<<level, uint(window-level)
+	rows, cols := blockSize(e.coefficients)
+
+	// basis[u][X] is the sum of the u-th DCTII basis vector over the block X
+	h := rows
+	if cols > h {
+		h = cols
+	}
+
+	basis := make([][]float64, h)
+	for u := range basis {
+		basis[u] = make([]float64, size)
+		for x := 0; x < n; x++ {
+			basis[u][x>>shift] += preprocessing.DCTIIBasis(n, u, x)
+		}
+	}
+
+	// Empty times the sum of G over each block, G being separable
+	partial := make([][]float64, rows)
+	for u := range partial {
+		partial[u] = make([]float64, size)
+	}
+
+	for j, c := range e.coefficients {
+		for y := range partial[c[0]] {
+			partial[c[0]][y] += e.weights[j] * basis[c[1]][y]
+		}
+	}
+
+	heatmap = make([][]float64, size)
+	for x := range heatmap {
+		heatmap[x] = make([]float64, size)
+		if e.fcgr.Empty != 0 {
+			for u := range partial {
+				c := e.fcgr.Empty * basis[u][x]
+				for y, p := range partial[u] {
+					heatmap[x][y] += c * p
+				}
+			}
+		}
+	}
+
+	// The non-empty cells contribute their value instead of Empty
+	for i, entry := range e.fcgr.Entries {
+		heatmap[entry.X>>shift][entry.Y>>shift] += (entry.Value - e.fcgr.Empty) * e.gradient[i]
+	}
+
+	return
+}
+
+// blockSize returns the number of rows and of columns of the smallest top left block of the DCTII containing the coefficients.
+func blockSize(coefficients [][2]int) (rows, cols int) {
+	for _, c := range coefficients {
+		if c[0]+1 > rows {
+			rows = c[0] + 1
+		}
+		if c[1]+1 > cols {
+			cols = c[1] + 1
+		}
+	}
+	return
+}
+
+// WriteKmersCSV writes the contributions of the k-mers in CSV, one record "kmer,x,y,value,contribution" per k-mer
+// after a header.
+func WriteKmersCSV(w io.Writer, kmers []KmerContribution) error {
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"kmer", "x", "y", "value", "contribution"})
+
+	for _, k := range kmers {
+		cw.Write([]string{k.Kmer, strconv.Itoa(k.X), strconv.Itoa(k.Y), strconv.FormatFloat(k.Value, 'e', 6, 64), strconv.FormatFloat(k.Contribution, 'e', 6, 64)})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCoefficientsCSV writes the contributions of the coefficients of the hash in CSV, one record
+// "index,row,column,weight,value,contribution" per coefficient after a header.
+func (e *Explanation) WriteCoefficientsCSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"index", "row", "column", "weight", "value", "contribution"})
+
+	for j, c := range e.Coefficients {
+		cw.Write([]string{
+			strconv.Itoa(j),
+			strconv.Itoa(c.Row),
+			strconv.Itoa(c.Column),
+			strconv.FormatFloat(c.Weight, 'e', 6, 64),
+			strconv.FormatFloat(c.Value, 'e', 6, 64),
+			strconv.FormatFloat(c.Contribution, 'e', 6, 64),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteHeatmapPNG draws the heatmap of at most MaxHeatmapWindow (see Heatmap) in PNG, the block (X, Y) being the
+// square of cellSize pixels of row X and column Y : red for a positive contribution, blue for a negative one, the
+// largest absolute contribution being saturated.
+func (e *Explanation) WriteHeatmapPNG(w io.Writer, cellSize int) error {
+
+	heatmap := e.Heatmap(MaxHeatmapWindow)
+
+	var max float64
+	for x := range heatmap {
+		for y := range heatmap[x] {
+			max = math.Max(max, math.Abs(heatmap[x][y]))
+		}
+	}
+
+	n := len(heatmap)
+	img := image.NewRGBA(image.Rect(0, 0, n*cellSize, n*cellSize))
+
+	for x := range heatmap {
+		for y := range heatmap[x] {
+
+			var v float64
+			if max > 0 {
+				v = heatmap[x][y] / max
+			}
+
+			c := color.RGBA{255, 255, 255, 255}
+			fade := uint8(math.Round(255 * (1 - math.Abs(v))))
+			if v > 0 {
+				c.G, c.B = fade, fade
+			} else {
+				c.R, c.G = fade, fade
+			}
+
+			for i := 0; i < cellSize; i++ {
+				for j := 0; j < cellSize; j++ {
+					img.SetRGBA(y*cellSize+j, x*cellSize+i, c)
+				}
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
@@ -0,0 +1,214 @@
+package explain
+
+import (
+	"bytes"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
+	"image/png"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func randomGenome(prng *rand.Rand, length int) string {
+	d := make([]byte, length)
+	for i := range d {
+		d[i] = "ACGT"[prng.Intn(4)]
+	}
+	return string(d)
+}
+
+func TestExplain(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	square := preprocessing.NewDCTHasher(1, 5, 4, 0.2)
+
+	zigzag := preprocessing.NewDCTHasher(1, 5, 0, 0.2)
+	zigzag.SetCoefficients(preprocessing.ZigZagCoefficients(20))
+
+	// Same hash as zigzag without the dense FCGR matrix
+	sparse := preprocessing.NewSparseDCTHasher(1, 5, preprocessing.ZigZagCoefficients(20), 0.2)
+
+	// The empty cells have the non-zero CLR of a zero count
+	clr := preprocessing.NewSparseDCTHasher(1, 5, preprocessing.ZigZagCoefficients(20), 0.2)
+	clr.SetNormalization(preprocessing.NormalizationCLR, nil)
+
+	for _, hasher := range []Hasher{square, zigzag, sparse, clr} {
+
+		fcgr, hash := Genome(hasher, randomGenome(prng, 2000))
+
+		// Genome returns the hash of the hasher
+		dna := randomGenome(prng, 100)
+		_, want := Genome(hasher, dna)
+		hasher.Hash(0, dna)
+		for j := range want {
+			if want[j] != hasher.GetHash(0)[j] {
+				t.Fatal("hash different from the hash of the hasher")
+			}
+		}
+
+		weights := make([]float64, len(hash))
+		for j := range weights {
+			weights[j] = prng.NormFloat64()
+		}
+
+		e := Explain(hasher, 1, weights, 0.5, fcgr, hash)
+
+		var score float64
+		for j := range weights {
+			score += weights[j] * hash[j]
+		}
+
+		if math.Abs(e.Score-score-0.5) > 1e-9 {
+			t.Fatalf("score %f, expected %f", e.Score, score+0.5)
+		}
+
+		// The contributions of the k-mers and of the empty cells sum to the score without the bias
+		sum := e.EmptyContribution
+		for _, k := range e.Kmers() {
+			sum += k.Contribution
+		}
+
+		if math.Abs(sum-score) > 1e-9 {
+			t.Fatalf("k-mer contributions summing to %f, expected %f", sum, score)
+		}
+
+		if (e.Empty != 0) != (hasher == clr) || e.NbEmpty != 1024-len(fcgr.Entries) {
+			t.Fatalf("%d empty cells of value %f", e.NbEmpty, e.Empty)
+		}
+
+		// The heatmap of the k-mers has their contributions, and the heatmaps of the blocks sum to the score without the bias
+		heatmap := e.Heatmap(5)
+		for _, k := range e.Kmers() {
+			if math.Abs(heatmap[k.X][k.Y]-k.Contribution) > 1e-9 {
+				t.Fatalf("heatmap (%d, %d) %f, expected %f", k.X, k.Y, heatmap[k.X][k.Y], k.Contribution)
+			}
+		}
+
+		for level := 5; level >= 0; level-- {
+
+			heatmap = e.Heatmap(level)
+
+			if len(heatmap) != 1<<level {
+				t.Fatalf("heatmap of size %d for the level %d", len(heatmap), level)
+			}
+
+			sum = 0
+			for x := range heatmap {
+				for y := range heatmap[x] {
+					sum += heatmap[x][y]
+				}
+			}
+
+			if math.Abs(sum-score) > 1e-9 {
+				t.Fatalf("level %d : heatmap summing to %f, expected %f", level, sum, score)
+			}
+		}
+
+		// The block of a k-mer is the one of its suffix
+		kmer := e.Kmers()[0]
+		if x, y := preprocessing.MapSubString2D(kmer.Kmer[3:]); x != kmer.X>>3 || y != kmer.Y>>3 {
+			t.Fatalf("k-mer %s in the block (%d, %d) of %s", kmer.Kmer, kmer.X>>3, kmer.Y>>3, kmer.Kmer[3:])
+		}
+
+		kmers := e.Kmers()
+		for i := 1; i < len(kmers); i++ {
+			if math.Abs(kmers[i].Contribution) > math.Abs(kmers[i-1].Contribution) {
+				t.Fatal("k-mers not sorted by decreasing absolute contribution")
+			}
+		}
+
+		if x, y := preprocessing.MapSubString2D(kmers[0].Kmer); x != kmers[0].X || y != kmers[0].Y {
+			t.Fatalf("k-mer %s at (%d, %d)", kmers[0].Kmer, kmers[0].X, kmers[0].Y)
+		}
+	}
+}
+
+func TestExplainLargeWindow(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(2))
+
+	// FCGR matrix of 2^40 cells
+	hasher := preprocessing.NewSparseDCTHasher(1, 20, preprocessing.ZigZagCoefficients(20), 0.2)
+	hasher.SetNormalization(preprocessing.NormalizationCLR, nil)
+
+	fcgr, hash := Genome(hasher, randomGenome(prng, 5000))
+
+	weights := make([]float64, len(hash))
+	for j := range weights {
+		weights[j] = prng.NormFloat64()
+	}
+
+	e := Explain(hasher, 0, weights, 0, fcgr, hash)
+
+	sum := e.EmptyContribution
+	for _, k := range e.Kmers() {
+		sum += k.Contribution
+	}
+
+	if math.Abs(sum-e.Score) > 1e-9 {
+		t.Fatalf("contributions summing to %f, expected %f", sum, e.Score)
+	}
+
+	var buff bytes.Buffer
+	if err := e.WriteHeatmapPNG(&buff, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 1<<MaxHeatmapWindow || b.Dy() != 1<<MaxHeatmapWindow {
+		t.Fatalf("image of %dx%d pixels", b.Dx(), b.Dy())
+	}
+}
+
+func TestExplanationOutputs(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(1))
+
+	hasher := preprocessing.NewDCTHasher(1, 4, 3, 0.2)
+	fcgr, hash := Genome(hasher, randomGenome(prng, 500))
+
+	weights := make([]float64, len(hash))
+	for j := range weights {
+		weights[j] = prng.NormFloat64()
+	}
+
+	e := Explain(hasher, 0, weights, 0, fcgr, hash)
+
+	var buff bytes.Buffer
+	if err := e.WriteHeatmapPNG(&buff, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 64 {
+		t.Fatalf("image of %dx%d pixels", b.Dx(), b.Dy())
+	}
+
+	buff.Reset()
+	if err = e.WriteCoefficientsCSV(&buff); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buff.String()), "\n"); len(lines) != 10 || !strings.HasPrefix(lines[2], "1,0,1,") {
+		t.Fatalf("coefficients CSV\n%s", buff.String())
+	}
+
+	buff.Reset()
+	if err = WriteKmersCSV(&buff, e.Kmers()[:5]); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(buff.String()), "\n"); len(lines) != 6 || lines[0] != "kmer,x,y,value,contribution" {
+		t.Fatalf("k-mers CSV\n%s", buff.String())
+	}
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+)
+
+// ExtractorParameters are the parameters of the feature extractors.
+// Each extractor only uses a subset of them.
+type ExtractorParameters struct {
+	Window             int     `json:"window,omitempty"`              // Length of the k-mers
+	HashSqrtSize       int     `json:"hash_sqrt_size,omitempty"`      // Side of the square block of DCT coefficients
+	HashSize           int     `json:"hash_size,omitempty"`           // Dimension of the hash
+	Normalizer         float64 `json:"normalizer,omitempty"`          // Applies x^normalizer to the FCGR
+	AmbiguityExpansion int     `json:"ambiguity_expansion,omitempty"` // Max. number of k-mers an ambiguous k-mer is spread over
+	Strand             string  `json:"strand,omitempty"`              // K-mers counted : forward strand, canonical or both strands
+	Normalization      string  `json:"normalization,omitempty"`       // Normalization of the k-mer counts
+	BackgroundPath     string  `json:"-"`                             // File of the background k-mer document frequencies of the "tfidf" normalization
+	BackgroundChecksum string  `json:"background_checksum,omitempty"` // Checksum of the background file of the "tfidf" normalization
+	Mask               string  `json:"mask,omitempty"`                // Selection of the DCTII coefficients
+	MaskPath           string  `json:"-"`                             // File of the coefficients of the "file" mask
+	MaskChecksum       string  `json:"mask_checksum,omitempty"`       // Checksum of the coefficients of the "file" mask
+}
+
+// ExtractorInfo identifies a feature extractor and its parameters.
+type ExtractorInfo struct {
+	Name       string              `json:"name"`
+	Parameters ExtractorParameters `json:"parameters"`
+}
+
+// ConfiguredParameters returns the pre-processing parameters of lib.
+func ConfiguredParameters() ExtractorParameters {
+	return ExtractorParameters{
+		Window:             Window,
+		HashSqrtSize:       HashSqrtSize,
+		HashSize:           HashSize,
+		Normalizer:         Normalizer,
+		AmbiguityExpansion: AmbiguityExpansion,
+		Strand:             Strand,
+		Normalization:      Normalization,
+		BackgroundPath:     BackgroundPath,
+		Mask:               CoefficientMask,
+		MaskPath:           CoefficientMaskPath,
+	}
+}
+
+// ConfiguredExtractorInfo returns the name of the feature extractor selected in lib and the pre-processing
+// parameters of lib, with the checksums of the background file of the "tfidf" normalization and of the
+// coefficients file of the "file" mask if they are used. The training writes it in model.json.
+func ConfiguredExtractorInfo() (info ExtractorInfo, err error) {
+
+	info = ExtractorInfo{Name: FeatureExtractor, Parameters: ConfiguredParameters()}
+
+	// The files are identified by their checksums, their paths are not recorded
+	info.Parameters.BackgroundPath, info.Parameters.MaskPath = "", ""
+
+	if Normalization == "tfidf" {
+		if info.Parameters.BackgroundChecksum, err = FileChecksum(BackgroundPath); err != nil {
+			return
+		}
+	}
+
+	if CoefficientMask == "file" {
+		if info.Parameters.MaskChecksum, err = FileChecksum(CoefficientMaskPath); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// CheckExtractorInfo returns an error if the extractor of a model, read from its model.json,
+// is not the extractor configured in lib.
+func CheckExtractorInfo(info ExtractorInfo) error {
+
+	configured, err := ConfiguredExtractorInfo()
+	if err != nil {
+		return err
+	}
+
+	if info != configured {
+		return fmt.Errorf("feature extractor mismatch : the model was trained with %+v but lib is configured with %+v", info, configured)
+	}
+
+	return nil
+}
+
+// FileChecksum returns the CRC32 of the content of the file at the given path.
+func FileChecksum(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)), nil
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckExtractorInfo(t *testing.T) {
+
+	info, err := ConfiguredExtractorInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = CheckExtractorInfo(info); err != nil {
+		t.Fatal(err)
+	}
+
+	other := info
+	other.Parameters.Window++
+	if err = CheckExtractorInfo(other); err == nil {
+		t.Fatal("different window accepted")
+	}
+
+	// A parameter unused by the model is still checked
+	other = info
+	other.Parameters.AmbiguityExpansion++
+	if err = CheckExtractorInfo(other); err == nil {
+		t.Fatal("different ambiguity expansion accepted")
+	}
+
+	// The learned mask is identified by the checksum of its file
+	defer func(mask, path string) { CoefficientMask, CoefficientMaskPath = mask, path }(CoefficientMask, CoefficientMaskPath)
+
+	CoefficientMask = "file"
+	CoefficientMaskPath = filepath.Join(t.TempDir(), "coefficients.csv")
+
+	if err = ioutil.WriteFile(CoefficientMaskPath, []byte("0,0\n0,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err = ConfiguredExtractorInfo(); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Parameters.MaskChecksum == "" || info.Parameters.MaskPath != "" {
+		t.Fatalf("parameters %+v", info.Parameters)
+	}
+
+	if err = ioutil.WriteFile(CoefficientMaskPath, []byte("0,0\n1,0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = CheckExtractorInfo(info); err == nil {
+		t.Fatal("different mask accepted")
+	}
+}
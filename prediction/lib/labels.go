@@ -0,0 +1,257 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	if LabelsPath != "" {
+		strains, err := LoadStrains(LabelsPath)
+		if err != nil {
+			panic(err)
+		}
+		SetStrains(strains)
+	}
+}
+
+// LoadStrains reads the file of the lineages of the classes at the given path, one lineage per line in the
+// order of their labels (empty lines are skipped), and returns the map of the lineages to their labels.
+// It returns an error if the file has no lineage or if a lineage is present twice.
+func LoadStrains(path string) (strains map[string]int, err error) {
+
+	var fr *os.File
+	if fr, err = os.Open(path); err != nil {
+		return
+	}
+	defer fr.Close()
+
+	strains = map[string]int{}
+
+	scanner := bufio.NewScanner(fr)
+	for line := 1; scanner.Scan(); line++ {
+
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" {
+			continue
+		}
+
+		if _, ok := strains[name]; ok {
+			return nil, fmt.Errorf("%s line %d : duplicate lineage %s", path, line, name)
+		}
+
+		strains[name] = len(strains)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s : %s", path, err)
+	}
+
+	if len(strains) == 0 {
+		return nil, fmt.Errorf("%s : no lineage", path)
+	}
+
+	return
+}
+
+// SetStrains sets StrainsMap to the given lineages and updates NbStrains and NbSamples.
+func SetStrains(strains map[string]int) {
+	StrainsMap = strains
+	NbStrains = len(strains)
+	NbSamples = NbStrains * NbSamplesPerStrain
+}
+
+// UnknownClass is the name of the optional class of the genomes whose lineage is not in the label set.
+const UnknownClass = "unknown"
+
+// LabelSet maps the lineages of the classes of the model to their labels.
+type LabelSet struct {
+	names  []string
+	labels map[string]int
+}
+
+// NewLabelSet creates the label set of the given lineages, whose labels must be 0, 1, ..., len(strains)-1.
+// If a lineage is named UnknownClass, the genomes of lineages outside of the set get its label.
+func NewLabelSet(strains map[string]int) (ls *LabelSet, err error) {
+
+	ls = &LabelSet{names: make([]string, len(strains)), labels: map[string]int{}}
+
+	for name, label := range strains {
+		if label < 0 || label >= len(strains) || ls.names[label] != "" {
+			return nil, fmt.Errorf("the labels of the lineages must be 0 to %d, each used once", len(strains)-1)
+		}
+		ls.names[label] = name
+		ls.labels[name] = label
+	}
+
+	return
+}
+
+// Len returns the number of classes.
+func (ls *LabelSet) Len() int {
+	return len(ls.names)
+}
+
+// Names returns the lineages of the classes, indexed by label.
+func (ls *LabelSet) Names() []string {
+	return ls.names
+}
+
+// Index returns the label of the lineage and true, or false if the lineage is not in the set.
+func (ls *LabelSet) Index(lineage string) (label int, ok bool) {
+	label, ok = ls.labels[lineage]
+	return
+}
+
+// Label returns the label of the lineage, or the label of UnknownClass if the lineage is not in the set.
+// It returns an error if the lineage is not in the set and the set has no UnknownClass.
+func (ls *LabelSet) Label(lineage string) (int, error) {
+
+	if label, ok := ls.labels[lineage]; ok {
+		return label, nil
+	}
+
+	if label, ok := ls.labels[UnknownClass]; ok {
+		return label, nil
+	}
+
+	return 0, fmt.Errorf("lineage %s is not in the label set %v", lineage, ls.names)
+}
+
+// Metadata maps the sequence IDs to their lineage.
+type Metadata map[string]string
+
+// LoadMetadata reads the TSV (if the file extension is .tsv) or CSV file at the given path, whose first record
+// names the columns, and returns the lineages of the column lineageColumn keyed by the IDs of the column idColumn.
+// It returns an error if a column is missing or if an ID is present twice.
+func LoadMetadata(path, idColumn, lineageColumn string) (metadata Metadata, err error) {
+
+	var fr *os.File
+	if fr, err = os.Open(path); err != nil {
+		return
+	}
+	defer fr.Close()
+
+	r := csv.NewReader(fr)
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+
+	var header []string
+	if header, err = r.Read(); err != nil {
+		return nil, fmt.Errorf("%s : %s", path, err)
+	}
+
+	idIndex, lineageIndex := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case idColumn:
+			idIndex = i
+		case lineageColumn:
+			lineageIndex = i
+		}
+	}
+
+	if idIndex == -1 || lineageIndex == -1 {
+		return nil, fmt.Errorf("%s : missing column %s or %s in the header %v", path, idColumn, lineageColumn, header)
+	}
+
+	metadata = Metadata{}
+	for line := 2; ; line++ {
+
+		var record []string
+		if record, err = r.Read(); err == io.EOF {
+			return metadata, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s : %s", path, err)
+		}
+
+		id, lineage := strings.TrimSpace(record[idIndex]), strings.TrimSpace(record[lineageIndex])
+
+		if _, ok := metadata[id]; ok {
+			return nil, fmt.Errorf("%s line %d : duplicate sequence ID %s", path, line, id)
+		}
+
+		metadata[id] = lineage
+	}
+}
+
+// Labeler labels the training genomes given their sequence ID.
+type Labeler struct {
+	labels   *LabelSet
+	metadata Metadata
+}
+
+// NewLabeler creates a labeler of the label set. The lineage of a genome is read from the metadata,
+// or, if the metadata is nil, is the prefix of its ID up to the first '_'.
+func NewLabeler(labels *LabelSet, metadata Metadata) *Labeler {
+	return &Labeler{labels: labels, metadata: metadata}
+}
+
+// ConfiguredLabeler returns the labeler of the label set StrainsMap (read from LabelsPath if it is set)
+// and of the metadata file MetadataPath.
+func ConfiguredLabeler() (l *Labeler, err error) {
+
+	var labels *LabelSet
+	if labels, err = NewLabelSet(StrainsMap); err != nil {
+		return
+	}
+
+	var metadata Metadata
+	if MetadataPath != "" {
+		if metadata, err = LoadMetadata(MetadataPath, MetadataIDColumn, MetadataLineageColumn); err != nil {
+			return
+		}
+	}
+
+	return NewLabeler(labels, metadata), nil
+}
+
+// Labels returns the label set of the labeler.
+func (l *Labeler) Labels() *LabelSet {
+	return l.labels
+}
+
+// Lineage returns the lineage of the genome of the given FASTA ID. With metadata, the ID is looked up as is,
+// then up to its first space. It returns an error if the ID is not in the metadata.
+func (l *Labeler) Lineage(id string) (lineage string, err error) {
+
+	if l.metadata == nil {
+		return strings.SplitN(id, "_", 2)[0], nil
+	}
+
+	var ok bool
+	if lineage, ok = l.metadata[id]; !ok {
+		if fields := strings.Fields(id); len(fields) > 0 {
+			lineage, ok = l.metadata[fields[0]]
+		}
+	}
+
+	if !ok {
+		return "", fmt.Errorf("sequence %s is not in the metadata", id)
+	}
+
+	return
+}
+
+// Label returns the label of the genome of the given FASTA ID. It returns an error if the ID is not
+// in the metadata or if its lineage is not in the label set (without UnknownClass).
+func (l *Labeler) Label(id string) (label int, err error) {
+
+	var lineage string
+	if lineage, err = l.Lineage(id); err != nil {
+		return
+	}
+
+	if label, err = l.labels.Label(lineage); err != nil {
+		return 0, fmt.Errorf("sequence %s : %s", id, err)
+	}
+
+	return
+}
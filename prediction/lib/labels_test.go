@@ -0,0 +1,139 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStrains(t *testing.T) {
+
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "labels.txt")
+	if err := ioutil.WriteFile(path, []byte("P.1\nB.1.1.7\n\nunknown\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	strains, err := LoadStrains(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(strains) != 3 || strains["P.1"] != 0 || strains["B.1.1.7"] != 1 || strains["unknown"] != 2 {
+		t.Fatalf("strains %v", strains)
+	}
+
+	if err = ioutil.WriteFile(path, []byte("P.1\nB.1.1.7\nP.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = LoadStrains(path); err == nil {
+		t.Fatal("duplicate lineage accepted")
+	}
+
+	if err = ioutil.WriteFile(path, []byte("\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = LoadStrains(path); err == nil {
+		t.Fatal("empty label set accepted")
+	}
+}
+
+func TestLabelSet(t *testing.T) {
+
+	if _, err := NewLabelSet(map[string]int{"A": 0, "B": 2}); err == nil {
+		t.Fatal("labels 0 and 2 accepted")
+	}
+
+	if _, err := NewLabelSet(map[string]int{"A": 0, "B": 0}); err == nil {
+		t.Fatal("duplicate label accepted")
+	}
+
+	ls, err := NewLabelSet(map[string]int{"B.1.1.7": 1, "P.1": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := ls.Names(); names[0] != "P.1" || names[1] != "B.1.1.7" {
+		t.Fatalf("names %v", names)
+	}
+
+	if _, err = ls.Label("B.1.526"); err == nil {
+		t.Fatal("lineage outside of the set accepted without unknown class")
+	}
+
+	ls, _ = NewLabelSet(map[string]int{"B.1.1.7": 0, UnknownClass: 1})
+	if label, err := ls.Label("B.1.526"); err != nil || label != 1 {
+		t.Fatalf("lineage outside of the set labeled %d (%v) instead of the unknown class", label, err)
+	}
+
+	if _, ok := ls.Index("B.1.526"); ok {
+		t.Fatal("lineage outside of the set indexed as the unknown class")
+	}
+}
+
+func TestLabeler(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tsv := filepath.Join(dir, "metadata.tsv")
+	ioutil.WriteFile(tsv, []byte("strain\tdate\tpango_lineage\nseq1\t2021-03-01\tP.1\nseq2\t2021-03-02\tB.1.1.7\nseq3\t2021-03-03\tB.1.617.2\n"), 0644)
+
+	csv := filepath.Join(dir, "metadata.csv")
+	ioutil.WriteFile(csv, []byte("id,lineage\nseq1,P.1\nseq2,B.1.1.7\n"), 0644)
+
+	labels, _ := NewLabelSet(map[string]int{"P.1": 0, "B.1.1.7": 1})
+
+	for _, path := range []string{tsv, csv} {
+
+		idColumn, lineageColumn := "id", "lineage"
+		if path == tsv {
+			idColumn, lineageColumn = "strain", "pango_lineage"
+		}
+
+		metadata, err := LoadMetadata(path, idColumn, lineageColumn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l := NewLabeler(labels, metadata)
+
+		if label, err := l.Label("seq2 Severe acute respiratory syndrome coronavirus 2"); err != nil || label != 1 {
+			t.Fatalf("%s : seq2 labeled %d (%v)", path, label, err)
+		}
+
+		if _, err := l.Label("seq4"); err == nil {
+			t.Fatalf("%s : sequence missing from the metadata accepted", path)
+		}
+	}
+
+	metadata, _ := LoadMetadata(tsv, "strain", "pango_lineage")
+	if _, err = NewLabeler(labels, metadata).Label("seq3"); err == nil {
+		t.Fatal("lineage outside of the label set accepted")
+	}
+
+	if _, err = LoadMetadata(csv, "strain", "lineage"); err == nil {
+		t.Fatal("missing column accepted")
+	}
+
+	ioutil.WriteFile(csv, []byte("id,lineage\nseq1,P.1\nseq1,B.1.1.7\n"), 0644)
+	if _, err = LoadMetadata(csv, "id", "lineage"); err == nil {
+		t.Fatal("duplicate ID accepted")
+	}
+
+	// Without metadata, the lineage prefixes the ID
+	l := NewLabeler(labels, nil)
+	if label, err := l.Label("B.1.1.7_42"); err != nil || label != 1 {
+		t.Fatalf("B.1.1.7_42 labeled %d (%v)", label, err)
+	}
+	if _, err := l.Label("B.1.427_0"); err == nil {
+		t.Fatal("lineage outside of the label set accepted")
+	}
+}
@@ -1,5 +1,9 @@
 package lib
 
+import (
+	"runtime"
+)
+
 //Strain name map
 var StrainsMap = map[string]int{
 	"B.1.427": 0,
@@ -10,18 +14,100 @@ var StrainsMap = map[string]int{
 
 // Parameters for the training
 var NbSamplesPerStrain = 500
-var NbStrains = 4
+var NbStrains = len(StrainsMap)
 var NbSamples = NbStrains * NbSamplesPerStrain
+var QuantizationAwareTraining = true // Trains the model with the hashes and the weights quantized by HashScale and ModelScale
+
+// Labels of the training genomes (see labels.go)
+// The classes are the lineages of StrainsMap, whose labels must be 0 to NbStrains-1. If StrainsMap has an
+// "unknown" lineage, the genomes of the other lineages are labeled with it, otherwise they are an error.
+// The lineage of a genome is read from the TSV/CSV file MetadataPath, in the column MetadataLineageColumn of
+// the row of its ID in the column MetadataIDColumn (a genome missing from the file is an error), or, if
+// MetadataPath is empty, is the prefix of its FASTA ID up to the first '_'.
+// If LabelsPath is not empty, the classes are instead the lineages of this file, one per line in the order of
+// their labels (a line "unknown" adds the unknown class), which replace StrainsMap when lib is loaded. The path
+// is relative to the folder of the tool, "../prediction/model/labels.txt" works for the training and the prediction.
+var LabelsPath = ""
+var MetadataPath = ""
+var MetadataIDColumn = "id"
+var MetadataLineageColumn = "lineage"
+
+// Detection of the genomes of lineages outside of StrainsMap, predicted as "unknown" by ClientDec
+// The training calibrates a threshold on the confidence of the predictions, such that a fraction OpenSetAcceptance
+// of the calibration genomes (of known lineages, held out from the training, see trainer.Config) is above it,
+// writes it in model.json, and reports the open-set metrics of the validation genomes.
+//  OpenSetConfidence     : "max_softmax" (largest probability), "energy" (log-sum-exp of the scores) or "" to always predict a strain
+//                          (with a threshold, ClientDec adds a column to prediction.csv, see README.md)
+//  OpenSetEvaluationPath : FASTA file of genomes of lineages outside of StrainsMap, on which the training reports
+//                          the open-set metrics ("" to skip)
+var OpenSetConfidence = ""
+var OpenSetAcceptance = 0.95
+var OpenSetEvaluationPath = ""
+
+// Calibration of the probabilities of the strains written by ClientDec instead of the scores
+// The training fits, on the calibration genomes, the temperature T such that softmax(scores/T) minimizes the
+// negative log-likelihood, writes it in model.json, and reports the expected calibration error and the
+// reliability diagram (in reliability.csv) of CalibrationBins bins of the validation genomes. Set CalibrateProbabilities to false
+// for ClientDec to write the scores.
+var CalibrateProbabilities = true
+var CalibrationBins = 10
+
+// The predictor refuses to load a model without model.json, which records the feature extractor of the training.
+// Set RequireModelInfo to false to load a model trained by training/training.py, assumed to match lib.
+var RequireModelInfo = true
 
 // Client pre-processing parameters
 var HashSqrtSize = 16                      // Dimension of the hash matrix
 var HashSize = HashSqrtSize * HashSqrtSize // Number of coefficients in the hash matrix
 var Window = 6                             // Fractal Chaos Game Representation window
 
+// Feature extractor used to pre-process the genomes (see preprocessing.FeatureExtractors)
+//  "dct"        : DCTHasher, coefficients selected by CoefficientMask of the 2D DCTII of the 2^window x 2^window FCGR matrix
+//  "dct-sparse" : SparseDCTHasher, same hash as "dct" from a sparse FCGR matrix and a pruned DCTII, for windows 10 to 20
+//  "dct-v2"     : DCTHasherV2, the FCGR matrix is of size 2^(ceil(window/2)+1) x 2^(ceil(window/2)+1), window must be at least 5
+//  "fcgr"       : FCGR matrix without DCT, HashSize must be 4^window
+//  "kmer"       : k-mer frequencies, HashSize must be 4^window
+//  "minhash"    : MinHash sketch of HashSize coefficients of the set of k-mers
+var FeatureExtractor = "dct"
+
+// Coefficients of the 2D DCTII forming the hash of the "dct" and "dct-sparse" feature extractors
+//  "square"   : top left HashSqrtSize x HashSqrtSize block
+//  "zigzag"   : first HashSize coefficients in JPEG zig-zag order
+//  "triangle" : coefficients (u, v) with u + v < k, HashSize must be k(k+1)/2
+//  "file"     : HashSize coefficients read from CoefficientMaskPath (learned by the training, see training/main.go)
+// For masks other than "square", HashSize must be set to the number of coefficients.
+var CoefficientMask = "square"
+var CoefficientMaskPath = "model/coefficients.csv"
+
 var Normalizer = 1.0 / 5.0 // Applies x^(normalizer) to the coefficients of the Fractal Chaos Game Representation
 
+// Normalization of the k-mer counts c of the FCGR matrix of the "dct", "dct-sparse" and "fcgr" feature extractors
+//  "power"     : (c/max)^Normalizer, max being the count of the most frequent k-mer
+//  "frequency" : c/total, total being the number of k-mers of the genome
+//  "log1p"     : log(1+c)
+//  "clr"       : centered log-ratio log(1+c) - mean(log(1+c)), the mean being over all the 4^window k-mers
+//  "tfidf"     : c/total * idf, the inverse document frequencies of the k-mers being read from BackgroundPath
+//                (computed by the training on the training genomes, see training/main.go)
+var Normalization = "power"
+var BackgroundPath = "model/background.csv"
+
+// K-mers counted in the FCGR matrix of the "dct", "dct-sparse" and "fcgr" feature extractors
+//  "forward"   : k-mers of the forward strand
+//  "canonical" : each k-mer is counted as the smaller of itself and its reverse complement
+//  "both"      : k-mers of both strands
+// With "canonical" and "both", a genome and its reverse complement have the same hash.
+var Strand = "forward"
+
+var AmbiguityExpansion = 0 // Max. number of compatible k-mers a k-mer with IUPAC ambiguity codes is spread over (0 drops them)
+
 // Parallelization parameters
-var NbGoRoutines = 4
+var NbGoRoutines = 4                    // Number of encryptors used by the client
+var NbHashingWorkers = runtime.NumCPU() // Number of workers hashing the genomes
+
+// Server prediction parameters
+var NbPredictionWorkers = runtime.NumCPU() // Size of the worker pool evaluating the dot products
+var PredictionChunkSize = 64               // Number of hash coefficients per dot product task
+var NbBatchesPerPass = 8                   // Number of batches loaded in memory and evaluated together
 
 // Crypto parameters
 var LogN uint64 = 10
@@ -4,11 +4,13 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
 	"runtime"
-	//"sync"
+	"sync"
+
 	"github.com/ldsec/lattigo/v2/ckks"
 	"github.com/ldsec/lattigo/v2/ring"
 	"github.com/ldsec/lattigo/v2/utils"
@@ -47,8 +49,93 @@ func FileToByteBuffer(path string) (buff []byte) {
 	return
 }
 
-// MarshalBatch32 marshalles a batch of ciphertexts on a file
-func MarshalBatchSeeded32(path string, ciphertexts []*ckks.Ciphertext, seeds [][]byte) {
+// WriteFile creates the file at the given path and writes its content with write.
+func WriteFile(path string, write func(w io.Writer) error) {
+
+	fw, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+
+	if err = write(fw); err != nil {
+		panic(err)
+	}
+
+	if err = fw.Close(); err != nil {
+		panic(err)
+	}
+}
+
+// LoadHashes reads the pre-processed genomes written by ClientPro at the given path : the number of genomes
+// (uint64) followed by the HashSize coefficients (float64) of the hash of each genome, in little endian.
+func LoadHashes(path string) (hashes [][]float64) {
+
+	buff := FileToByteBuffer(path)
+
+	hashes = make([][]float64, binary.LittleEndian.Uint64(buff[:8]))
+	for i := range hashes {
+		hashes[i] = make([]float64, HashSize)
+		for j := range hashes[i] {
+			hashes[i][j] = math.Float64frombits(binary.LittleEndian.Uint64(buff[8+(i*HashSize+j)<<3:]))
+		}
+	}
+
+	return
+}
+
+// SplitRange splits [0, n) in nbParts contiguous ranges [start, end) whose sizes differ by at most one.
+func SplitRange(n, nbParts int) (ranges [][2]int) {
+	ranges = make([][2]int, nbParts)
+	start := 0
+	for i := range ranges {
+		end := start + n/nbParts
+		if i < n%nbParts {
+			end++
+		}
+		ranges[i] = [2]int{start, end}
+		start = end
+	}
+	return
+}
+
+// checkRanges returns an error if the ranges [start, end) of the seeds are not disjoint or do not cover [0, n).
+func checkRanges(ranges [][2]int, n int) error {
+
+	seed := make([]int, n)
+	for i := range seed {
+		seed[i] = -1
+	}
+
+	for i, r := range ranges {
+
+		if r[0] < 0 || r[0] > r[1] || r[1] > n {
+			return fmt.Errorf("invalid ciphertext range [%d, %d) for seed %d", r[0], r[1], i)
+		}
+
+		for j := r[0]; j < r[1]; j++ {
+			if seed[j] != -1 {
+				return fmt.Errorf("ciphertext %d in the ranges of seeds %d and %d", j, seed[j], i)
+			}
+			seed[j] = i
+		}
+	}
+
+	for j := range seed {
+		if seed[j] == -1 {
+			return fmt.Errorf("ciphertext %d in the range of no seed", j)
+		}
+	}
+
+	return nil
+}
+
+// MarshalBatchSeeded32 marshalles a batch of ciphertexts on a file
+// The i-th seed was used to sample the uniform polynomials of the ciphertexts [ranges[i][0], ranges[i][1])
+func MarshalBatchSeeded32(path string, ciphertexts []*ckks.Ciphertext, seeds [][]byte, ranges [][2]int) {
+
+	if len(seeds) != len(ranges) {
+		panic("number of seeds and number of ranges do not match")
+	}
 
 	var fw *os.File
 	var err error
@@ -74,6 +161,14 @@ func MarshalBatchSeeded32(path string, ciphertexts []*ckks.Ciphertext, seeds [][
 	binary.LittleEndian.PutUint64(buff, uint64(len(ciphertexts)))
 	fw.Write(buff)
 
+	// Range of ciphertexts encrypted by each encryptor
+	for i := range ranges {
+		binary.LittleEndian.PutUint64(buff, uint64(ranges[i][0]))
+		fw.Write(buff)
+		binary.LittleEndian.PutUint64(buff, uint64(ranges[i][1]))
+		fw.Write(buff)
+	}
+
 	// Seeds used by the encryptors to sample the uniform polynomials
 	// Will be used by the server to reconstruct the second part of the ciphertexts
 	for i := 0; i < len(seeds); i++ {
@@ -112,6 +207,18 @@ func UnmarshalBatchSeeded32(path string) (ciphertexts []*ckks.Ciphertext) {
 	fr.Read(buff)
 	nbrCiphertexts := int(binary.LittleEndian.Uint64(buff))
 
+	ranges := make([][2]int, nbrSeeds)
+	for i := range ranges {
+		fr.Read(buff)
+		ranges[i][0] = int(binary.LittleEndian.Uint64(buff))
+		fr.Read(buff)
+		ranges[i][1] = int(binary.LittleEndian.Uint64(buff))
+	}
+
+	if err = checkRanges(ranges, nbrCiphertexts); err != nil {
+		panic(err)
+	}
+
 	buff = make([]byte, 64)
 	seeds := make([][]byte, nbrSeeds)
 	for i := range seeds {
@@ -139,27 +246,28 @@ func UnmarshalBatchSeeded32(path string) (ciphertexts []*ckks.Ciphertext) {
 		panic(err)
 	}
 
-	//var wg sync.WaitGroup
-	//wg.Add(nbrSeeds)
+	// Each seed expands independently the polynomials of its range
+	var wg sync.WaitGroup
+	wg.Add(nbrSeeds)
 	for i := 0; i < nbrSeeds; i++ {
 
-		//go func(start int, seed []byte) {
+		go func(seed []byte, start, end int) {
 
-		prng, err := utils.NewKeyedPRNG(seeds[i])
-		if err != nil {
-			panic(err)
-		}
+			prng, err := utils.NewKeyedPRNG(seed)
+			if err != nil {
+				panic(err)
+			}
 
-		crpGen := ring.NewUniformSampler(prng, ringQ)
+			crpGen := ring.NewUniformSampler(prng, ringQ)
 
-		for j := 0; j < nbrCiphertexts/nbrSeeds; j++ {
-			ciphertexts[j+i*nbrCiphertexts/nbrSeeds].Value()[1] = crpGen.ReadNew()
-		}
+			for j := start; j < end; j++ {
+				ciphertexts[j].Value()[1] = crpGen.ReadNew()
+			}
 
-		//wg.Done()
-		//}(i, seeds[i])
+			wg.Done()
+		}(seeds[i], ranges[i][0], ranges[i][1])
 	}
-	//wg.Wait()
+	wg.Wait()
 
 	return
 }
@@ -0,0 +1,26 @@
+package lib
+
+import (
+	"testing"
+)
+
+func TestCheckRanges(t *testing.T) {
+
+	for _, nbParts := range []int{1, 3, 7} {
+		if err := checkRanges(SplitRange(20, nbParts), 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, ranges := range [][][2]int{
+		{{0, 10}, {5, 20}},  // Overlapping
+		{{0, 10}, {11, 20}}, // Gap
+		{{0, 10}},           // Not covering
+		{{10, 5}, {0, 20}},  // Empty and reversed
+		{{0, 21}},           // Out of bounds
+	} {
+		if err := checkRanges(ranges, 20); err == nil {
+			t.Fatalf("ranges %v accepted", ranges)
+		}
+	}
+}
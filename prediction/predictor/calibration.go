@@ -0,0 +1,93 @@
+package predictor
+
+import (
+	"fmt"
+	"math"
+)
+
+// Bounds of the temperature fitted by FitTemperature
+const (
+	MinTemperature = 1e-2
+	MaxTemperature = 1e3
+)
+
+// Calibration maps the decrypted scores of a genome to calibrated probabilities of the strains
+// by temperature scaling : the probabilities are the softmax of the scores divided by Temperature.
+// Temperature scaling does not change the predicted strain.
+type Calibration struct {
+	Temperature float64 `json:"temperature"`
+}
+
+// FitTemperature returns the calibration whose temperature minimizes the negative log-likelihood of the labels
+// given the scores, which are the scores of genomes held out of the training.
+func FitTemperature(scores [][]float64, labels []int) (*Calibration, error) {
+
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no genome to fit the temperature")
+	}
+
+	if len(scores) != len(labels) {
+		return nil, fmt.Errorf("%d scores but %d labels", len(scores), len(labels))
+	}
+
+	for i := range labels {
+		if labels[i] < 0 || labels[i] >= len(scores[i]) {
+			return nil, fmt.Errorf("label %d of genome %d is not a strain", labels[i], i)
+		}
+	}
+
+	// The negative log-likelihood is convex in 1/T, so it is unimodal in log(T) : golden-section search
+	nll := func(logT float64) float64 {
+		return NegativeLogLikelihood(scores, labels, math.Exp(logT))
+	}
+
+	phi := (math.Sqrt(5) - 1) / 2
+
+	a, b := math.Log(MinTemperature), math.Log(MaxTemperature)
+	c, d := b-phi*(b-a), a+phi*(b-a)
+	fc, fd := nll(c), nll(d)
+
+	for b-a > 1e-6 {
+		if fc < fd {
+			b, d, fd = d, c, fc
+			c = b - phi*(b-a)
+			fc = nll(c)
+		} else {
+			a, c, fc = c, d, fd
+			d = a + phi*(b-a)
+			fd = nll(d)
+		}
+	}
+
+	return &Calibration{Temperature: math.Exp((a + b) / 2)}, nil
+}
+
+// NegativeLogLikelihood returns the mean negative log-likelihood of the labels given the softmax
+// of the scores divided by the temperature.
+func NegativeLogLikelihood(scores [][]float64, labels []int, temperature float64) (nll float64) {
+
+	for i := range scores {
+
+		max := math.Inf(-1)
+		for _, s := range scores[i] {
+			max = math.Max(max, s/temperature)
+		}
+
+		var sum float64
+		for _, s := range scores[i] {
+			sum += math.Exp(s/temperature - max)
+		}
+
+		nll += max + math.Log(sum) - scores[i][labels[i]]/temperature
+	}
+
+	return nll / float64(len(scores))
+}
+
+// Probabilities writes in probs the calibrated probabilities of the strains given their scores.
+func (c *Calibration) Probabilities(scores, probs []float64) {
+	for i := range scores {
+		probs[i] = scores[i] / c.Temperature
+	}
+	SoftMax(probs)
+}
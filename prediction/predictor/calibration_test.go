@@ -0,0 +1,83 @@
+package predictor
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFitTemperature(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	// Labels drawn from the softmax of the scores divided by 2.5 : the scores are over-confident
+	temperature := 2.5
+
+	scores := make([][]float64, 5000)
+	labels := make([]int, len(scores))
+	probs := make([]float64, 4)
+	for i := range scores {
+
+		scores[i] = make([]float64, 4)
+		for j := range scores[i] {
+			scores[i][j] = prng.NormFloat64() * 5
+			probs[j] = scores[i][j] / temperature
+		}
+
+		SoftMax(probs)
+
+		u := prng.Float64()
+		for labels[i] = 0; labels[i] < len(probs)-1 && u >= probs[labels[i]]; labels[i]++ {
+			u -= probs[labels[i]]
+		}
+	}
+
+	calibration, err := FitTemperature(scores, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(calibration.Temperature-temperature) > 0.25 {
+		t.Fatalf("temperature %f, expected %f", calibration.Temperature, temperature)
+	}
+
+	if NegativeLogLikelihood(scores, labels, calibration.Temperature) > NegativeLogLikelihood(scores, labels, 1) {
+		t.Fatal("the calibration increases the negative log-likelihood")
+	}
+
+	for _, s := range scores[:100] {
+
+		calibration.Probabilities(s, probs)
+
+		var sum float64
+		for _, p := range probs {
+			sum += p
+		}
+
+		if math.Abs(sum-1) > 1e-12 {
+			t.Fatalf("probabilities summing to %f", sum)
+		}
+
+		if MaxIndex(probs) != MaxIndex(s) {
+			t.Fatal("the calibration changes the prediction")
+		}
+	}
+
+	if _, err = FitTemperature(scores, labels[1:]); err == nil {
+		t.Fatal("scores and labels of different lengths accepted")
+	}
+
+	if _, err = FitTemperature(nil, nil); err == nil {
+		t.Fatal("empty calibration set accepted")
+	}
+}
+
+func TestSoftMaxNegativeScores(t *testing.T) {
+
+	vec := []float64{-1000, -1001}
+	SoftMax(vec)
+
+	if math.IsNaN(vec[0]) || math.Abs(vec[0]+vec[1]-1) > 1e-12 {
+		t.Fatalf("softmax %v", vec)
+	}
+}
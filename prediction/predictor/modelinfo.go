@@ -0,0 +1,37 @@
+package predictor
+
+import (
+	"encoding/json"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"io/ioutil"
+)
+
+// ModelInfoFile is the file, in the model folder, describing how the model was trained.
+const ModelInfoFile = "model.json"
+
+// ModelInfo describes how a model was trained.
+type ModelInfo struct {
+	Extractor   lib.ExtractorInfo `json:"extractor"`             // Feature extractor of the training samples
+	Training    json.RawMessage   `json:"training,omitempty"`    // Hyper-parameters and metrics of the training (see training/trainer)
+	OpenSet     *OpenSet          `json:"open_set,omitempty"`    // Detection of the genomes of unknown lineages, nil to always predict a strain
+	Calibration *Calibration      `json:"calibration,omitempty"` // Calibration of the probabilities of the strains, nil to output the scores
+}
+
+// LoadModelInfo reads the model description at the given path.
+func LoadModelInfo(path string) (info ModelInfo, err error) {
+	var buff []byte
+	if buff, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	err = json.Unmarshal(buff, &info)
+	return
+}
+
+// Save writes the model description at the given path.
+func (info ModelInfo) Save(path string) (err error) {
+	var buff []byte
+	if buff, err = json.MarshalIndent(info, "", "\t"); err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, append(buff, '\n'), 0644)
+}
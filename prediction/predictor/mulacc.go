@@ -0,0 +1,51 @@
+package predictor
+
+import (
+	"unsafe"
+)
+
+// mulAcc computes y[i] += x[i] * w (mod 2^64) for i < len(y).
+// It is set at init time to the fastest implementation supported by the CPU
+// and falls back to mulAccGeneric otherwise.
+var mulAcc = mulAccGeneric
+
+// mulAccImplementation names the implementation selected for mulAcc.
+var mulAccImplementation = "generic"
+
+// mulAccImplementations lists the implementations supported by the CPU.
+var mulAccImplementations = map[string]func(y, x []uint64, w uint64){
+	"generic": mulAccGeneric,
+}
+
+// MulAccImplementation returns the name of the multiply-accumulate
+// implementation used by DotProduct ("generic", "avx2", "avx512" or "neon").
+func MulAccImplementation() string {
+	return mulAccImplementation
+}
+
+// mulAccGeneric is the pure Go multiply-accumulate, unrolled by 8.
+func mulAccGeneric(y, x []uint64, w uint64) {
+
+	n := len(y) &^ 7
+
+	x = x[:len(y)]
+
+	for j := 0; j < n; j = j + 8 {
+
+		a := (*[8]uint64)(unsafe.Pointer(&x[j]))
+		b := (*[8]uint64)(unsafe.Pointer(&y[j]))
+
+		b[0] += a[0] * w
+		b[1] += a[1] * w
+		b[2] += a[2] * w
+		b[3] += a[3] * w
+		b[4] += a[4] * w
+		b[5] += a[5] * w
+		b[6] += a[6] * w
+		b[7] += a[7] * w
+	}
+
+	for j := n; j < len(y); j++ {
+		y[j] += x[j] * w
+	}
+}
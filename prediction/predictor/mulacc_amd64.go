@@ -0,0 +1,49 @@
+package predictor
+
+import (
+	"golang.org/x/sys/cpu"
+)
+
+// mulAccAVX2 computes y[i] += x[i] * w for i < len(y)&^7.
+// AVX2 has no 64-bit low multiplication, so it is emulated with three
+// 32x32->64 multiplications.
+//
+//go:noescape
+func mulAccAVX2(y, x []uint64, w uint64)
+
+// mulAccAVX512 computes y[i] += x[i] * w for i < len(y)&^15 using VPMULLQ.
+//
+//go:noescape
+func mulAccAVX512(y, x []uint64, w uint64)
+
+func init() {
+	if cpu.X86.HasAVX2 {
+		mulAccImplementations["avx2"] = mulAccWithAVX2
+		mulAcc = mulAccWithAVX2
+		mulAccImplementation = "avx2"
+	}
+
+	if cpu.X86.HasAVX512F && cpu.X86.HasAVX512DQ {
+		mulAccImplementations["avx512"] = mulAccWithAVX512
+		mulAcc = mulAccWithAVX512
+		mulAccImplementation = "avx512"
+	}
+}
+
+func mulAccWithAVX2(y, x []uint64, w uint64) {
+	x = x[:len(y)]
+	n := len(y) &^ 7
+	mulAccAVX2(y[:n], x[:n], w)
+	if n != len(y) {
+		mulAccGeneric(y[n:], x[n:], w)
+	}
+}
+
+func mulAccWithAVX512(y, x []uint64, w uint64) {
+	x = x[:len(y)]
+	n := len(y) &^ 15
+	mulAccAVX512(y[:n], x[:n], w)
+	if n != len(y) {
+		mulAccGeneric(y[n:], x[n:], w)
+	}
+}
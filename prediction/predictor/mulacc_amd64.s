@@ -0,0 +1,83 @@
+#include "textflag.h"
+
+// func mulAccAVX2(y, x []uint64, w uint64)
+// Processes 8 coefficients per iteration, len(y) must be a multiple of 8.
+//
+// x*w mod 2^64 = lo(x)*lo(w) + ((hi(x)*lo(w) + lo(x)*hi(w)) << 32)
+TEXT ·mulAccAVX2(SB), NOSPLIT, $0-56
+	MOVQ y_base+0(FP), DI
+	MOVQ y_len+8(FP), CX
+	MOVQ x_base+24(FP), SI
+	VPBROADCASTQ w+48(FP), Y14
+	VPSRLQ $32, Y14, Y15
+	SHRQ $3, CX
+	JZ avx2_done
+
+avx2_loop:
+	VMOVDQU (SI), Y0
+	VMOVDQU 32(SI), Y1
+
+	// hi(x)*lo(w)
+	VPSRLQ $32, Y0, Y2
+	VPSRLQ $32, Y1, Y3
+	VPMULUDQ Y14, Y2, Y2
+	VPMULUDQ Y14, Y3, Y3
+
+	// lo(x)*hi(w)
+	VPMULUDQ Y15, Y0, Y4
+	VPMULUDQ Y15, Y1, Y5
+
+	VPADDQ Y4, Y2, Y2
+	VPADDQ Y5, Y3, Y3
+	VPSLLQ $32, Y2, Y2
+	VPSLLQ $32, Y3, Y3
+
+	// lo(x)*lo(w)
+	VPMULUDQ Y14, Y0, Y0
+	VPMULUDQ Y14, Y1, Y1
+
+	VPADDQ Y2, Y0, Y0
+	VPADDQ Y3, Y1, Y1
+
+	VPADDQ (DI), Y0, Y0
+	VPADDQ 32(DI), Y1, Y1
+	VMOVDQU Y0, (DI)
+	VMOVDQU Y1, 32(DI)
+
+	ADDQ $64, SI
+	ADDQ $64, DI
+	DECQ CX
+	JNZ avx2_loop
+
+avx2_done:
+	VZEROUPPER
+	RET
+
+// func mulAccAVX512(y, x []uint64, w uint64)
+// Processes 16 coefficients per iteration, len(y) must be a multiple of 16.
+TEXT ·mulAccAVX512(SB), NOSPLIT, $0-56
+	MOVQ y_base+0(FP), DI
+	MOVQ y_len+8(FP), CX
+	MOVQ x_base+24(FP), SI
+	VPBROADCASTQ w+48(FP), Z15
+	SHRQ $4, CX
+	JZ avx512_done
+
+avx512_loop:
+	VMOVDQU64 (SI), Z0
+	VMOVDQU64 64(SI), Z1
+	VPMULLQ Z15, Z0, Z0
+	VPMULLQ Z15, Z1, Z1
+	VPADDQ (DI), Z0, Z0
+	VPADDQ 64(DI), Z1, Z1
+	VMOVDQU64 Z0, (DI)
+	VMOVDQU64 Z1, 64(DI)
+
+	ADDQ $128, SI
+	ADDQ $128, DI
+	DECQ CX
+	JNZ avx512_loop
+
+avx512_done:
+	VZEROUPPER
+	RET
@@ -0,0 +1,24 @@
+package predictor
+
+// mulAccNEON computes y[i] += x[i] * w for i < len(y)&^3.
+// NEON has no 64-bit multiplication, so it is emulated with one 32x32->64
+// and two 32x32->32 multiplications.
+//
+//go:noescape
+func mulAccNEON(y, x []uint64, w uint64)
+
+// NEON is mandatory on arm64.
+func init() {
+	mulAccImplementations["neon"] = mulAccWithNEON
+	mulAcc = mulAccWithNEON
+	mulAccImplementation = "neon"
+}
+
+func mulAccWithNEON(y, x []uint64, w uint64) {
+	x = x[:len(y)]
+	n := len(y) &^ 3
+	mulAccNEON(y[:n], x[:n], w)
+	if n != len(y) {
+		mulAccGeneric(y[n:], x[n:], w)
+	}
+}
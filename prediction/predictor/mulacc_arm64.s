@@ -0,0 +1,52 @@
+#include "textflag.h"
+
+// func mulAccNEON(y, x []uint64, w uint64)
+// Processes 4 coefficients per iteration, len(y) must be a multiple of 4.
+//
+// x*w mod 2^64 = lo(x)*lo(w) + ((hi(x)*lo(w) + lo(x)*hi(w)) << 32)
+TEXT ·mulAccNEON(SB), NOSPLIT, $0-56
+	MOVD y_base+0(FP), R0
+	MOVD y_len+8(FP), R2
+	MOVD x_base+24(FP), R1
+	MOVD w+48(FP), R3
+	LSR  $32, R3, R4
+	VDUP R3, V30.S4
+	VDUP R4, V31.S4
+	LSR  $2, R2, R2
+	CBZ  R2, neon_done
+
+neon_loop:
+	VLD1.P 32(R1), [V0.D2, V1.D2]
+	VLD1   (R0), [V2.D2, V3.D2]
+
+	// lo(x) and hi(x)
+	VXTN  V0.D2, V4.S2
+	VXTN  V1.D2, V5.S2
+	VSHRN $32, V0.D2, V6.S2
+	VSHRN $32, V1.D2, V7.S2
+
+	// hi(x)*lo(w) + lo(x)*hi(w) mod 2^32
+	VMUL V30.S2, V6.S2, V6.S2
+	VMUL V30.S2, V7.S2, V7.S2
+	VMLA V31.S2, V4.S2, V6.S2
+	VMLA V31.S2, V5.S2, V7.S2
+
+	// y += lo(x)*lo(w)
+	VUMLAL V30.S2, V4.S2, V2.D2
+	VUMLAL V30.S2, V5.S2, V3.D2
+
+	// y += (hi(x)*lo(w) + lo(x)*hi(w)) << 32
+	VUSHLL $0, V6.S2, V6.D2
+	VUSHLL $0, V7.S2, V7.D2
+	VSHL   $32, V6.D2, V6.D2
+	VSHL   $32, V7.D2, V7.D2
+	VADD   V6.D2, V2.D2, V2.D2
+	VADD   V7.D2, V3.D2, V3.D2
+
+	VST1.P [V2.D2, V3.D2], 32(R0)
+
+	SUB  $1, R2, R2
+	CBNZ R2, neon_loop
+
+neon_done:
+	RET
@@ -0,0 +1,148 @@
+package predictor
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/ring"
+)
+
+func TestMulAcc(t *testing.T) {
+
+	for name, mulAccImpl := range mulAccImplementations {
+
+		// Lengths that are not multiples of the vector width exercise the scalar tail
+		for _, n := range []int{1, 7, 8, 15, 16, 17, 1024, 1029} {
+
+			t.Run(fmt.Sprintf("%s/N=%d", name, n), func(t *testing.T) {
+
+				x := make([]uint64, n)
+				y0 := make([]uint64, n)
+				y1 := make([]uint64, n)
+				for i := range x {
+					x[i] = rand.Uint64()
+					y0[i] = rand.Uint64()
+					y1[i] = y0[i]
+				}
+
+				w := rand.Uint64()
+
+				for i := range y0 {
+					y0[i] += x[i] * w
+				}
+
+				mulAccImpl(y1, x, w)
+
+				for i := range y0 {
+					if y0[i] != y1[i] {
+						t.Fatalf("coefficient %d: have %d, want %d", i, y1[i], y0[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMulAcc(b *testing.B) {
+
+	for logN := 10; logN <= 14; logN++ {
+
+		n := 1 << logN
+
+		x := make([]uint64, n)
+		y := make([]uint64, n)
+		for i := range x {
+			x[i] = rand.Uint64()
+		}
+
+		w := rand.Uint64()
+
+		for name, mulAccImpl := range mulAccImplementations {
+			b.Run(fmt.Sprintf("%s/N=%d", name, n), func(b *testing.B) {
+				b.SetBytes(int64(n << 3))
+				for i := 0; i < b.N; i++ {
+					mulAccImpl(y, x, w)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDotProduct(b *testing.B) {
+
+	// Number of distinct ciphertexts, the inputs cycle over them
+	// to keep the memory footprint of the benchmark reasonable
+	nbDistinct := 64
+
+	for logN := uint64(10); logN <= 14; logN++ {
+
+		// lib.Q is only NTT friendly up to N=2^10, so a modulus of the same size is generated
+		Q := ring.GenerateNTTPrimes(29, 2<<logN, 1)
+
+		params, err := ckks.NewParametersFromModuli(logN, &ckks.Moduli{Qi: Q, Pi: []uint64{}})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		prng := rand.New(rand.NewSource(0))
+
+		distinct := make([]*ckks.Ciphertext, nbDistinct)
+		for i := range distinct {
+			distinct[i] = ckks.NewCiphertext(params, 1, 0, lib.HashScale)
+			for _, pol := range distinct[i].Value() {
+				for j := range pol.Coeffs[0] {
+					pol.Coeffs[0][j] = prng.Uint64() % Q[0]
+				}
+			}
+		}
+
+		for nbInputs := 256; nbInputs <= 4096; nbInputs <<= 1 {
+
+			p := newBenchmarkPredictor(params, nbInputs, prng)
+
+			input := make([]*ckks.Ciphertext, nbInputs)
+			for i := range input {
+				input[i] = distinct[i%nbDistinct]
+			}
+
+			res := ckks.NewCiphertext(params, 1, 0, lib.HashScale*lib.ModelScale)
+
+			for name, mulAccImpl := range mulAccImplementations {
+				b.Run(fmt.Sprintf("%s/N=%d/inputs=%d", name, params.N(), nbInputs), func(b *testing.B) {
+					mulAcc = mulAccImpl
+					for i := 0; i < b.N; i++ {
+						p.DotProduct(input, 0, res)
+					}
+				})
+			}
+		}
+	}
+
+	mulAcc = mulAccImplementations[mulAccImplementation]
+}
+
+// newBenchmarkPredictor returns a predictor with a random model of nbInputs coefficients.
+func newBenchmarkPredictor(params *ckks.Parameters, nbInputs int, prng *rand.Rand) (p *Predictor) {
+
+	p = NewPredictor(params)
+
+	Q := p.baseRing.Modulus[0]
+	bredParams := p.baseRing.GetBredParams()[0]
+
+	p.model = new(Model)
+	p.model.weightsScaledMontgomery = make([][]uint64, lib.NbStrains)
+	p.model.biasScaled = make([]*ring.Poly, lib.NbStrains)
+	for i := range p.model.weightsScaledMontgomery {
+		tmp := make([]uint64, nbInputs)
+		for j := range tmp {
+			tmp[j] = ring.MForm(prng.Uint64()%Q, Q, bredParams)
+		}
+		p.model.weightsScaledMontgomery[i] = tmp
+		p.model.biasScaled[i] = p.baseRing.NewPoly()
+	}
+
+	return
+}
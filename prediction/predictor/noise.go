@@ -0,0 +1,163 @@
+package predictor
+
+import (
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"math"
+	"strings"
+)
+
+// The client encrypts each coefficient of the hashes, scaled by HashScale, with an error e sampled by the
+// Gaussian sampler of lattigo : |e| = floor(Sigma * |x|) for a standard normal x, resampled above SigmaBound,
+// with a random sign. The predictor multiplies the ciphertext of the j-th coefficient by the integer
+// w_q[j] = round(w[j] * ModelScale) and adds the bias as a plaintext, so the error of the result is
+// sum_j w_q[j] * e_j, of variance Var(e) * ||w_q||^2, and the decrypted score, scaled by HashScale * ModelScale,
+// is the quantized score plus a noise of variance Var(e) * ||w_q||^2 / (HashScale * ModelScale)^2.
+
+// ErrorVariance returns the variance of a coefficient of the encryption error sampled with the given standard
+// deviation and bound.
+func ErrorVariance(sigma float64, bound uint64) float64 {
+
+	// P(|e| = k) is proportional to P(k <= sigma * |x| < k+1) = 2 * (Phi((k+1)/sigma) - Phi(k/sigma))
+	var variance, total float64
+	for k := uint64(0); k <= bound; k++ {
+		p := math.Erf(float64(k+1)/(sigma*math.Sqrt2)) - math.Erf(float64(k)/(sigma*math.Sqrt2))
+		variance += float64(k*k) * p
+		total += p
+	}
+
+	return variance / total
+}
+
+// NoiseEstimate is the analytical estimate of the encryption noise of the decrypted scores of a prediction.
+type NoiseEstimate struct {
+	ErrorVariance float64   `json:"error_variance"` // Variance of a coefficient of the encryption error of a hash ciphertext
+	Variances     []float64 `json:"variances"`      // Variance of the noise of the decrypted score of each strain
+	MaxStd        float64   `json:"max_std"`        // Largest standard deviation of the noise of a score
+	Bits          float64   `json:"bits"`           // Bits of precision of the scores, -log2(MaxStd)
+	LostBits      float64   `json:"lost_bits"`      // Bits of the quantized scores, of resolution 1/(HashScale*ModelScale), lost to the noise
+	MaxScore      float64   `json:"max_score"`      // Largest absolute score decrypted without wrapping modulo Q, up to 6 standard deviations of the noise
+}
+
+// EstimateNoise returns the estimate of the noise of the scores of a model whose weights of each strain have the
+// given L2 norms, for hashes of hashSize coefficients. The weights are assumed to be rounded to multiples of
+// 1/modelScale with a uniform rounding error, which adds hashSize/12 to the squared norm of the quantized weights.
+func EstimateNoise(params *ckks.Parameters, hashScale, modelScale float64, weightNorms []float64, hashSize int) NoiseEstimate {
+
+	quantizedNorms := make([]float64, len(weightNorms))
+	for i, norm := range weightNorms {
+		quantizedNorms[i] = norm*norm*modelScale*modelScale + float64(hashSize)/12
+	}
+
+	return newNoiseEstimate(params, hashScale*modelScale, quantizedNorms)
+}
+
+// EstimateNoise returns the estimate of the noise of the scores of the model, computed with the exact norms
+// of its quantized weights.
+func (p *Predictor) EstimateNoise() NoiseEstimate {
+
+	quantizedNorms := make([]float64, len(p.model.weights))
+	for i, w := range p.model.weights {
+		for j := range w {
+			wq := Quantize(w[j], lib.ModelScale)
+			quantizedNorms[i] += wq * wq
+		}
+	}
+
+	return newNoiseEstimate(p.params, lib.HashScale*lib.ModelScale, quantizedNorms)
+}
+
+// WeightNorms returns the L2 norm of the weights of each strain.
+func (p *Predictor) WeightNorms() (norms []float64) {
+	norms = make([]float64, len(p.model.weights))
+	for i, w := range p.model.weights {
+		for j := range w {
+			norms[i] += w[j] * w[j]
+		}
+		norms[i] = math.Sqrt(norms[i])
+	}
+	return
+}
+
+// newNoiseEstimate returns the estimate of the noise of the scores of resolution 1/scale, given the squared
+// norms of the quantized weights of each strain.
+func newNoiseEstimate(params *ckks.Parameters, scale float64, quantizedNorms []float64) (e NoiseEstimate) {
+
+	e.ErrorVariance = ErrorVariance(lib.Sigma, lib.SigmaBound)
+
+	e.Variances = make([]float64, len(quantizedNorms))
+	for i, norm := range quantizedNorms {
+		e.Variances[i] = e.ErrorVariance * norm / (scale * scale)
+		e.MaxStd = math.Max(e.MaxStd, math.Sqrt(e.Variances[i]))
+	}
+
+	e.Bits = -math.Log2(e.MaxStd)
+	e.LostBits = math.Max(0, math.Log2(e.MaxStd*scale))
+
+	var Q float64 = 1
+	for _, qi := range params.Qi() {
+		Q *= float64(qi)
+	}
+
+	e.MaxScore = Q/(2*scale) - 6*e.MaxStd
+
+	return
+}
+
+func (e NoiseEstimate) String() string {
+	return fmt.Sprintf("Estimated noise : max. std %.3e, precision %.2f bits (%.2f bits lost), max. absolute score %.1f",
+		e.MaxStd, e.Bits, e.LostBits, e.MaxScore)
+}
+
+// NoiseMeasurement is the noise of decrypted scores measured against the quantized scores.
+type NoiseMeasurement struct {
+	Samples   int       `json:"samples"`
+	Variances []float64 `json:"variances"` // Mean squared noise of the score of each strain
+	MaxStd    float64   `json:"max_std"`   // Largest root mean squared noise of a score
+	MaxError  float64   `json:"max_error"` // Largest absolute noise of a score
+	Bits      float64   `json:"bits"`      // Bits of precision of the scores, -log2(MaxStd)
+}
+
+// MeasureNoise returns the noise of the decrypted scores, which is their difference with the quantized scores.
+func MeasureNoise(quantized, decrypted [][]float64) (m NoiseMeasurement) {
+
+	m.Samples = len(quantized)
+	if m.Samples == 0 {
+		return
+	}
+
+	m.Variances = make([]float64, len(quantized[0]))
+	for i := range quantized {
+		for c := range quantized[i] {
+			noise := decrypted[i][c] - quantized[i][c]
+			m.Variances[c] += noise * noise
+			m.MaxError = math.Max(m.MaxError, math.Abs(noise))
+		}
+	}
+
+	for c := range m.Variances {
+		m.Variances[c] /= float64(m.Samples)
+		m.MaxStd = math.Max(m.MaxStd, math.Sqrt(m.Variances[c]))
+	}
+
+	m.Bits = -math.Log2(m.MaxStd)
+
+	return
+}
+
+// CompareNoise returns, as text, the estimated and measured standard deviations of the noise of each strain.
+func CompareNoise(e NoiseEstimate, m NoiseMeasurement, strains []string) string {
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%-10s %12s %12s %8s\n", "strain", "estimated", "measured", "ratio")
+	for c := range e.Variances {
+		estimated, measured := math.Sqrt(e.Variances[c]), math.Sqrt(m.Variances[c])
+		fmt.Fprintf(&sb, "%-10s %12.3e %12.3e %8.3f\n", strains[c], estimated, measured, measured/estimated)
+	}
+
+	fmt.Fprintf(&sb, "Precision : estimated %.2f bits, measured %.2f bits on %d genomes (max. error %.3e)", e.Bits, m.Bits, m.Samples, m.MaxError)
+
+	return sb.String()
+}
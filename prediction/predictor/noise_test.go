@@ -0,0 +1,99 @@
+package predictor
+
+import (
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/ring"
+	"github.com/ldsec/lattigo/v2/utils"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestErrorVariance(t *testing.T) {
+
+	ringQ, err := ring.NewRing(1<<lib.LogN, lib.Q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prng, err := utils.NewKeyedPRNG([]byte{'n', 'o', 'i', 's', 'e'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sampler := ring.NewGaussianSampler(prng, ringQ, lib.Sigma, lib.SigmaBound)
+
+	Q := lib.Q[0]
+	pol := ringQ.NewPoly()
+
+	var variance float64
+	var n int
+	for i := 0; i < 100; i++ {
+		sampler.Read(pol)
+		for _, c := range pol.Coeffs[0] {
+			e := float64(c)
+			if c > Q>>1 {
+				e -= float64(Q)
+			}
+			variance += e * e
+			n++
+		}
+	}
+	variance /= float64(n)
+
+	if estimate := ErrorVariance(lib.Sigma, lib.SigmaBound); math.Abs(variance-estimate) > 0.02*estimate {
+		t.Fatalf("error variance %f, estimated %f", variance, estimate)
+	}
+}
+
+func TestEstimateNoise(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(1))
+
+	p := newTestPredictor(t, prng)
+
+	hashes := make([][]float64, 1<<lib.LogN)
+	for i := range hashes {
+		hashes[i] = make([]float64, lib.HashSize)
+		for j := range hashes[i] {
+			hashes[i][j] = prng.Float64() - 0.5
+		}
+	}
+
+	encrypted := p.PredictEncrypted(hashes)
+
+	quantized := make([][]float64, len(hashes))
+	for i := range hashes {
+		quantized[i] = make([]float64, lib.NbStrains)
+		p.PredictQuantized(hashes[i], quantized[i])
+	}
+
+	measurement := MeasureNoise(quantized, encrypted)
+	estimate := p.EstimateNoise()
+
+	// 1024 samples per strain : the measured variance is within a few percent of the estimate
+	for c := range estimate.Variances {
+		if ratio := measurement.Variances[c] / estimate.Variances[c]; ratio < 0.85 || ratio > 1.15 {
+			t.Fatalf("strain %d : measured variance %e, estimated %e", c, measurement.Variances[c], estimate.Variances[c])
+		}
+	}
+
+	if math.Abs(measurement.Bits-estimate.Bits) > 0.2 {
+		t.Fatalf("measured precision %f bits, estimated %f bits", measurement.Bits, estimate.Bits)
+	}
+
+	// The random weights are not multiples of 1/ModelScale : their rounding error is close to uniform
+	params, _ := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	analytical := EstimateNoise(params, lib.HashScale, lib.ModelScale, p.WeightNorms(), lib.HashSize)
+
+	for c := range estimate.Variances {
+		if ratio := analytical.Variances[c] / estimate.Variances[c]; ratio < 0.95 || ratio > 1.05 {
+			t.Fatalf("strain %d : variance %e estimated from the weight norms, %e from the quantized weights", c, analytical.Variances[c], estimate.Variances[c])
+		}
+	}
+
+	if analytical.MaxScore < 1000 || analytical.LostBits <= 0 {
+		t.Fatalf("%s", analytical)
+	}
+}
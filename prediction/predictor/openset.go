@@ -0,0 +1,85 @@
+package predictor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// UnknownStrain is the prediction of a genome of a lineage that is not one of the strains of the model.
+const UnknownStrain = "unknown"
+
+// Confidences of a prediction, computed from the scores of the strains, used to detect genomes of unknown lineages
+const (
+	ConfidenceMaxSoftmax = "max_softmax" // Largest probability of the softmax of the scores
+	ConfidenceEnergy     = "energy"      // log(sum(exp(scores))), the opposite of the energy of the scores
+)
+
+// OpenSet detects the genomes of unknown lineages : a genome whose prediction has a confidence below the
+// threshold is predicted as UnknownStrain. The threshold is calibrated on genomes of known lineages such
+// that a fraction Acceptance of them is accepted.
+type OpenSet struct {
+	Confidence string  `json:"confidence"`
+	Threshold  float64 `json:"threshold"`
+	Acceptance float64 `json:"acceptance"`
+}
+
+// Confidence returns the confidence of the prediction of the given scores.
+func Confidence(confidence string, scores []float64) float64 {
+
+	max := math.Inf(-1)
+	for _, s := range scores {
+		max = math.Max(max, s)
+	}
+
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - max)
+	}
+
+	switch confidence {
+	case ConfidenceMaxSoftmax:
+		return 1 / sum
+	case ConfidenceEnergy:
+		return max + math.Log(sum)
+	default:
+		panic(fmt.Errorf("unknown confidence %s", confidence))
+	}
+}
+
+// CalibrateOpenSet returns the open set whose threshold accepts (at least) the given fraction of the predictions
+// of the scores, which are the scores of genomes of known lineages held out of the training.
+func CalibrateOpenSet(confidence string, scores [][]float64, acceptance float64) (*OpenSet, error) {
+
+	if confidence != ConfidenceMaxSoftmax && confidence != ConfidenceEnergy {
+		return nil, fmt.Errorf("unknown confidence %s", confidence)
+	}
+
+	if acceptance <= 0 || acceptance > 1 {
+		return nil, fmt.Errorf("acceptance must be in (0, 1]")
+	}
+
+	if len(scores) == 0 {
+		return nil, fmt.Errorf("no genome to calibrate the threshold")
+	}
+
+	confidences := make([]float64, len(scores))
+	for i := range scores {
+		confidences[i] = Confidence(confidence, scores[i])
+	}
+
+	sort.Float64s(confidences)
+
+	// The smallest confidences are rejected
+	rejected := len(confidences) - int(math.Ceil(acceptance*float64(len(confidences))))
+
+	return &OpenSet{Confidence: confidence, Threshold: confidences[rejected], Acceptance: acceptance}, nil
+}
+
+// Predict returns the index of the strain of largest score, or -1 if the confidence is below the threshold.
+func (o *OpenSet) Predict(scores []float64) int {
+	if Confidence(o.Confidence, scores) < o.Threshold {
+		return -1
+	}
+	return MaxIndex(scores)
+}
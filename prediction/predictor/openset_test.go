@@ -0,0 +1,64 @@
+package predictor
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+
+	scores := []float64{1, 3, -2, 0.5}
+
+	probs := append([]float64{}, scores...)
+	SoftMax(probs)
+
+	if c := Confidence(ConfidenceMaxSoftmax, scores); math.Abs(c-probs[1]) > 1e-12 {
+		t.Fatalf("max softmax %f, expected %f", c, probs[1])
+	}
+
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s)
+	}
+
+	if c := Confidence(ConfidenceEnergy, scores); math.Abs(c-math.Log(sum)) > 1e-12 {
+		t.Fatalf("energy %f, expected %f", c, math.Log(sum))
+	}
+}
+
+func TestCalibrateOpenSet(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	scores := make([][]float64, 1000)
+	for i := range scores {
+		scores[i] = []float64{prng.NormFloat64() * 3, prng.NormFloat64(), prng.NormFloat64(), prng.NormFloat64()}
+	}
+
+	for _, confidence := range []string{ConfidenceMaxSoftmax, ConfidenceEnergy} {
+
+		openSet, err := CalibrateOpenSet(confidence, scores, 0.9)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var accepted int
+		for _, s := range scores {
+			if label := openSet.Predict(s); label != -1 {
+				if label != MaxIndex(s) {
+					t.Fatalf("accepted prediction %d, expected %d", label, MaxIndex(s))
+				}
+				accepted++
+			}
+		}
+
+		if accepted != 900 {
+			t.Fatalf("%s : %d of 1000 predictions accepted, expected 900", confidence, accepted)
+		}
+	}
+
+	if _, err := CalibrateOpenSet("entropy", scores, 0.9); err == nil {
+		t.Fatal("unknown confidence accepted")
+	}
+}
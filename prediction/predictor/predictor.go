@@ -6,10 +6,10 @@ import (
 	"github.com/ldsec/idash21_Task2/prediction/lib"
 	"github.com/ldsec/lattigo/v2/ckks"
 	"github.com/ldsec/lattigo/v2/ring"
+	"log"
 	"math"
 	"math/big"
 	"os"
-	"unsafe"
 )
 
 type Predictor struct {
@@ -56,13 +56,18 @@ func (p *Predictor) PrintModel() {
 func (p *Predictor) LoadModel(path string) {
 
 	nbStrains := lib.NbStrains
-	baseRing := p.baseRing
-	bredParams := baseRing.GetBredParams()[0]
-	Q := baseRing.Modulus[0]
 
-	p.model = new(Model)
+	// Checks that the model was trained on hashes of the feature extractor of the client
+	info, err := LoadModelInfo(path + ModelInfoFile)
+	if err != nil {
+		if !os.IsNotExist(err) || lib.RequireModelInfo {
+			panic(fmt.Errorf("cannot check the feature extractor of the model (set lib.RequireModelInfo to false to skip the check) : %s", err))
+		}
+		log.Printf("WARNING: %s not found, assuming the model was trained with the feature extractor of lib\n", path+ModelInfoFile)
+	} else if err = lib.CheckExtractorInfo(info.Extractor); err != nil {
+		panic(err)
+	}
 
-	var err error
 	var fr *os.File
 	if fr, err = os.Open(path + "weights_layer_0"); err != nil {
 		panic(err)
@@ -74,22 +79,24 @@ func (p *Predictor) LoadModel(path string) {
 		panic(err)
 	}
 
-	weights := make([][]float64, lib.NbStrains)
-	weightsScaledMontgomery := make([][]uint64, lib.HashSize)
-	for i := range weights {
-		tmp0 := make([]float64, lib.HashSize)
-		tmp1 := make([]uint64, lib.HashSize)
-		for j := range tmp0 {
-			tmp0[j] = math.Float64frombits(binary.LittleEndian.Uint64(buff[(i+j*nbStrains)<<3 : (i+j*nbStrains+1)<<3]))
-			tmp1[j] = ring.MForm(scaleUpExact(tmp0[j], lib.ModelScale, Q), Q, bredParams)
+	// The dimension of the hashes is given by the model, and must match the hashes encrypted by the client
+	if len(buff)%(nbStrains<<3) != 0 {
+		panic(fmt.Errorf("weights_layer_0 has %d bytes, not a multiple of %d weights", len(buff), nbStrains))
+	}
 
-		}
-		weights[i] = tmp0
-		weightsScaledMontgomery[i] = tmp1
+	hashSize := len(buff) / (nbStrains << 3)
+	if hashSize != lib.HashSize {
+		panic(fmt.Errorf("the model expects hashes of size %d but lib.HashSize is %d", hashSize, lib.HashSize))
 	}
 
-	p.model.weights = weights
-	p.model.weightsScaledMontgomery = weightsScaledMontgomery
+	weights := make([][]float64, nbStrains)
+	for i := range weights {
+		tmp := make([]float64, hashSize)
+		for j := range tmp {
+			tmp[j] = math.Float64frombits(binary.LittleEndian.Uint64(buff[(i+j*nbStrains)<<3 : (i+j*nbStrains+1)<<3]))
+		}
+		weights[i] = tmp
+	}
 
 	if fr, err = os.Open(path + "bias_layer_0"); err != nil {
 		panic(err)
@@ -101,11 +108,42 @@ func (p *Predictor) LoadModel(path string) {
 		panic(err)
 	}
 
-	bias := make([]float64, lib.NbStrains)
-	biasScaled := make([]*ring.Poly, lib.NbStrains)
+	bias := make([]float64, nbStrains)
 	for i := range bias {
 		bias[i] = math.Float64frombits(binary.LittleEndian.Uint64(buff[(i)<<3 : (i+1)<<3]))
+	}
+
+	p.SetModel(weights, bias)
+}
+
+// SetModel sets the weights (weights[i][j] being the weight of the j-th coefficient of the hashes for the
+// i-th strain) and the bias of the model, and scales them for the encrypted prediction.
+func (p *Predictor) SetModel(weights [][]float64, bias []float64) {
+
+	baseRing := p.baseRing
+	bredParams := baseRing.GetBredParams()[0]
+	Q := baseRing.Modulus[0]
+
+	if len(weights) != lib.NbStrains || len(bias) != lib.NbStrains {
+		panic(fmt.Errorf("the model must have weights and bias for %d strains", lib.NbStrains))
+	}
+
+	p.model = new(Model)
 
+	weightsScaledMontgomery := make([][]uint64, len(weights))
+	for i := range weights {
+		tmp := make([]uint64, len(weights[i]))
+		for j := range tmp {
+			tmp[j] = ring.MForm(scaleUpExact(weights[i][j], lib.ModelScale, Q), Q, bredParams)
+		}
+		weightsScaledMontgomery[i] = tmp
+	}
+
+	p.model.weights = weights
+	p.model.weightsScaledMontgomery = weightsScaledMontgomery
+
+	biasScaled := make([]*ring.Poly, len(bias))
+	for i := range bias {
 		tmp := baseRing.NewPoly()
 		baseRing.AddScalar(tmp, scaleUpExact(bias[i], lib.HashScale*lib.ModelScale, Q), tmp)
 		baseRing.NTT(tmp, tmp)
@@ -117,6 +155,21 @@ func (p *Predictor) LoadModel(path string) {
 	p.model.biasScaled = biasScaled
 }
 
+// Model returns the weights and the bias of the model, as given to SetModel.
+func (p *Predictor) Model() (weights [][]float64, bias []float64) {
+	return p.model.weights, p.model.bias
+}
+
+// NbStrains returns the number of strains of the model.
+func (p *Predictor) NbStrains() int {
+	return len(p.model.weights)
+}
+
+// HashSize returns the dimension of the hashes expected by the model.
+func (p *Predictor) HashSize() int {
+	return len(p.model.weights[0])
+}
+
 func (p *Predictor) Predict(input []*ckks.Ciphertext, output []*ckks.Ciphertext) {
 	for i := range output {
 		p.DotProduct(input, i, output[i])
@@ -125,76 +178,41 @@ func (p *Predictor) Predict(input []*ckks.Ciphertext, output []*ckks.Ciphertext)
 
 // Multiplies a list of ciphertext with the weights of the given label and sums it all on the output ciphertext
 func (p *Predictor) DotProduct(input []*ckks.Ciphertext, labelIndex int, output *ckks.Ciphertext) {
+	p.DotProductRange(input, labelIndex, 0, len(input), p.pool[labelIndex], output)
+	p.AddBias(labelIndex, output)
+}
+
+// DotProductRange multiplies the ciphertexts input[start:end] with the weights [start:end] of the given label
+// and adds the partial sum on the output ciphertext. The bias is not added.
+// The pool polynomial is used as accumulator, so concurrent calls must be given distinct pools.
+func (p *Predictor) DotProductRange(input []*ckks.Ciphertext, labelIndex, start, end int, pool *ring.Poly, output *ckks.Ciphertext) {
 
 	baseRing := p.baseRing
 
 	weights := p.model.weightsScaledMontgomery[labelIndex]
-	bias := p.model.biasScaled[labelIndex]
-	pool := p.pool[labelIndex]
 
-	for i := range input {
+	for k := 0; k < 2; k++ {
 
-		weight := weights[i]
-
-		p0 := input[i].Value()[0].Coeffs[0]
 		p1 := pool.Coeffs[0]
 
-		// Montgomery multiplication without modular reduction
-		// sum(ai * 2^64 * bi) = 2^64 * sum(ai * bi)
-		for j := uint64(0); j < baseRing.N; j = j + 8 {
-
-			x := (*[8]uint64)(unsafe.Pointer(&p0[j]))
-			y := (*[8]uint64)(unsafe.Pointer(&p1[j]))
-
-			y[0] += x[0] * weight
-			y[1] += x[1] * weight
-			y[2] += x[2] * weight
-			y[3] += x[3] * weight
-			y[4] += x[4] * weight
-			y[5] += x[5] * weight
-			y[6] += x[6] * weight
-			y[7] += x[7] * weight
-		}
-
-		if i%64 == 63 || i == len(input)-1 {
-			baseRing.InvMForm(pool, pool)
-			baseRing.Add(output.Value()[0], pool, output.Value()[0])
-			pool.Zero()
-		}
-	}
+		for i := start; i < end; i++ {
 
-	for i := range input {
+			// Montgomery multiplication without modular reduction
+			// sum(ai * 2^64 * bi) = 2^64 * sum(ai * bi)
+			mulAcc(p1, input[i].Value()[k].Coeffs[0], weights[i])
 
-		weight := weights[i]
-
-		p0 := input[i].Value()[1].Coeffs[0]
-		p1 := pool.Coeffs[0]
-
-		// Montgomery multiplication without modular reduction
-		// sum(ai * 2^64 * bi) = 2^64 * sum(ai * bi)
-		for j := uint64(0); j < baseRing.N; j = j + 8 {
-
-			x := (*[8]uint64)(unsafe.Pointer(&p0[j]))
-			y := (*[8]uint64)(unsafe.Pointer(&p1[j]))
-
-			y[0] += x[0] * weight
-			y[1] += x[1] * weight
-			y[2] += x[2] * weight
-			y[3] += x[3] * weight
-			y[4] += x[4] * weight
-			y[5] += x[5] * weight
-			y[6] += x[6] * weight
-			y[7] += x[7] * weight
-		}
-
-		if i%64 == 63 || i == len(input)-1 {
-			baseRing.InvMForm(pool, pool)
-			baseRing.Add(output.Value()[1], pool, output.Value()[1])
-			pool.Zero()
+			if (i-start)%64 == 63 || i == end-1 {
+				baseRing.InvMForm(pool, pool)
+				baseRing.Add(output.Value()[k], pool, output.Value()[k])
+				pool.Zero()
+			}
 		}
 	}
+}
 
-	baseRing.Add(output.Value()[0], bias, output.Value()[0])
+// AddBias adds the bias of the given label on the output ciphertext.
+func (p *Predictor) AddBias(labelIndex int, output *ckks.Ciphertext) {
+	p.baseRing.Add(output.Value()[0], p.model.biasScaled[labelIndex], output.Value()[0])
 }
 
 // Returns value * n mod Q
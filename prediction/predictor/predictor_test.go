@@ -6,6 +6,7 @@ import (
 	"github.com/ldsec/idash21_Task2/prediction/lib"
 	"github.com/ldsec/lattigo/v2/ckks"
 	"math"
+	"math/rand"
 	"os"
 	"testing"
 	"time"
@@ -156,3 +157,40 @@ func BenchmarkPredictor(b *testing.B) {
 		}
 	})
 }
+
+func TestDotProductRange(t *testing.T) {
+	params, _ := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+
+	prng := rand.New(rand.NewSource(0))
+
+	nbInputs := 150
+
+	predictor := newBenchmarkPredictor(params, nbInputs, prng)
+
+	input := make([]*ckks.Ciphertext, nbInputs)
+	for i := range input {
+		input[i] = ckks.NewCiphertext(params, 1, 0, lib.HashScale)
+		for _, pol := range input[i].Value() {
+			for j := range pol.Coeffs[0] {
+				pol.Coeffs[0][j] = prng.Uint64() % lib.Q[0]
+			}
+		}
+	}
+
+	want := ckks.NewCiphertext(params, 1, 0, lib.HashScale*lib.ModelScale)
+	predictor.DotProduct(input, 1, want)
+
+	// Partial sums over uneven chunks, reduced on the same output
+	have := ckks.NewCiphertext(params, 1, 0, lib.HashScale*lib.ModelScale)
+	pool := predictor.baseRing.NewPoly()
+	for _, r := range [][2]int{{0, 70}, {70, 71}, {71, 150}} {
+		predictor.DotProductRange(input, 1, r[0], r[1], pool, have)
+	}
+	predictor.AddBias(1, have)
+
+	for i := range want.Value() {
+		if !predictor.baseRing.Equal(want.Value()[i], have.Value()[i]) {
+			t.Fatalf("degree %d: partial sums do not match the full dot product", i)
+		}
+	}
+}
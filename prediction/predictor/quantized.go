@@ -0,0 +1,104 @@
+package predictor
+
+import (
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"math"
+)
+
+// Quantize returns value * scale rounded to the nearest integer (half away from zero), which is the
+// integer encoded by scaleUpExact : the client quantizes the hashes with lib.HashScale and the predictor
+// the weights with lib.ModelScale and the bias with lib.HashScale * lib.ModelScale.
+func Quantize(value, scale float64) float64 {
+	if value < 0 {
+		return -math.Floor(-value*scale + 0.5)
+	}
+	return math.Floor(value*scale + 0.5)
+}
+
+// PredictPlaintext writes the scores w_c . hash + b_c of the model for the hash in scores, without quantization.
+func (p *Predictor) PredictPlaintext(hash, scores []float64) {
+	for c, w := range p.model.weights {
+		score := p.model.bias[c]
+		for j := range w {
+			score += w[j] * hash[j]
+		}
+		scores[c] = score
+	}
+}
+
+// PredictQuantized writes in scores the scores of the model for the hash computed with the quantized hash,
+// weights and bias, as the encrypted prediction : the decrypted scores only differ by the encryption noise.
+func (p *Predictor) PredictQuantized(hash, scores []float64) {
+	scale := lib.HashScale * lib.ModelScale
+	for c, w := range p.model.weights {
+		score := Quantize(p.model.bias[c], scale)
+		for j := range w {
+			score += Quantize(w[j], lib.ModelScale) * Quantize(hash[j], lib.HashScale)
+		}
+		scores[c] = score / scale
+	}
+}
+
+// PredictEncrypted encrypts the hashes under a fresh secret key as the client does, evaluates the encrypted
+// prediction and returns the decrypted scores of each hash.
+func (p *Predictor) PredictEncrypted(hashes [][]float64) (scores [][]float64) {
+
+	params := p.params.Copy()
+	params.SetScale(lib.HashScale)
+
+	kgen := ckks.NewKeyGenerator(params)
+	sk := kgen.GenSecretKeyGaussian()
+	encoder := ckks.NewEncoder(params)
+	encryptor := ckks.NewEncryptorFromSk(params, sk)
+	decryptor := ckks.NewDecryptor(params, sk)
+
+	N := int(params.N())
+	nbStrains := len(p.model.weights)
+	hashSize := p.HashSize()
+
+	scores = make([][]float64, len(hashes))
+	for i := range scores {
+		scores[i] = make([]float64, nbStrains)
+	}
+
+	plaintext := ckks.NewPlaintext(params, 0, lib.HashScale)
+	values := make([]float64, N)
+	input := make([]*ckks.Ciphertext, hashSize)
+	output := make([]*ckks.Ciphertext, nbStrains)
+
+	// Batches of N hashes, the j-th ciphertext encrypting the j-th coefficient of the hashes
+	for start := 0; start < len(hashes); start += N {
+
+		end := start + N
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		for j := range input {
+			for k := range values {
+				values[k] = 0
+				if start+k < end {
+					values[k] = hashes[start+k][j]
+				}
+			}
+			encoder.EncodeCoeffs(values, plaintext)
+			input[j] = encryptor.EncryptNew(plaintext)
+		}
+
+		for c := range output {
+			output[c] = ckks.NewCiphertext(params, 1, 0, lib.HashScale*lib.ModelScale)
+		}
+
+		p.Predict(input, output)
+
+		for c := range output {
+			v := encoder.DecodeCoeffs(decryptor.DecryptNew(output[c]))
+			for k := start; k < end; k++ {
+				scores[k][c] = v[k-start]
+			}
+		}
+	}
+
+	return
+}
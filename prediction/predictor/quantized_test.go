@@ -0,0 +1,97 @@
+package predictor
+
+import (
+	"encoding/binary"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestPredictor returns a predictor of a random model of hash size lib.HashSize, loaded from a temporary folder.
+func newTestPredictor(t *testing.T, prng *rand.Rand) *Predictor {
+
+	dir, err := ioutil.TempDir("", "predictor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	weights := make([]byte, lib.HashSize*lib.NbStrains<<3)
+	for i := 0; i < lib.HashSize*lib.NbStrains; i++ {
+		binary.LittleEndian.PutUint64(weights[i<<3:], math.Float64bits(prng.NormFloat64()))
+	}
+
+	bias := make([]byte, lib.NbStrains<<3)
+	for i := 0; i < lib.NbStrains; i++ {
+		binary.LittleEndian.PutUint64(bias[i<<3:], math.Float64bits(prng.NormFloat64()))
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "weights_layer_0"), weights, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "bias_layer_0"), bias, 0644)
+
+	extractor, _ := lib.ConfiguredExtractorInfo()
+	ModelInfo{Extractor: extractor}.Save(filepath.Join(dir, ModelInfoFile))
+
+	params, _ := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	p := NewPredictor(params)
+	p.LoadModel(dir + string(filepath.Separator))
+
+	return p
+}
+
+func TestQuantize(t *testing.T) {
+
+	Q := lib.Q[0]
+
+	for _, v := range []float64{0, 0.5, -0.5, 1.49, -1.51, 0.0714, -0.0715, 3.99} {
+		want := scaleUpExact(v, lib.ModelScale, Q)
+		have := uint64(int64(Quantize(v, lib.ModelScale))+int64(Q)) % Q
+		if want != have {
+			t.Fatalf("Quantize(%f) = %d mod Q, scaleUpExact = %d", v, have, want)
+		}
+	}
+}
+
+func TestPredictQuantized(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	p := newTestPredictor(t, prng)
+
+	hashes := make([][]float64, 100)
+	for i := range hashes {
+		hashes[i] = make([]float64, lib.HashSize)
+		for j := range hashes[i] {
+			hashes[i][j] = prng.Float64() - 0.5
+		}
+	}
+
+	encrypted := p.PredictEncrypted(hashes)
+
+	float := make([]float64, lib.NbStrains)
+	quantized := make([]float64, lib.NbStrains)
+
+	for i, hash := range hashes {
+
+		p.PredictPlaintext(hash, float)
+		p.PredictQuantized(hash, quantized)
+
+		for c := range quantized {
+
+			// Only the encryption noise
+			if math.Abs(encrypted[i][c]-quantized[c]) > 0.05 {
+				t.Fatalf("hash %d class %d : encrypted %f, quantized %f", i, c, encrypted[i][c], quantized[c])
+			}
+
+			// The quantization of the weights with ModelScale = 7 changes the scores
+			if math.Abs(float[c]-quantized[c]) > float64(lib.HashSize)/(2*lib.ModelScale) {
+				t.Fatalf("hash %d class %d : float %f, quantized %f", i, c, float[c], quantized[c])
+			}
+		}
+	}
+}
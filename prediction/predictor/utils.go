@@ -5,7 +5,7 @@ import (
 )
 
 func SoftMax(vec []float64) {
-	max := 0.0
+	max := math.Inf(-1)
 	for i := range vec {
 		max = math.Max(max, vec[i])
 	}
@@ -0,0 +1,191 @@
+package preprocessing
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Coefficient masks selecting the DCTII coefficients forming the hash of the DCTHasher
+const (
+	MaskSquare   = "square"   // Top left HashSqrtSize x HashSqrtSize block
+	MaskZigZag   = "zigzag"   // First HashSize coefficients in zig-zag order
+	MaskTriangle = "triangle" // Coefficients (u, v) with u + v < k, for HashSize = k(k+1)/2
+	MaskFile     = "file"     // Coefficients read from a file
+)
+
+// SquareCoefficients returns the (row, column) indexes of the top left h x h block of DCTII coefficients, row by row.
+func SquareCoefficients(h int) (coefficients [][2]int) {
+	coefficients = make([][2]int, 0, h*h)
+	for i := 0; i < h; i++ {
+		for j := 0; j < h; j++ {
+			coefficients = append(coefficients, [2]int{i, j})
+		}
+	}
+	return
+}
+
+// ZigZagCoefficients returns the (row, column) indexes of the first k DCTII coefficients in the
+// JPEG zig-zag order : (0, 0), (0, 1), (1, 0), (2, 0), (1, 1), (0, 2), (0, 3), ...
+func ZigZagCoefficients(k int) (coefficients [][2]int) {
+
+	coefficients = make([][2]int, 0, k)
+
+	for d := 0; len(coefficients) < k; d++ {
+		for i := 0; i <= d && len(coefficients) < k; i++ {
+			if d&1 == 1 {
+				coefficients = append(coefficients, [2]int{i, d - i})
+			} else {
+				coefficients = append(coefficients, [2]int{d - i, i})
+			}
+		}
+	}
+
+	return
+}
+
+// TriangleCoefficients returns the (row, column) indexes of the k(k+1)/2 DCTII coefficients (u, v)
+// with u + v < k, in zig-zag order.
+func TriangleCoefficients(k int) [][2]int {
+	return ZigZagCoefficients(k * (k + 1) / 2)
+}
+
+// TriangleSide returns k such that hashSize = k(k+1)/2, and false if hashSize is not of this form.
+func TriangleSide(hashSize int) (k int, ok bool) {
+	for k*(k+1)/2 < hashSize {
+		k++
+	}
+	return k, k*(k+1)/2 == hashSize
+}
+
+// LoadCoefficients reads the (row, column) indexes of DCTII coefficients from the CSV file at the given path,
+// one coefficient "row,column" per line.
+func LoadCoefficients(path string) (coefficients [][2]int, err error) {
+
+	var fr *os.File
+	if fr, err = os.Open(path); err != nil {
+		return
+	}
+	defer fr.Close()
+
+	r := csv.NewReader(fr)
+	r.FieldsPerRecord = 2
+
+	var records [][]string
+	if records, err = r.ReadAll(); err != nil {
+		return nil, err
+	}
+
+	coefficients = make([][2]int, len(records))
+	for i, record := range records {
+		for j := range record {
+			if coefficients[i][j], err = strconv.Atoi(record[j]); err != nil {
+				return nil, fmt.Errorf("%s line %d : %s", path, i+1, err)
+			}
+			if coefficients[i][j] < 0 {
+				return nil, fmt.Errorf("%s line %d : negative index", path, i+1)
+			}
+		}
+	}
+
+	return
+}
+
+// SaveCoefficients writes the (row, column) indexes of DCTII coefficients in the CSV file at the given path.
+func SaveCoefficients(path string, coefficients [][2]int) (err error) {
+
+	var fw *os.File
+	if fw, err = os.Create(path); err != nil {
+		return
+	}
+	defer fw.Close()
+
+	w := csv.NewWriter(fw)
+	for _, c := range coefficients {
+		w.Write([]string{strconv.Itoa(c[0]), strconv.Itoa(c[1])})
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// CoefficientVariance accumulates the variance of each coefficient of n x n DCTII matrices,
+// to learn the mask of the coefficients with the largest variance across the training samples.
+type CoefficientVariance struct {
+	n     int
+	count int
+	sum   [][]float64
+	sumSq [][]float64
+}
+
+// NewCoefficientVariance creates a new CoefficientVariance for n x n matrices.
+func NewCoefficientVariance(n int) *CoefficientVariance {
+	cv := &CoefficientVariance{n: n, sum: make([][]float64, n), sumSq: make([][]float64, n)}
+	for i := range cv.sum {
+		cv.sum[i] = make([]float64, n)
+		cv.sumSq[i] = make([]float64, n)
+	}
+	return cv
+}
+
+// Add accumulates the n x n matrix given as a slice of n*n coefficients, row by row.
+func (cv *CoefficientVariance) Add(matrix []float64) {
+
+	if len(matrix) != cv.n*cv.n {
+		panic("matrix size does not match the CoefficientVariance")
+	}
+
+	for i := range cv.sum {
+		sum, sumSq := cv.sum[i], cv.sumSq[i]
+		for j, c := range matrix[i*cv.n : (i+1)*cv.n] {
+			sum[j] += c
+			sumSq[j] += c * c
+		}
+	}
+
+	cv.count++
+}
+
+// Variance returns the variance of the (row, column) coefficient.
+func (cv *CoefficientVariance) Variance(row, column int) float64 {
+	if cv.count == 0 {
+		return 0
+	}
+	mean := cv.sum[row][column] / float64(cv.count)
+	return cv.sumSq[row][column]/float64(cv.count) - mean*mean
+}
+
+// TopK returns the (row, column) indexes of the k coefficients of largest variance,
+// by decreasing variance, ties being broken by the zig-zag order.
+func (cv *CoefficientVariance) TopK(k int) [][2]int {
+
+	if k > cv.n*cv.n {
+		panic("k larger than the number of coefficients")
+	}
+
+	// Coefficients of the n x n matrix in zig-zag order (the 2n-1 anti-diagonals, restricted to the matrix)
+	coefficients := [][2]int{}
+	for _, c := range TriangleCoefficients(2*cv.n - 1) {
+		if c[0] < cv.n && c[1] < cv.n {
+			coefficients = append(coefficients, c)
+		}
+	}
+
+	variance := make([]float64, len(coefficients))
+	indexes := make([]int, len(coefficients))
+	for i, c := range coefficients {
+		variance[i] = cv.Variance(c[0], c[1])
+		indexes[i] = i
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool { return variance[indexes[i]] > variance[indexes[j]] })
+
+	topk := make([][2]int, k)
+	for i := range topk {
+		topk[i] = coefficients[indexes[i]]
+	}
+
+	return topk
+}
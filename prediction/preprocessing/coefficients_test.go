@@ -0,0 +1,140 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestZigZagCoefficients(t *testing.T) {
+	want := [][2]int{{0, 0}, {0, 1}, {1, 0}, {2, 0}, {1, 1}, {0, 2}, {0, 3}, {1, 2}, {2, 1}, {3, 0}}
+	if have := ZigZagCoefficients(len(want)); fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Errorf("have %v, want %v", have, want)
+	}
+}
+
+func TestTriangleCoefficients(t *testing.T) {
+
+	for k := 1; k < 10; k++ {
+
+		coefficients := TriangleCoefficients(k)
+
+		if len(coefficients) != k*(k+1)/2 {
+			t.Fatalf("k=%d: have %d coefficients", k, len(coefficients))
+		}
+
+		for _, c := range coefficients {
+			if c[0]+c[1] >= k {
+				t.Fatalf("k=%d: coefficient %v outside of the triangle", k, c)
+			}
+		}
+
+		if side, ok := TriangleSide(len(coefficients)); !ok || side != k {
+			t.Fatalf("k=%d: have triangle side %d", k, side)
+		}
+	}
+
+	if _, ok := TriangleSide(7); ok {
+		t.Error("7 is not a triangular number")
+	}
+}
+
+func TestLoadSaveCoefficients(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "coefficients.csv")
+
+	want := [][2]int{{0, 0}, {3, 1}, {12, 63}}
+	if err := SaveCoefficients(path, want); err != nil {
+		t.Fatal(err)
+	}
+
+	have, err := LoadCoefficients(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Errorf("have %v, want %v", have, want)
+	}
+}
+
+func TestCoefficientVariance(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	n := 4
+	cv := NewCoefficientVariance(n)
+
+	// The variance of the coefficient (i, j) is increasing with i*n+j
+	// except for (0, 0) which is constant
+	for s := 0; s < 1000; s++ {
+		matrix := make([]float64, n*n)
+		for i := 1; i < n*n; i++ {
+			matrix[i] = float64(i) * prng.NormFloat64()
+		}
+		matrix[0] = 1
+		cv.Add(matrix)
+	}
+
+	want := [][2]int{{3, 3}, {3, 2}, {3, 1}, {3, 0}, {2, 3}}
+	if have := cv.TopK(len(want)); fmt.Sprint(have) != fmt.Sprint(want) {
+		t.Errorf("have %v, want %v", have, want)
+	}
+
+	if have := cv.TopK(n * n); have[n*n-1] != [2]int{0, 0} {
+		t.Errorf("constant coefficient should be last, have %v", have[n*n-1])
+	}
+}
+
+func TestCoefficientMasks(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 5000)
+
+	window := 6
+
+	// Full DCTII of the FCGR
+	reference := NewDCTHasher(1, window, 1<<window, 1.0/5.0)
+	reference.Hash(0, dna)
+	full := reference.GetHash(0)
+
+	path := filepath.Join(t.TempDir(), "coefficients.csv")
+	if err := SaveCoefficients(path, [][2]int{{5, 2}, {0, 0}, {63, 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mask := range []struct {
+		name     string
+		hashSize int
+		want     [][2]int
+	}{
+		{MaskZigZag, 37, ZigZagCoefficients(37)},
+		{MaskTriangle, 45, TriangleCoefficients(9)},
+		{MaskFile, 3, [][2]int{{5, 2}, {0, 0}, {63, 1}}},
+	} {
+
+		params := ExtractorParameters{Window: window, HashSize: mask.hashSize, Normalizer: 1.0 / 5.0, Mask: mask.name, MaskPath: path}
+
+		extractor, err := NewFeatureExtractorByName("dct", 1, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		extractor.Hash(0, dna)
+
+		if extractor.HashSize() != mask.hashSize {
+			t.Fatalf("%s: have hash size %d, want %d", mask.name, extractor.HashSize(), mask.hashSize)
+		}
+
+		for i, c := range mask.want {
+			if extractor.GetHash(0)[i] != full[c[0]<<window+c[1]] {
+				t.Fatalf("%s: coefficient %d does not match the coefficient %v of the DCTII", mask.name, i, c)
+			}
+		}
+	}
+
+	if _, err := NewFeatureExtractorByName("dct", 1, ExtractorParameters{Window: window, HashSize: 7, Mask: MaskTriangle}); err == nil {
+		t.Error("triangle mask with a non triangular hash size should return an error")
+	}
+}
@@ -5,53 +5,89 @@ import (
 	"unsafe"
 )
 
+// ParallelDCTII computes the orthonormal DCTII (forward) and DCTIII (inverse) of size n with nbGo workers.
+// If n is a power of two, the transforms are computed in O(n log n) with Makhoul's algorithm on top of a
+// real-input FFT of size n, itself computed as a complex FFT of size n/2. Otherwise, they are computed
+// in O(n^2) as the product with the matrix of the DCTII (see PrunedDCTII).
 type ParallelDCTII struct {
-	n       int
-	roots   []complex128
-	scaling []complex128
-	pool    [][]complex128
+	n        int
+	roots    []complex128 // exp(-2i*pi*j/(n/2)), j < n/4
+	iroots   []complex128 // exp(+2i*pi*j/(n/2)), j < n/4
+	twiddle  []complex128 // exp(-2i*pi*k/n), k < n/2
+	scaling  []complex128 // s_k * exp(-i*pi*k/2n), s_0 = sqrt(1/n), s_k = sqrt(2/n)
+	direct   *PrunedDCTII // Fallback if n is not a power of two
+	pool     [][]complex128
+	poolReal [][]float64
 }
 
 func NewParallelDCTII(nbGo, n int) (dct *ParallelDCTII) {
 
+	if n < 2 {
+		panic("n must be at least 2")
+	}
+
+	dct = &ParallelDCTII{n: n}
+
+	dct.poolReal = make([][]float64, nbGo)
+	for i := range dct.poolReal {
+		dct.poolReal[i] = make([]float64, n)
+	}
+
 	if n&(n-1) != 0 {
-		panic("n must be a power of two")
+		dct.direct = NewPrunedDCTII(n, n)
+		return
+	}
+
+	m := n >> 1
+
+	dct.roots = make([]complex128, (m+1)>>1)
+	dct.iroots = make([]complex128, (m+1)>>1)
+	for j := range dct.roots {
+		angle := 2 * math.Pi * float64(j) / float64(m)
+		dct.roots[j] = complex(math.Cos(angle), -math.Sin(angle))
+		dct.iroots[j] = complex(math.Cos(angle), math.Sin(angle))
 	}
 
-	roots := make([]complex128, n)
-	for i := range roots {
-		angle := 2 * 3.141592653589793 * float64(i) / float64(n)
-		roots[i] = complex(math.Cos(angle), math.Sin(angle))
+	dct.twiddle = make([]complex128, m)
+	for k := range dct.twiddle {
+		angle := 2 * math.Pi * float64(k) / float64(n)
+		dct.twiddle[k] = complex(math.Cos(angle), -math.Sin(angle))
 	}
 
-	scaling := make([]complex128, n)
-	for i := range scaling {
-		angle := 3.141592653589793 * float64(i) / float64(2*n)
-		scaling[i] = complex(math.Cos(angle), math.Sin(angle))
+	dct.scaling = make([]complex128, n)
+	for k := range dct.scaling {
+		angle := math.Pi * float64(k) / float64(2*n)
+		dct.scaling[k] = complex(math.Cos(angle), -math.Sin(angle))
 
-		if i == 0 {
-			scaling[i] *= complex(math.Sqrt(1/float64(n)), 0)
+		if k == 0 {
+			dct.scaling[k] *= complex(math.Sqrt(1/float64(n)), 0)
 		} else {
-			scaling[i] *= complex(math.Sqrt(2/float64(n)), 0)
+			dct.scaling[k] *= complex(math.Sqrt(2/float64(n)), 0)
 		}
 	}
 
-	pool := make([][]complex128, nbGo)
-	for i := range pool {
-		pool[i] = make([]complex128, n)
+	dct.pool = make([][]complex128, nbGo)
+	for i := range dct.pool {
+		dct.pool[i] = make([]complex128, m)
 	}
 
-	return &ParallelDCTII{n: n, roots: roots, scaling: scaling, pool: pool}
+	return
+}
+
+// N returns the size of the transforms.
+func (dct *ParallelDCTII) N() int {
+	return dct.n
 }
 
 func (dct *ParallelDCTII) Transform2D(worker int, matrix [][]float64) {
+	dct.Transform2DToHash(worker, len(matrix), matrix)
+}
 
+// Transform2DToHash computes the 2D DCTII of the n x n matrix, the second pass being
+// only computed on the first hashDim rows, which are the only valid ones.
+func (dct *ParallelDCTII) Transform2DToHash(worker, hashDim int, matrix [][]float64) {
 	// Transpose
-	for i := 0; i < len(matrix)-1; i++ {
-		for j := i + 1; j < len(matrix); j++ {
-			matrix[i][j], matrix[j][i] = matrix[j][i], matrix[i][j]
-		}
-	}
+	transpose(matrix)
 
 	// DCT II
 	for i := range matrix {
@@ -59,71 +95,177 @@ func (dct *ParallelDCTII) Transform2D(worker int, matrix [][]float64) {
 	}
 
 	// Transpose
-	for i := 0; i < len(matrix)-1; i++ {
-		for j := i + 1; j < len(matrix); j++ {
-			matrix[i][j], matrix[j][i] = matrix[j][i], matrix[i][j]
-		}
-	}
+	transpose(matrix)
 
 	// DCT II
-	for i := range matrix {
+	for i := range matrix[:hashDim] {
 		dct.Transform1D(worker, matrix[i])
 	}
 }
 
-func (dct *ParallelDCTII) Transform2DToHash(worker, hashDim int, matrix [][]float64) {
-	// Transpose
-	for i := 0; i < len(matrix)-1; i++ {
-		for j := i + 1; j < len(matrix); j++ {
-			matrix[i][j], matrix[j][i] = matrix[j][i], matrix[i][j]
-		}
+// InverseTransform2D computes the 2D DCTIII of the n x n matrix, the inverse of Transform2D.
+func (dct *ParallelDCTII) InverseTransform2D(worker int, matrix [][]float64) {
+
+	transpose(matrix)
+
+	for i := range matrix {
+		dct.InverseTransform1D(worker, matrix[i])
 	}
 
-	// DCT II
+	transpose(matrix)
+
 	for i := range matrix {
-		dct.Transform1D(worker, matrix[i])
+		dct.InverseTransform1D(worker, matrix[i])
 	}
+}
 
-	// Transpose
+func transpose(matrix [][]float64) {
 	for i := 0; i < len(matrix)-1; i++ {
 		for j := i + 1; j < len(matrix); j++ {
 			matrix[i][j], matrix[j][i] = matrix[j][i], matrix[i][j]
 		}
 	}
-
-	// DCT II
-	for i := range matrix[:hashDim] {
-		dct.Transform1D(worker, matrix[i])
-	}
 }
 
+// Transform1D computes the orthonormal DCTII of vec in place.
 func (dct *ParallelDCTII) Transform1D(worker int, vec []float64) {
 
 	n := dct.n
-	roots := dct.roots
+
+	if len(vec) != n {
+		panic("vector size does not match the DCTII parameters")
+	}
+
+	if worker > len(dct.poolReal)-1 {
+		panic("#worker larger than DCTII parameters")
+	}
+
+	if dct.direct != nil {
+		tmp := dct.poolReal[worker]
+		copy(tmp, vec)
+		dct.direct.Transform1D(tmp, vec)
+		return
+	}
+
+	m := n >> 1
 	pool := dct.pool[worker]
+	twiddle := dct.twiddle
 	scaling := dct.scaling
 
-	if len(vec) > n {
-		panic("vector too large for DCTII parameters")
+	// Makhoul's reordering v = (x_0, x_2, ..., x_{n-2}, x_{n-1}, ..., x_3, x_1), packed as
+	// the complex vector z_j = v_{2j} + i * v_{2j+1} of size n/2 : v_i = x_{2i} for i < n/2
+	// and v_i = x_{2(n-1-i)+1} for i >= n/2
+	if m == 1 {
+		pool[0] = complex(vec[0], vec[1])
+	} else {
+		for j := 0; j < m>>1; j++ {
+			pool[j] = complex(vec[4*j], vec[4*j+2])
+		}
+		for j := m >> 1; j < m; j++ {
+			pool[j] = complex(vec[2*(n-1-2*j)+1], vec[2*(n-2-2*j)+1])
+		}
 	}
 
-	if worker > len(dct.pool)-1 {
+	fft(pool, dct.roots)
+
+	// Real-input FFT V_k = E_k + exp(-2i*pi*k/n) * O_k and V_{k+n/2} = E_k - exp(-2i*pi*k/n) * O_k, with
+	// E_k = (Z_k + conj(Z_{-k})) / 2 and O_k = (Z_k - conj(Z_{-k})) / 2i, and X_k = Re(scaling_k * V_k)
+	for k := 0; k < m; k++ {
+
+		zk, zmk := pool[k], pool[(m-k)&(m-1)]
+
+		e := complex(real(zk)+real(zmk), imag(zk)-imag(zmk)) * 0.5
+		o := complex(imag(zk)+imag(zmk), real(zmk)-real(zk)) * 0.5 * twiddle[k]
+
+		vec[k] = real((e + o) * scaling[k])
+		vec[k+m] = real((e - o) * scaling[k+m])
+	}
+}
+
+// InverseTransform1D computes the orthonormal DCTIII of vec in place, the inverse of Transform1D.
+func (dct *ParallelDCTII) InverseTransform1D(worker int, vec []float64) {
+
+	n := dct.n
+
+	if len(vec) != n {
+		panic("vector size does not match the DCTII parameters")
+	}
+
+	if worker > len(dct.poolReal)-1 {
 		panic("#worker larger than DCTII parameters")
 	}
 
-	for i := 0; i < len(vec)>>1; i++ {
-		pool[i] = complex(vec[i*2], 0)
-		pool[n-1-i] = complex(vec[i*2+1], 0)
+	if dct.direct != nil {
+		tmp := dct.poolReal[worker]
+		copy(tmp, vec)
+		dct.direct.InverseTransform1D(tmp, vec)
+		return
 	}
 
+	m := n >> 1
+	pool := dct.pool[worker]
+	twiddle := dct.twiddle
+	scaling := dct.scaling
+
+	// V_k = conj(scaling_k) / s_k^2 * (X_k - i * X_{n-k}) with X_n = 0
+	spectrum := func(k int) complex128 {
+		var xnk float64
+		if k != 0 {
+			xnk = vec[n-k]
+		}
+		s := real(scaling[k])*real(scaling[k]) + imag(scaling[k])*imag(scaling[k])
+		return complex(real(scaling[k])/s, -imag(scaling[k])/s) * complex(vec[k], -xnk)
+	}
+
+	// Z_k = E_k + i * O_k with E_k = (V_k + V_{k+n/2}) / 2 and O_k = (V_k - V_{k+n/2}) / (2 * exp(-2i*pi*k/n))
+	for k := 0; k < m; k++ {
+		vk, vkm := spectrum(k), spectrum(k+m)
+		e := (vk + vkm) * 0.5
+		o := (vk - vkm) * 0.5 * complex(real(twiddle[k]), -imag(twiddle[k]))
+		pool[k] = e + complex(-imag(o), real(o))
+	}
+
+	fft(pool, dct.iroots)
+
+	// v_{2j} + i * v_{2j+1} = z_j / (n/2), and Makhoul's reordering is inverted
+	v := dct.poolReal[worker]
+	scale := 1 / float64(m)
+	for j := range pool {
+		v[2*j] = real(pool[j]) * scale
+		v[2*j+1] = imag(pool[j]) * scale
+	}
+
+	for i := 0; i < m; i++ {
+		vec[i*2] = v[i]
+		vec[i*2+1] = v[n-1-i]
+	}
+}
+
+// fft computes in place the FFT of size m = len(pool), a power of two, with roots[j] = exp(+/-2i*pi*j/m) for j < m/2.
+func fft(pool []complex128, roots []complex128) {
+
+	n := len(pool)
+
 	sliceBitReverseInPlaceComplex128(pool, n)
 
+	// Small sizes
+	if n < 16 {
+		for m := 2; m <= n; m <<= 1 {
+			halfm, gap := m>>1, n/m
+			for i := 0; i < n; i += m {
+				for j := 0; j < halfm; j++ {
+					pool[i+j], pool[i+halfm+j] = butterfly(pool[i+j], pool[i+halfm+j], roots[j*gap])
+				}
+			}
+		}
+		return
+	}
+
 	var halfm, gap int
 	for m := 2; m <= n; m <<= 1 {
 
 		halfm = m >> 1
-		gap = dct.n / m
+		gap = n / m
 
 		if m == 2 {
 
@@ -204,21 +346,6 @@ func (dct *ParallelDCTII) Transform1D(worker int, vec []float64) {
 			}
 		}
 	}
-
-	for i := 0; i < n; i += 8 {
-		x := (*[8]complex128)(unsafe.Pointer(&pool[i]))
-		y := (*[8]complex128)(unsafe.Pointer(&scaling[i]))
-		z := (*[8]float64)(unsafe.Pointer(&vec[i]))
-
-		z[0] = real(x[0] * y[0])
-		z[1] = real(x[1] * y[1])
-		z[2] = real(x[2] * y[2])
-		z[3] = real(x[3] * y[3])
-		z[4] = real(x[4] * y[4])
-		z[5] = real(x[5] * y[5])
-		z[6] = real(x[6] * y[6])
-		z[7] = real(x[7] * y[7])
-	}
 }
 
 func butterfly(x, y, psi complex128) (u, v complex128) {
@@ -2,6 +2,7 @@ package preprocessing
 
 import (
 	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/ardabasaran/go-fourier"
@@ -95,3 +96,128 @@ func Benchmark2DDCTII(b *testing.B) {
 		}
 	})
 }
+
+// naiveDCTII returns the orthonormal DCTII of vec.
+func naiveDCTII(vec []float64) (out []float64) {
+	n := len(vec)
+	out = make([]float64, n)
+	for k := range out {
+		for j, x := range vec {
+			out[k] += x * math.Cos(math.Pi*float64((2*j+1)*k)/float64(2*n))
+		}
+		if k == 0 {
+			out[k] *= math.Sqrt(1 / float64(n))
+		} else {
+			out[k] *= math.Sqrt(2 / float64(n))
+		}
+	}
+	return
+}
+
+func TestDCTIIAnySize(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	for _, n := range []int{2, 3, 4, 5, 6, 8, 12, 16, 32, 100, 128, 512} {
+
+		dct := NewParallelDCTII(2, n)
+
+		vec := make([]float64, n)
+		for i := range vec {
+			vec[i] = prng.Float64()
+		}
+
+		want := naiveDCTII(vec)
+
+		have := append([]float64{}, vec...)
+		dct.Transform1D(1, have)
+
+		for i := range have {
+			if math.Abs(have[i]-want[i]) > 1e-10 {
+				t.Fatalf("n=%d: DCTII coefficient %d : have %f, want %f", n, i, have[i], want[i])
+			}
+		}
+
+		dct.InverseTransform1D(1, have)
+
+		for i := range have {
+			if math.Abs(have[i]-vec[i]) > 1e-10 {
+				t.Fatalf("n=%d: DCTIII coefficient %d : have %f, want %f", n, i, have[i], vec[i])
+			}
+		}
+	}
+}
+
+func TestInverse2DDCTII(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	for _, n := range []int{4, 12, 64} {
+
+		dct := NewParallelDCTII(1, n)
+
+		matrix := make([][]float64, n)
+		want := make([][]float64, n)
+		for i := range matrix {
+			matrix[i] = make([]float64, n)
+			for j := range matrix[i] {
+				matrix[i][j] = prng.Float64()
+			}
+			want[i] = append([]float64{}, matrix[i]...)
+		}
+
+		dct.Transform2D(0, matrix)
+		dct.InverseTransform2D(0, matrix)
+
+		for i := range matrix {
+			for j := range matrix[i] {
+				if math.Abs(matrix[i][j]-want[i][j]) > 1e-10 {
+					t.Fatalf("n=%d: coefficient (%d, %d) : have %f, want %f", n, i, j, matrix[i][j], want[i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestReconstruct(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 30000)
+
+	window := 6
+
+	// Reconstruction error of the normalized FCGR for an increasing number of coefficients
+	prevErr := math.Inf(1)
+	for _, hsize := range []int{4, 8, 16, 32, 64} {
+
+		hasher := NewDCTHasher(1, window, hsize, 1.0/5.0)
+		hasher.MapCGR(0, dna)
+		want := hasher.GetCGR(0)
+		var fcgr [][]float64
+		for i := range want {
+			fcgr = append(fcgr, append([]float64{}, want[i]...))
+		}
+
+		hasher.DCTII(0)
+		hasher.Finalize(0)
+
+		have := hasher.Reconstruct(0, hasher.GetHash(0))
+
+		var err float64
+		for i := range have {
+			for j := range have[i] {
+				err += (have[i][j] - fcgr[i][j]) * (have[i][j] - fcgr[i][j])
+			}
+		}
+
+		if err > prevErr {
+			t.Errorf("hsize=%d: reconstruction error %f larger than with fewer coefficients (%f)", hsize, err, prevErr)
+		}
+
+		if hsize == 1<<window && err > 1e-18 {
+			t.Errorf("reconstruction from all the coefficients should be exact, have error %g", err)
+		}
+
+		prevErr = err
+	}
+}
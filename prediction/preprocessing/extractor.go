@@ -0,0 +1,248 @@
+package preprocessing
+
+import (
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"sort"
+)
+
+// FeatureExtractor maps genomes to feature vectors (hashes) of a fixed dimension.
+// Its workers can hash genomes concurrently, each worker using its own buffers.
+type FeatureExtractor interface {
+	// Hash computes the hash of the genome, which can then be read with GetHash.
+	Hash(worker int, dna string)
+	// GetHash returns the hash of the last genome hashed by the worker.
+	GetHash(worker int) []float64
+	// NbWorkers returns the number of workers of the extractor.
+	NbWorkers() int
+	// HashSize returns the dimension of the hashes.
+	HashSize() int
+	// Name returns the name under which the extractor is registered.
+	Name() string
+}
+
+// ExtractorParameters are the parameters of the feature extractors (see lib.ExtractorParameters).
+type ExtractorParameters = lib.ExtractorParameters
+
+// ExtractorConstructor creates a feature extractor with nbGo workers.
+type ExtractorConstructor func(nbGo int, params ExtractorParameters) (FeatureExtractor, error)
+
+var extractors = map[string]ExtractorConstructor{}
+
+// RegisterFeatureExtractor registers a feature extractor under the given name.
+// It panics if the name is already registered.
+func RegisterFeatureExtractor(name string, constructor ExtractorConstructor) {
+	if _, ok := extractors[name]; ok {
+		panic(fmt.Errorf("feature extractor %s already registered", name))
+	}
+	extractors[name] = constructor
+}
+
+// FeatureExtractors returns the sorted names of the registered feature extractors.
+func FeatureExtractors() (names []string) {
+	for name := range extractors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// NewFeatureExtractorByName creates the feature extractor registered under the given name.
+func NewFeatureExtractorByName(name string, nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+	constructor, ok := extractors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown feature extractor %s, available : %v", name, FeatureExtractors())
+	}
+	return constructor(nbGo, params)
+}
+
+// NewFeatureExtractor creates the feature extractor selected by lib.FeatureExtractor with nbGo workers
+// and the pre-processing parameters of lib, such that training and prediction always hash the genomes
+// the same way.
+func NewFeatureExtractor(nbGo int) FeatureExtractor {
+	extractor, err := NewFeatureExtractorByName(lib.FeatureExtractor, nbGo, lib.ConfiguredParameters())
+	if err != nil {
+		panic(err)
+	}
+
+	// The encryptor and the predictor expect hashes of lib.HashSize coefficients
+	if extractor.HashSize() != lib.HashSize {
+		panic(fmt.Errorf("feature extractor %s returns hashes of size %d but lib.HashSize is %d", lib.FeatureExtractor, extractor.HashSize(), lib.HashSize))
+	}
+
+	return extractor
+}
+
+// maskCoefficients returns the (row, column) indexes of the DCTII coefficients selected by the mask of the parameters.
+func maskCoefficients(params ExtractorParameters) (coefficients [][2]int, err error) {
+
+	switch params.Mask {
+	case MaskSquare, "":
+		coefficients = SquareCoefficients(params.HashSqrtSize)
+	case MaskZigZag:
+		coefficients = ZigZagCoefficients(params.HashSize)
+	case MaskTriangle:
+		k, ok := TriangleSide(params.HashSize)
+		if !ok {
+			return nil, fmt.Errorf("hash size %d is not of the form k(k+1)/2 required by the triangle mask", params.HashSize)
+		}
+		coefficients = TriangleCoefficients(k)
+	case MaskFile:
+		if coefficients, err = LoadCoefficients(params.MaskPath); err != nil {
+			return nil, err
+		}
+		if len(coefficients) != params.HashSize {
+			return nil, fmt.Errorf("%s has %d coefficients, expected %d", params.MaskPath, len(coefficients), params.HashSize)
+		}
+	default:
+		return nil, fmt.Errorf("unknown coefficient mask %s", params.Mask)
+	}
+
+	for _, c := range coefficients {
+		if c[0] >= 1<<params.Window || c[1] >= 1<<params.Window {
+			return nil, fmt.Errorf("coefficient (%d, %d) outside of the FCGR matrix", c[0], c[1])
+		}
+	}
+
+	return
+}
+
+// setNormalization sets the normalization of the hasher, the empty normalization being the power law,
+// and loads the background IDF of the tfidf normalization.
+func setNormalization(hasher interface{ SetNormalization(string, *IDF) }, params ExtractorParameters) error {
+
+	normalization := params.Normalization
+	if normalization == "" {
+		normalization = NormalizationPower
+	}
+
+	var idf *IDF
+	if normalization == NormalizationTFIDF {
+		var err error
+		if idf, err = LoadIDF(params.BackgroundPath); err != nil {
+			return err
+		}
+	}
+
+	if err := checkNormalization(normalization, params.Window, idf); err != nil {
+		return err
+	}
+
+	hasher.SetNormalization(normalization, idf)
+	return nil
+}
+
+// checkPowerNormalization returns an error if the parameters select a normalization other than the power law,
+// for the extractors that do not support them.
+func checkPowerNormalization(params ExtractorParameters) error {
+	if params.Normalization != "" && params.Normalization != NormalizationPower {
+		return fmt.Errorf("normalization %s not supported by this feature extractor", params.Normalization)
+	}
+	return nil
+}
+
+// setStrand sets the strand mode of the hasher, the empty mode being the forward strand.
+func setStrand(hasher interface{ SetStrand(string) }, strand string) error {
+	switch strand {
+	case "":
+	case StrandForward, StrandCanonical, StrandBoth:
+		hasher.SetStrand(strand)
+	default:
+		return fmt.Errorf("unknown strand mode %s", strand)
+	}
+	return nil
+}
+
+func init() {
+	RegisterFeatureExtractor("dct", func(nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+
+		coefficients, err := maskCoefficients(params)
+		if err != nil {
+			return nil, err
+		}
+
+		hasher := NewDCTHasher(nbGo, params.Window, params.HashSqrtSize, params.Normalizer)
+		hasher.SetAmbiguityExpansion(params.AmbiguityExpansion)
+		if err := setStrand(hasher, params.Strand); err != nil {
+			return nil, err
+		}
+		if err := setNormalization(hasher, params); err != nil {
+			return nil, err
+		}
+		if params.Mask != MaskSquare && params.Mask != "" {
+			hasher.SetCoefficients(coefficients)
+		}
+		return hasher, nil
+	})
+
+	RegisterFeatureExtractor("dct-sparse", func(nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+
+		if params.Window > 20 {
+			return nil, fmt.Errorf("window must be at most 20")
+		}
+
+		if (params.Normalization == "" || params.Normalization == NormalizationPower) && params.Normalizer <= 0 {
+			return nil, fmt.Errorf("the normalizer must be positive")
+		}
+
+		coefficients, err := maskCoefficients(params)
+		if err != nil {
+			return nil, err
+		}
+
+		hasher := NewSparseDCTHasher(nbGo, params.Window, coefficients, params.Normalizer)
+		hasher.SetAmbiguityExpansion(params.AmbiguityExpansion)
+		if err := setStrand(hasher, params.Strand); err != nil {
+			return nil, err
+		}
+		if err := setNormalization(hasher, params); err != nil {
+			return nil, err
+		}
+		return hasher, nil
+	})
+
+	RegisterFeatureExtractor("dct-v2", func(nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+		if err := checkPowerNormalization(params); err != nil {
+			return nil, err
+		}
+		if params.Window < 5 {
+			return nil, fmt.Errorf("window must be at least 5")
+		}
+		if params.HashSqrtSize > 1<<(1+(params.Window+1)>>1) {
+			return nil, fmt.Errorf("hash sqrt size %d larger than the FCGR matrix", params.HashSqrtSize)
+		}
+		return NewDCTHasherV2(nbGo, params.Window, params.HashSqrtSize, params.Normalizer), nil
+	})
+
+	RegisterFeatureExtractor("fcgr", func(nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+		hasher := NewFCGRHasher(nbGo, params.Window, params.Normalizer)
+		hasher.SetAmbiguityExpansion(params.AmbiguityExpansion)
+		if err := setStrand(hasher.DCTHasher, params.Strand); err != nil {
+			return nil, err
+		}
+		if err := setNormalization(hasher.DCTHasher, params); err != nil {
+			return nil, err
+		}
+		return hasher, nil
+	})
+
+	RegisterFeatureExtractor("kmer", func(nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+		if err := checkPowerNormalization(params); err != nil {
+			return nil, err
+		}
+		if params.Window > 12 {
+			return nil, fmt.Errorf("window must be at most 12")
+		}
+		return NewKmerHasher(nbGo, params.Window), nil
+	})
+
+	RegisterFeatureExtractor("minhash", func(nbGo int, params ExtractorParameters) (FeatureExtractor, error) {
+		if err := checkPowerNormalization(params); err != nil {
+			return nil, err
+		}
+		if params.Window > 32 {
+			return nil, fmt.Errorf("window must be at most 32")
+		}
+		return NewMinHasher(nbGo, params.Window, params.HashSize), nil
+	})
+}
@@ -0,0 +1,79 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestFeatureExtractors(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 5000)
+
+	params := ExtractorParameters{Window: 6, HashSqrtSize: 8, HashSize: 64, Normalizer: 1.0 / 5.0}
+
+	for _, name := range FeatureExtractors() {
+
+		extractor, err := NewFeatureExtractorByName(name, 2, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if extractor.Name() != name {
+			t.Errorf("%s: have name %s", name, extractor.Name())
+		}
+
+		extractor.Hash(0, dna)
+		extractor.Hash(1, dna)
+
+		if len(extractor.GetHash(0)) != extractor.HashSize() {
+			t.Errorf("%s: have hash of size %d, want %d", name, len(extractor.GetHash(0)), extractor.HashSize())
+		}
+
+		for i := range extractor.GetHash(0) {
+			if extractor.GetHash(0)[i] != extractor.GetHash(1)[i] {
+				t.Fatalf("%s: workers return different hashes", name)
+			}
+		}
+	}
+
+	if _, err := NewFeatureExtractorByName("unknown", 1, params); err == nil {
+		t.Error("unknown extractor should return an error")
+	}
+}
+
+func TestKmerHasher(t *testing.T) {
+
+	hasher := NewKmerHasher(1, 2)
+	hasher.Hash(0, "AACGTNA")
+
+	// AA, AC, CG, GT, (TN, NA dropped)
+	want := make([]float64, 16)
+	want[0], want[1], want[6], want[11] = 0.25, 0.25, 0.25, 0.25
+
+	if fmt.Sprint(hasher.GetHash(0)) != fmt.Sprint(want) {
+		t.Errorf("have %v, want %v", hasher.GetHash(0), want)
+	}
+}
+
+func TestFCGRHasher(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 2000)
+
+	hasher := NewFCGRHasher(1, 4, 1)
+	hasher.Hash(0, dna)
+
+	reference := NewDCTHasher(1, 4, 16, 1)
+	reference.MapCGR(0, dna)
+
+	for i := range reference.GetCGR(0) {
+		for j := range reference.GetCGR(0)[i] {
+			if math.Abs(hasher.GetHash(0)[i*16+j]-reference.GetCGR(0)[i][j]) > 1e-12 {
+				t.Fatalf("coefficient (%d, %d) does not match the FCGR", i, j)
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package preprocessing
+
+import (
+	"strconv"
+)
+
+// Nucleotides are encoded on two bits (x, y), following the corners of the
+// Chaos Game Representation : A = (0, 0), C = (0, 1), G = (1, 0), T = (1, 1)
+const (
+	baseA = 0
+	baseC = 1
+	baseG = 2
+	baseT = 3
+)
+
+// baseCodes maps A, C, G and T to their two bits code, and the other characters to -1.
+var baseCodes [256]int8
+
+// iupacBases maps each IUPAC nucleotide code to the bases it is compatible with.
+// Characters that are not IUPAC nucleotide codes map to an empty list.
+var iupacBases = [256][]uint8{
+	'A': {baseA},
+	'C': {baseC},
+	'G': {baseG},
+	'T': {baseT},
+	'R': {baseA, baseG},
+	'Y': {baseC, baseT},
+	'K': {baseG, baseT},
+	'M': {baseA, baseC},
+	'S': {baseC, baseG},
+	'W': {baseA, baseT},
+	'B': {baseC, baseG, baseT},
+	'D': {baseA, baseG, baseT},
+	'H': {baseA, baseC, baseT},
+	'V': {baseA, baseC, baseG},
+	'N': {baseA, baseC, baseG, baseT},
+}
+
+// iupacIndicators maps each character to the indicators of the bases it is compatible with.
+// Characters that are not IUPAC nucleotide codes are compatible with all the bases.
+var iupacIndicators [256][4]int
+
+func init() {
+	for char := range baseCodes {
+		baseCodes[char] = -1
+	}
+	baseCodes['A'], baseCodes['C'], baseCodes['G'], baseCodes['T'] = baseA, baseC, baseG, baseT
+
+	for char, bases := range iupacBases {
+		if len(bases) == 0 {
+			iupacIndicators[char] = [4]int{1, 1, 1, 1}
+		}
+		for _, b := range bases {
+			iupacIndicators[char][b] = 1
+		}
+	}
+}
+
+// AmbiguityStats are the statistics of a genome regarding ambiguous and invalid bases.
+type AmbiguityStats struct {
+	NbBases          int // Number of bases of the genome
+	NbAmbiguousBases int // Number of IUPAC ambiguity codes (R, Y, K, M, S, W, B, D, H, V, N)
+	NbInvalidBases   int // Number of characters that are not IUPAC nucleotide codes
+	NbKmers          int // Number of k-mers made only of A, C, G and T
+	NbExpandedKmers  int // Number of ambiguous k-mers spread over their compatible k-mers
+	NbDroppedKmers   int // Number of k-mers dropped (invalid character or too many compatible k-mers)
+}
+
+// countBases sets the number of bases, of ambiguous bases and of invalid bases of the stats.
+func (stats *AmbiguityStats) countBases(dna string) {
+	stats.NbBases = len(dna)
+	stats.NbAmbiguousBases = 0
+	stats.NbInvalidBases = 0
+	for i := 0; i < len(dna); i++ {
+		switch len(iupacBases[dna[i]]) {
+		case 0:
+			stats.NbInvalidBases++
+		case 1:
+		default:
+			stats.NbAmbiguousBases++
+		}
+	}
+}
+
+// expandSubString2D spreads a count of one uniformly over all the k-mers compatible with the substring.
+// Returns false, without modifying the matrix, if the substring contains a character that is not an IUPAC
+// nucleotide code or if the number of compatible k-mers is larger than maxExpansion.
+func expandSubString2D(cgrmatrix CRGMatrix, substring string, maxExpansion int) bool {
+	return expandSubString(substring, maxExpansion, func(x, y int, weight float64) {
+		cgrmatrix[x][y] += weight
+	})
+}
+
+// expandSubString calls add(x, y, 1/m) for each of the m k-mers (x, y) compatible with the substring.
+// Returns false, without calling add, if the substring contains a character that is not an IUPAC
+// nucleotide code or if m is larger than maxExpansion.
+func expandSubString(substring string, maxExpansion int, add func(x, y int, weight float64)) bool {
+
+	nbKmers := 1
+	for i := 0; i < len(substring); i++ {
+
+		n := len(iupacBases[substring[i]])
+
+		if n == 0 {
+			return false
+		}
+
+		if nbKmers *= n; nbKmers > maxExpansion {
+			return false
+		}
+	}
+
+	weight := 1.0 / float64(nbKmers)
+
+	// Enumerates the compatible k-mers as a mixed radix counter
+	for k := 0; k < nbKmers; k++ {
+		var x, y int
+		r := k
+		for i := 0; i < len(substring); i++ {
+			bases := iupacBases[substring[i]]
+			b := int(bases[r%len(bases)])
+			r /= len(bases)
+			x |= (b >> 1) << i
+			y |= (b & 1) << i
+		}
+		add(x, y, weight)
+	}
+
+	return true
+}
+
+// AmbiguityStatsCSVHeader is the header of the CSV records returned by AmbiguityStats.CSVRecord.
+var AmbiguityStatsCSVHeader = []string{"id", "bases", "ambiguous_bases", "invalid_bases", "kmers", "expanded_kmers", "dropped_kmers"}
+
+// CSVRecord returns the stats of the genome with the given ID as a CSV record.
+func (stats AmbiguityStats) CSVRecord(id string) []string {
+	return []string{
+		id,
+		strconv.Itoa(stats.NbBases),
+		strconv.Itoa(stats.NbAmbiguousBases),
+		strconv.Itoa(stats.NbInvalidBases),
+		strconv.Itoa(stats.NbKmers),
+		strconv.Itoa(stats.NbExpandedKmers),
+		strconv.Itoa(stats.NbDroppedKmers),
+	}
+}
@@ -0,0 +1,112 @@
+package preprocessing
+
+// FCGRHasher is a feature extractor whose hash is the normalized Frequency Chaos Game Representation
+// of the genome, flattened row by row, without DCT. The hash is of size 4^window.
+type FCGRHasher struct {
+	*DCTHasher
+	fcgrhash []DCTHash
+}
+
+func NewFCGRHasher(nbGo, window int, normalizer float64) *FCGRHasher {
+
+	hash := make([]DCTHash, nbGo)
+	for i := range hash {
+		hash[i] = make([]float64, 1<<(2*window))
+	}
+
+	return &FCGRHasher{DCTHasher: NewDCTHasher(nbGo, window, 0, normalizer), fcgrhash: hash}
+}
+
+func (h *FCGRHasher) Hash(worker int, dna string) {
+
+	h.MapCGR(worker, dna)
+
+	hash := h.fcgrhash[worker]
+	for i, row := range h.GetCGR(worker) {
+		copy(hash[i*len(row):(i+1)*len(row)], row)
+	}
+}
+
+func (h *FCGRHasher) GetHash(worker int) []float64 {
+	return h.fcgrhash[worker]
+}
+
+func (h *FCGRHasher) HashSize() int {
+	return 1 << (2 * h.window)
+}
+
+func (h *FCGRHasher) Name() string {
+	return "fcgr"
+}
+
+// KmerHasher is a feature extractor whose hash is the vector of the frequencies of the k-mers of the genome,
+// in lexicographic order (A < C < G < T, the first base being the most significant). K-mers containing a base
+// other than A, C, G or T are dropped. The hash is of size 4^window.
+type KmerHasher struct {
+	nbGo   int
+	window int
+	hash   []DCTHash
+}
+
+func NewKmerHasher(nbGo, window int) *KmerHasher {
+
+	hash := make([]DCTHash, nbGo)
+	for i := range hash {
+		hash[i] = make([]float64, 1<<(2*window))
+	}
+
+	return &KmerHasher{nbGo: nbGo, window: window, hash: hash}
+}
+
+func (h *KmerHasher) Hash(worker int, dna string) {
+
+	hash := h.hash[worker]
+	for i := range hash {
+		hash[i] = 0.0
+	}
+
+	mask := len(hash) - 1
+
+	// Rolling 2-bit code of the current k-mer, and number of valid bases it contains
+	var code, valid, total int
+	for i := 0; i < len(dna); i++ {
+
+		bases := iupacBases[dna[i]]
+
+		if len(bases) != 1 {
+			valid = 0
+			continue
+		}
+
+		code = ((code << 2) | int(bases[0])) & mask
+
+		if valid++; valid >= h.window {
+			hash[code]++
+			total++
+		}
+	}
+
+	if total == 0 {
+		return
+	}
+
+	for i := range hash {
+		hash[i] /= float64(total)
+	}
+}
+
+func (h *KmerHasher) GetHash(worker int) []float64 {
+	return h.hash[worker]
+}
+
+func (h *KmerHasher) NbWorkers() int {
+	return h.nbGo
+}
+
+func (h *KmerHasher) HashSize() int {
+	return 1 << (2 * h.window)
+}
+
+func (h *KmerHasher) Name() string {
+	return "kmer"
+}
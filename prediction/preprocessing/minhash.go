@@ -0,0 +1,106 @@
+package preprocessing
+
+import (
+	"math"
+)
+
+// MinHasher is a feature extractor whose hash is a one-permutation MinHash sketch of the set of k-mers of the genome.
+// Each k-mer is hashed on 64 bits, the top bits selecting one of the hashsize bins, and each coefficient of the
+// sketch is the minimum hash of its bin, scaled to [0, 1] (1 for empty bins). K-mers containing a base other than
+// A, C, G or T are dropped.
+type MinHasher struct {
+	nbGo   int
+	window int
+	hash   []DCTHash
+	mins   [][]uint64
+}
+
+func NewMinHasher(nbGo, window, hashsize int) *MinHasher {
+
+	hash := make([]DCTHash, nbGo)
+	mins := make([][]uint64, nbGo)
+	for i := range hash {
+		hash[i] = make([]float64, hashsize)
+		mins[i] = make([]uint64, hashsize)
+	}
+
+	return &MinHasher{nbGo: nbGo, window: window, hash: hash, mins: mins}
+}
+
+func (h *MinHasher) Hash(worker int, dna string) {
+
+	mins := h.mins[worker]
+	for i := range mins {
+		mins[i] = math.MaxUint64
+	}
+
+	var mask uint64 = math.MaxUint64
+	if h.window < 32 {
+		mask = (1 << (2 * h.window)) - 1
+	}
+
+	nbBins := uint64(len(mins))
+
+	// Rolling 2-bit code of the current k-mer, and number of valid bases it contains
+	var code uint64
+	var valid int
+	for i := 0; i < len(dna); i++ {
+
+		bases := iupacBases[dna[i]]
+
+		if len(bases) != 1 {
+			valid = 0
+			continue
+		}
+
+		code = ((code << 2) | uint64(bases[0])) & mask
+
+		if valid++; valid >= h.window {
+
+			x := mix64(code)
+
+			// The bin is selected with the top bits and the rank with the remaining ones
+			hi, lo := x>>32, x&0xffffffff
+			bin := (hi * nbBins) >> 32
+
+			if lo < mins[bin] {
+				mins[bin] = lo
+			}
+		}
+	}
+
+	hash := h.hash[worker]
+	for i := range hash {
+		if mins[i] == math.MaxUint64 {
+			hash[i] = 1
+		} else {
+			hash[i] = float64(mins[i]) / float64(1<<32)
+		}
+	}
+}
+
+// mix64 is the finalizer of SplitMix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *MinHasher) GetHash(worker int) []float64 {
+	return h.hash[worker]
+}
+
+func (h *MinHasher) NbWorkers() int {
+	return h.nbGo
+}
+
+func (h *MinHasher) HashSize() int {
+	return len(h.hash[0])
+}
+
+func (h *MinHasher) Name() string {
+	return "minhash"
+}
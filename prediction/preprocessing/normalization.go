@@ -0,0 +1,270 @@
+package preprocessing
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Normalizations of the k-mer counts c of the FCGR matrix, before the DCTII
+const (
+	NormalizationPower     = "power"     // (c/max)^normalizer, max being the largest count
+	NormalizationFrequency = "frequency" // c/total, total being the number of k-mers
+	NormalizationLog1p     = "log1p"     // log(1+c)
+	NormalizationCLR       = "clr"       // Centered log-ratio log(1+c) - mean(log(1+c)) over all the k-mers
+	NormalizationTFIDF     = "tfidf"     // c/total * idf, idf being the inverse document frequency of the k-mer in a background set
+)
+
+// normalizeFCGR applies the normalization to the k-mer counts of the FCGR matrix.
+func normalizeFCGR(cgrmatrix CRGMatrix, normalization string, exponent float64, idf *IDF) {
+
+	switch normalization {
+
+	case NormalizationPower:
+
+		// Get the maximum value of the matrix
+		max := maxDoubleSlice(cgrmatrix)
+
+		// Non linear normalization, the empty cells of the (sparse for large windows) matrix
+		// are left to zero if max > 0 and exponent > 0
+		sparse := max > 0 && exponent > 0
+		for i := range cgrmatrix {
+			tmp := cgrmatrix[i]
+			for j := range tmp {
+				if tmp[j] != 0 || !sparse {
+					tmp[j] = math.Pow(tmp[j]/max, exponent)
+				}
+			}
+		}
+
+	case NormalizationFrequency, NormalizationTFIDF:
+
+		total := sumFCGR(cgrmatrix)
+		if total == 0 {
+			return
+		}
+
+		window := idf.window()
+		for i := range cgrmatrix {
+			tmp := cgrmatrix[i]
+			for j := range tmp {
+				if tmp[j] != 0 {
+					tmp[j] /= total
+					if normalization == NormalizationTFIDF {
+						tmp[j] *= idf.Weight(i<<window | j)
+					}
+				}
+			}
+		}
+
+	case NormalizationLog1p, NormalizationCLR:
+
+		for i := range cgrmatrix {
+			tmp := cgrmatrix[i]
+			for j := range tmp {
+				tmp[j] = math.Log1p(tmp[j])
+			}
+		}
+
+		if normalization == NormalizationCLR {
+			mean := sumFCGR(cgrmatrix) / float64(len(cgrmatrix)*len(cgrmatrix))
+			for i := range cgrmatrix {
+				tmp := cgrmatrix[i]
+				for j := range tmp {
+					tmp[j] -= mean
+				}
+			}
+		}
+
+	default:
+		panic("unknown normalization " + normalization)
+	}
+}
+
+// normalizeEntries applies the normalization to the k-mer counts of the non-zero cells of the n x n FCGR matrix.
+// It returns the value of the empty cells after the normalization, which is only non-zero for the CLR.
+func normalizeEntries(entries []SparseEntry, n int, window int, normalization string, exponent float64, idf *IDF) (empty float64) {
+
+	switch normalization {
+
+	case NormalizationPower:
+
+		var max float64
+		for i := range entries {
+			if entries[i].Value > max {
+				max = entries[i].Value
+			}
+		}
+
+		for i := range entries {
+			entries[i].Value = math.Pow(entries[i].Value/max, exponent)
+		}
+
+	case NormalizationFrequency, NormalizationTFIDF:
+
+		var total float64
+		for i := range entries {
+			total += entries[i].Value
+		}
+
+		for i := range entries {
+			entries[i].Value /= total
+			if normalization == NormalizationTFIDF {
+				entries[i].Value *= idf.Weight(entries[i].X<<window | entries[i].Y)
+			}
+		}
+
+	case NormalizationLog1p, NormalizationCLR:
+
+		var sum float64
+		for i := range entries {
+			entries[i].Value = math.Log1p(entries[i].Value)
+			sum += entries[i].Value
+		}
+
+		if normalization == NormalizationCLR {
+			mean := sum / (float64(n) * float64(n))
+			for i := range entries {
+				entries[i].Value -= mean
+			}
+			return -mean
+		}
+
+	default:
+		panic("unknown normalization " + normalization)
+	}
+
+	return 0
+}
+
+func sumFCGR(cgrmatrix CRGMatrix) (sum float64) {
+	for i := range cgrmatrix {
+		for _, c := range cgrmatrix[i] {
+			sum += c
+		}
+	}
+	return
+}
+
+// IDF is the inverse document frequency of the k-mers in a background set of genomes : the weight of a k-mer
+// present in df of the N genomes is log((1+N)/(1+df)) + 1. The k-mers are indexed by their FCGR coordinates
+// (x, y) as x * 2^window + y.
+type IDF struct {
+	Window    int
+	NbGenomes int
+	df        map[int]int
+}
+
+// NewIDF creates a new IDF for k-mers of the given window, without genomes.
+func NewIDF(window int) *IDF {
+	return &IDF{Window: window, df: map[int]int{}}
+}
+
+// Add adds a genome to the background set, given by the non-zero cells of its FCGR matrix.
+func (idf *IDF) Add(entries []SparseEntry) {
+	for _, e := range entries {
+		idf.df[e.X<<idf.Window|e.Y]++
+	}
+	idf.NbGenomes++
+}
+
+// Weight returns the inverse document frequency of the k-mer of index x * 2^window + y.
+func (idf *IDF) Weight(index int) float64 {
+	return math.Log(float64(1+idf.NbGenomes)/float64(1+idf.df[index])) + 1
+}
+
+func (idf *IDF) window() int {
+	if idf == nil {
+		return 0
+	}
+	return idf.Window
+}
+
+// Save writes the document frequencies in the CSV file at the given path : a first record "genomes,N"
+// followed by one record "k-mer,df" per k-mer present in at least one genome.
+func (idf *IDF) Save(path string) (err error) {
+
+	var buff strings.Builder
+	w := csv.NewWriter(&buff)
+	w.Write([]string{"genomes", strconv.Itoa(idf.NbGenomes)})
+
+	for x := 0; x < 1<<idf.Window; x++ {
+		for y := 0; y < 1<<idf.Window; y++ {
+			if df, ok := idf.df[x<<idf.Window|y]; ok {
+				w.Write([]string{SubString2D(x, y, idf.Window), strconv.Itoa(df)})
+			}
+		}
+	}
+
+	w.Flush()
+	if err = w.Error(); err != nil {
+		return
+	}
+
+	return ioutil.WriteFile(path, []byte(buff.String()), 0644)
+}
+
+// LoadIDF reads the document frequencies written by IDF.Save in the CSV file at the given path.
+func LoadIDF(path string) (idf *IDF, err error) {
+
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = 2
+
+	var records [][]string
+	if records, err = r.ReadAll(); err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 || records[0][0] != "genomes" {
+		return nil, fmt.Errorf("%s : missing number of genomes", path)
+	}
+
+	idf = &IDF{df: map[int]int{}}
+
+	if idf.NbGenomes, err = strconv.Atoi(records[0][1]); err != nil {
+		return nil, fmt.Errorf("%s line 1 : %s", path, err)
+	}
+
+	for i, record := range records[1:] {
+
+		if i == 0 {
+			idf.Window = len(record[0])
+		}
+
+		x, y := MapSubString2D(record[0])
+		if x == -1 || len(record[0]) != idf.Window {
+			return nil, fmt.Errorf("%s line %d : invalid k-mer %s", path, i+2, record[0])
+		}
+
+		if idf.df[x<<idf.Window|y], err = strconv.Atoi(record[1]); err != nil {
+			return nil, fmt.Errorf("%s line %d : %s", path, i+2, err)
+		}
+	}
+
+	return
+}
+
+// checkNormalization returns an error if the normalization is unknown or if the IDF does not match the window.
+func checkNormalization(normalization string, window int, idf *IDF) error {
+	switch normalization {
+	case NormalizationPower, NormalizationFrequency, NormalizationLog1p, NormalizationCLR:
+	case NormalizationTFIDF:
+		if idf == nil {
+			return fmt.Errorf("the tfidf normalization requires a background IDF")
+		}
+		if idf.Window != window {
+			return fmt.Errorf("background k-mers of length %d but the window is %d", idf.Window, window)
+		}
+	default:
+		return fmt.Errorf("unknown normalization %s", normalization)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// testIDF returns an IDF built on random genomes and saved at the given path.
+func testIDF(t *testing.T, prng *rand.Rand, window int, path string) *IDF {
+
+	hasher := NewSparseDCTHasher(1, window, SquareCoefficients(1), 1)
+
+	idf := NewIDF(window)
+	for i := 0; i < 10; i++ {
+		hasher.MapCGR(0, randomGenome(prng, 200))
+		idf.Add(hasher.GetEntries(0))
+	}
+
+	if err := idf.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	return idf
+}
+
+func TestIDF(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	path := filepath.Join(t.TempDir(), "background.csv")
+
+	want := testIDF(t, prng, 5, path)
+
+	have, err := LoadIDF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have.Window != want.Window || have.NbGenomes != want.NbGenomes {
+		t.Fatalf("have %d-mers and %d genomes, want %d and %d", have.Window, have.NbGenomes, want.Window, want.NbGenomes)
+	}
+
+	for i := 0; i < 1<<10; i++ {
+		if have.Weight(i) != want.Weight(i) {
+			t.Fatalf("k-mer %d : have weight %f, want %f", i, have.Weight(i), want.Weight(i))
+		}
+	}
+
+	// A k-mer in none of the genomes has the largest weight
+	if w := want.Weight(-1); w != math.Log(11)+1 {
+		t.Errorf("weight of an absent k-mer : have %f, want %f", w, math.Log(11)+1)
+	}
+}
+
+func TestNormalizations(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 3000)
+	path := filepath.Join(t.TempDir(), "background.csv")
+
+	// At window 8, most of the 4^8 cells of the FCGR matrix of the genome are empty
+	for _, window := range []int{4, 8} {
+
+		idf := testIDF(t, prng, window, path)
+
+		// Naive k-mer counts
+		counts := NewCRGMatrix(window)
+		var max, total float64
+		for i := 0; i < len(dna)-window+1; i++ {
+			x, y := MapSubString2D(dna[i : i+window])
+			counts[x][y]++
+			max = math.Max(max, counts[x][y])
+			total++
+		}
+
+		var mean float64
+		for x := range counts {
+			for y := range counts[x] {
+				mean += math.Log1p(counts[x][y]) / float64(int(1)<<(2*window))
+			}
+		}
+
+		want := map[string]func(x, y int) float64{
+			NormalizationPower:     func(x, y int) float64 { return math.Pow(counts[x][y]/max, 0.5) },
+			NormalizationFrequency: func(x, y int) float64 { return counts[x][y] / total },
+			NormalizationLog1p:     func(x, y int) float64 { return math.Log1p(counts[x][y]) },
+			NormalizationCLR:       func(x, y int) float64 { return math.Log1p(counts[x][y]) - mean },
+			NormalizationTFIDF:     func(x, y int) float64 { return counts[x][y] / total * idf.Weight(x<<window|y) },
+		}
+
+		for normalization, f := range want {
+
+			params := ExtractorParameters{Window: window, HashSqrtSize: 8, Normalizer: 0.5, Normalization: normalization, BackgroundPath: path}
+
+			dense, err := NewFeatureExtractorByName("dct", 1, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dense.(*DCTHasher).MapCGR(0, dna)
+
+			cgr := dense.(*DCTHasher).GetCGR(0)
+			for x := range cgr {
+				for y := range cgr[x] {
+					if math.Abs(cgr[x][y]-f(x, y)) > 1e-12 {
+						t.Fatalf("%s: FCGR (%d, %d) : have %f, want %f", normalization, x, y, cgr[x][y], f(x, y))
+					}
+				}
+			}
+
+			// The sparse hasher returns the same hash
+			sparse, err := NewFeatureExtractorByName("dct-sparse", 1, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dense.Hash(0, dna)
+			sparse.Hash(0, dna)
+
+			for i := range dense.GetHash(0) {
+				if math.Abs(dense.GetHash(0)[i]-sparse.GetHash(0)[i]) > 1e-9 {
+					t.Fatalf("%s: coefficient %d : have %f, want %f", normalization, i, sparse.GetHash(0)[i], dense.GetHash(0)[i])
+				}
+			}
+		}
+	}
+
+	// The background file at path is the one of window 8
+	for _, params := range []ExtractorParameters{
+		{Window: 4, HashSqrtSize: 8, Normalizer: 0.5, Normalization: "unknown"},
+		{Window: 4, HashSqrtSize: 8, Normalizer: 0.5, Normalization: NormalizationTFIDF, BackgroundPath: filepath.Join(t.TempDir(), "missing.csv")},
+		{Window: 4, HashSqrtSize: 8, Normalizer: 0.5, Normalization: NormalizationTFIDF, BackgroundPath: path},
+	} {
+		if _, err := NewFeatureExtractorByName("dct", 1, params); err == nil {
+			t.Errorf("%s should return an error", fmt.Sprint(params))
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package preprocessing
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Record is a genome and its ID.
+// A Record with a non-nil Err reports a read error and is the last Record of its channel.
+type Record struct {
+	ID       string
+	Sequence string
+	Err      error
+}
+
+// Result is the hash of the Index-th Record.
+// Stats is only set if the hasher reports ambiguity statistics, and Entries if the pool keeps them (see SetEntries).
+// A Result with a non-nil Err, and no hash, forwards the error of its Record.
+type Result struct {
+	Index   int
+	ID      string
+	Hash    []float64
+	Stats   *AmbiguityStats
+	Entries []SparseEntry
+	Err     error
+}
+
+// ambiguityStatsHasher is a FeatureExtractor reporting ambiguity statistics.
+type ambiguityStatsHasher interface {
+	GetAmbiguityStats(worker int) AmbiguityStats
+}
+
+// entriesHasher is a FeatureExtractor exposing the non-zero cells of the normalized FCGR matrix of the genomes.
+type entriesHasher interface {
+	GetEntries(worker int) []SparseEntry
+}
+
+// WorkerPool hashes genomes with all the workers of a FeatureExtractor.
+type WorkerPool struct {
+	hasher  FeatureExtractor
+	entries bool
+}
+
+// NewWorkerPool creates a new WorkerPool with as many workers as the extractor.
+func NewWorkerPool(hasher FeatureExtractor) *WorkerPool {
+	return &WorkerPool{hasher: hasher}
+}
+
+// SetEntries sets whether the results carry the non-zero cells of the normalized FCGR matrix of the genomes,
+// if the extractor exposes them (SparseDCTHasher).
+func (wp *WorkerPool) SetEntries(entries bool) {
+	wp.entries = entries
+}
+
+// HashAll hashes the records received on the input channel and returns a channel on which
+// the results are sent in the order of the records. The returned channel is closed once
+// the input channel is closed and all its records are hashed, or once the context is done.
+func (wp *WorkerPool) HashAll(ctx context.Context, records <-chan Record) <-chan Result {
+
+	nbWorkers := wp.hasher.NbWorkers()
+
+	type indexedRecord struct {
+		index int
+		Record
+	}
+
+	indexed := make(chan indexedRecord, nbWorkers)
+	hashed := make(chan Result, nbWorkers)
+	results := make(chan Result, nbWorkers)
+
+	// Indexes the records
+	go func() {
+		defer close(indexed)
+		i := 0
+		for r := range records {
+			select {
+			case indexed <- indexedRecord{index: i, Record: r}:
+			case <-ctx.Done():
+				return
+			}
+			i++
+		}
+	}()
+
+	// Hashes the records
+	var wg sync.WaitGroup
+	wg.Add(nbWorkers)
+	for g := 0; g < nbWorkers; g++ {
+		go func(worker int) {
+			defer wg.Done()
+			for r := range indexed {
+				if r.Err != nil {
+					select {
+					case hashed <- Result{Index: r.index, ID: r.ID, Err: r.Err}:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				wp.hasher.Hash(worker, r.Sequence)
+				hash := make([]float64, len(wp.hasher.GetHash(worker)))
+				copy(hash, wp.hasher.GetHash(worker))
+				res := Result{Index: r.index, ID: r.ID, Hash: hash}
+				if h, ok := wp.hasher.(ambiguityStatsHasher); ok {
+					stats := h.GetAmbiguityStats(worker)
+					res.Stats = &stats
+				}
+				if h, ok := wp.hasher.(entriesHasher); ok && wp.entries {
+					res.Entries = append([]SparseEntry{}, h.GetEntries(worker)...)
+				}
+				select {
+				case hashed <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(g)
+	}
+
+	go func() {
+		wg.Wait()
+		close(hashed)
+	}()
+
+	// Re-orders the results
+	go func() {
+		defer close(results)
+		pending := map[int]Result{}
+		next := 0
+		for r := range hashed {
+
+			pending[r.Index] = r
+
+			for res, ok := pending[next]; ok; res, ok = pending[next] {
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+				delete(pending, next)
+				next++
+			}
+		}
+	}()
+
+	return results
+}
+
+// ReadRecords reads the first nbGenomes records of the FASTA file at the given path
+// and sends them on the returned channel, which is closed at the end of the file,
+// after nbGenomes records, or once the context is done. A read error is sent as a last Record with a non-nil Err.
+// A negative nbGenomes reads the whole file. The sequence of a record can span several lines.
+func ReadRecords(ctx context.Context, path string, nbGenomes int) <-chan Record {
+
+	file, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+
+	records := make(chan Record, 1)
+
+	go func() {
+		defer file.Close()
+		defer close(records)
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 1<<16), 1<<26)
+
+		var id string
+		var sequence strings.Builder
+		var nbRecords int
+		var started bool
+
+		send := func() bool {
+			if !started {
+				return true
+			}
+			select {
+			case records <- Record{ID: id, Sequence: sequence.String()}:
+				nbRecords++
+				sequence.Reset()
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for scanner.Scan() && (nbGenomes < 0 || nbRecords < nbGenomes) {
+
+			line := scanner.Text()
+
+			if strings.HasPrefix(line, ">") {
+				if !send() {
+					return
+				}
+				id = line[1:]
+				started = true
+			} else {
+				sequence.WriteString(strings.TrimSpace(line))
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			select {
+			case records <- Record{Err: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		if nbGenomes < 0 || nbRecords < nbGenomes {
+			send()
+		}
+	}()
+
+	return records
+}
@@ -0,0 +1,139 @@
+package preprocessing
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func randomGenome(prng *rand.Rand, length int) string {
+	runesACGT := []byte("ACGT")
+	d := make([]byte, length)
+	for i := range d {
+		d[i] = runesACGT[prng.Intn(len(runesACGT))]
+	}
+	return string(d)
+}
+
+func TestHashAll(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	records := make([]Record, 37)
+	for i := range records {
+		records[i] = Record{ID: fmt.Sprintf("genome_%d", i), Sequence: randomGenome(prng, 1000+prng.Intn(4000))}
+	}
+
+	// Sequential reference
+	reference := NewDCTHasher(1, 6, 8, 1.0/5.0)
+	want := make([][]float64, len(records))
+	for i := range records {
+		reference.Hash(0, records[i].Sequence)
+		want[i] = append([]float64{}, reference.GetHash(0)...)
+	}
+
+	input := make(chan Record)
+	go func() {
+		for _, r := range records {
+			input <- r
+		}
+		close(input)
+	}()
+
+	pool := NewWorkerPool(NewDCTHasher(4, 6, 8, 1.0/5.0))
+
+	i := 0
+	for res := range pool.HashAll(context.Background(), input) {
+
+		if res.Index != i || res.ID != records[i].ID {
+			t.Fatalf("result %d: have index %d and ID %s", i, res.Index, res.ID)
+		}
+
+		for j := range want[i] {
+			if res.Hash[j] != want[i][j] {
+				t.Fatalf("result %d: hash does not match the sequential hash", i)
+			}
+		}
+
+		i++
+	}
+
+	if i != len(records) {
+		t.Fatalf("received %d results, want %d", i, len(records))
+	}
+}
+
+func TestReadRecords(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "genomes.fa")
+
+	fasta := ">B.1.1.7_0\nACGT\nACG\n>P.1_1\nTTTT\n>B.1.427_2\nGG\n"
+	if err := ioutil.WriteFile(path, []byte(fasta), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Record{{ID: "B.1.1.7_0", Sequence: "ACGTACG"}, {ID: "P.1_1", Sequence: "TTTT"}, {ID: "B.1.427_2", Sequence: "GG"}}
+
+	for _, nbGenomes := range []int{-1, 0, 2, 3, 10} {
+
+		have := []Record{}
+		for r := range ReadRecords(context.Background(), path, nbGenomes) {
+			have = append(have, r)
+		}
+
+		n := len(want)
+		if nbGenomes >= 0 && nbGenomes < n {
+			n = nbGenomes
+		}
+
+		if fmt.Sprint(have) != fmt.Sprint(want[:n]) {
+			t.Errorf("nbGenomes=%d: have %v, want %v", nbGenomes, have, want[:n])
+		}
+	}
+}
+
+func TestReadRecordsError(t *testing.T) {
+
+	// Reading a directory fails after it is opened
+	ctx := context.Background()
+	records := ReadRecords(ctx, t.TempDir(), -1)
+
+	var results []Result
+	for res := range NewWorkerPool(NewDCTHasher(2, 4, 3, 0.2)).HashAll(ctx, records) {
+		results = append(results, res)
+	}
+
+	if len(results) != 1 || results[0].Err == nil || results[0].Hash != nil {
+		t.Fatalf("results %v, want a single error", results)
+	}
+}
+
+func TestWorkerPoolEntries(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	records := make(chan Record, 8)
+	dna := make([]string, 8)
+	for i := range dna {
+		dna[i] = randomGenome(prng, 500)
+		records <- Record{ID: strconv.Itoa(i), Sequence: dna[i]}
+	}
+	close(records)
+
+	reference := NewSparseDCTHasher(1, 10, SquareCoefficients(1), 1)
+
+	pool := NewWorkerPool(NewSparseDCTHasher(4, 10, SquareCoefficients(1), 1))
+	pool.SetEntries(true)
+
+	for res := range pool.HashAll(context.Background(), records) {
+		reference.MapCGR(0, dna[res.Index])
+		if len(res.Entries) == 0 || fmt.Sprint(res.Entries) != fmt.Sprint(reference.GetEntries(0)) {
+			t.Fatalf("genome %d : entries differ from the entries of the hasher", res.Index)
+		}
+	}
+}
@@ -21,13 +21,21 @@ func NewDCTHash(HashSqrtSize int) (hash []float64) {
 }
 
 type DCTHasher struct {
-	nbGo       int
-	window     int
-	hsize      int
-	normalizer float64
-	dct        *ParallelDCTII
-	cgrmatrix  []CRGMatrix
-	cgrhash    []DCTHash
+	nbGo          int
+	window        int
+	hsize         int
+	normalizer    float64
+	maxExpansion  int
+	strand        string
+	rcTable       []int
+	normalization string
+	idf           *IDF
+	coefficients  [][2]int
+	hashDim       int
+	dct           *ParallelDCTII
+	cgrmatrix     []CRGMatrix
+	cgrhash       []DCTHash
+	stats         []AmbiguityStats
 }
 
 func NewDCTHasher(nbGo, window, hashsqrtsize int, normalizer float64) *DCTHasher {
@@ -45,13 +53,79 @@ func NewDCTHasher(nbGo, window, hashsqrtsize int, normalizer float64) *DCTHasher
 	}
 
 	return &DCTHasher{
-		nbGo:       nbGo,
-		window:     window,
-		hsize:      hashsqrtsize,
-		normalizer: normalizer,
-		dct:        dct,
-		cgrmatrix:  pool,
-		cgrhash:    hash}
+		nbGo:          nbGo,
+		window:        window,
+		hsize:         hashsqrtsize,
+		normalizer:    normalizer,
+		dct:           dct,
+		cgrmatrix:     pool,
+		cgrhash:       hash,
+		strand:        StrandForward,
+		normalization: NormalizationPower,
+		hashDim:       hashsqrtsize,
+		stats:         make([]AmbiguityStats, nbGo)}
+}
+
+// SetCoefficients sets the (row, column) indexes of the DCTII coefficients forming the hash, in that order,
+// instead of the top left hashsqrtsize x hashsqrtsize block (see ZigZagCoefficients, TriangleCoefficients
+// and LoadCoefficients).
+func (dcth *DCTHasher) SetCoefficients(coefficients [][2]int) {
+
+	if len(coefficients) == 0 {
+		panic("empty coefficient mask")
+	}
+
+	hashDim := 0
+	for _, c := range coefficients {
+		if c[0] >= 1<<dcth.window || c[1] >= 1<<dcth.window {
+			panic("coefficient outside of the FCGR matrix")
+		}
+		if c[0]+1 > hashDim {
+			hashDim = c[0] + 1
+		}
+	}
+
+	dcth.coefficients = coefficients
+	dcth.hashDim = hashDim
+
+	for i := range dcth.cgrhash {
+		dcth.cgrhash[i] = make([]float64, len(coefficients))
+	}
+}
+
+// SetAmbiguityExpansion enables the IUPAC ambiguity aware mapping if maxExpansion > 0.
+// A k-mer containing ambiguity codes (R, Y, K, M, S, W, B, D, H, V, N) is then spread as fractional
+// counts over all its compatible k-mers, unless it has more than maxExpansion of them, in which case
+// it is dropped. If maxExpansion = 0 (default), every k-mer containing a base other than A, C, G or T
+// is dropped.
+func (dcth *DCTHasher) SetAmbiguityExpansion(maxExpansion int) {
+	dcth.maxExpansion = maxExpansion
+}
+
+// SetStrand sets the k-mers counted in the FCGR matrix : StrandForward (default) counts the k-mers of the
+// forward strand, StrandCanonical counts each k-mer as the smaller of itself and its reverse complement, and
+// StrandBoth counts the k-mers of both strands. With StrandCanonical and StrandBoth, the hash of a genome
+// and of its reverse complement are equal.
+func (dcth *DCTHasher) SetStrand(strand string) {
+	switch strand {
+	case StrandForward:
+		dcth.rcTable = nil
+	case StrandCanonical, StrandBoth:
+		dcth.rcTable = reverseComplementTable(dcth.window)
+	default:
+		panic("unknown strand mode " + strand)
+	}
+	dcth.strand = strand
+}
+
+// SetNormalization sets the normalization of the k-mer counts of the FCGR matrix (NormalizationPower by default,
+// with the normalizer of the hasher as exponent). The IDF is only used by NormalizationTFIDF.
+func (dcth *DCTHasher) SetNormalization(normalization string, idf *IDF) {
+	if err := checkNormalization(normalization, dcth.window, idf); err != nil {
+		panic(err)
+	}
+	dcth.normalization = normalization
+	dcth.idf = idf
 }
 
 func (dcth *DCTHasher) Hash(worker int, dna string) {
@@ -74,27 +148,47 @@ func (dcth *DCTHasher) MapCGR(worker int, dna string) {
 		}
 	}
 
-	var x, y int
-	for j := 0; j < len(dna)-window+1; j++ {
-		substring := dna[j : j+window]
-		x, y = MapSubString2D(substring)
-		if x != -1 {
-			cgrmatrix[x][y] += 1.0
+	stats := &dcth.stats[worker]
+	stats.countBases(dna)
+	stats.NbKmers = 0
+	stats.NbExpandedKmers = 0
+
+	// Rolling k-mer index : the i-th base of the k-mer is the i-th bit of (x, y), so
+	// moving the window by one base shifts (x, y) by one bit and inserts the new base
+	// in the most significant bit. run is the number of valid bases ending the window.
+	var x, y, run int
+	msb := uint(window - 1)
+	for i := 0; i < len(dna); i++ {
+
+		if b := baseCodes[dna[i]]; b >= 0 {
+			x = (x >> 1) | int(b>>1)<<msb
+			y = (y >> 1) | int(b&1)<<msb
+			run++
 		} else {
-			j += y // skip to the next char after the invalid char
+			run = 0
+		}
+
+		if run >= window {
+			cgrmatrix[x][y] += 1.0
+			stats.NbKmers++
+		} else if dcth.maxExpansion > 0 && i >= window-1 {
+			// Slow path for the k-mers containing a base other than A, C, G or T
+			if expandSubString2D(cgrmatrix, dna[i-window+1:i+1], dcth.maxExpansion) {
+				stats.NbExpandedKmers++
+			}
 		}
 	}
 
-	// Get the maximum value of the matrix
-	max := maxDoubleSlice(cgrmatrix)
+	stats.NbDroppedKmers = 0
+	if len(dna) >= window {
+		stats.NbDroppedKmers = len(dna) - window + 1 - stats.NbKmers - stats.NbExpandedKmers
+	}
 
-	// Non linear normalization
-	for i := range cgrmatrix {
-		tmp := cgrmatrix[i]
-		for j := range tmp {
-			tmp[j] = math.Pow(tmp[j]/max, normalizer)
-		}
+	if dcth.strand != StrandForward {
+		applyStrand(cgrmatrix, dcth.rcTable, dcth.strand)
 	}
+
+	normalizeFCGR(cgrmatrix, dcth.normalization, normalizer, dcth.idf)
 }
 
 func MapSubString2D(substring string) (x, y int) {
@@ -116,11 +210,19 @@ func MapSubString2D(substring string) (x, y int) {
 	return x, y
 }
 
+// SubString2D returns the k-mer of the given length mapped to (x, y) by MapSubString2D.
+func SubString2D(x, y, window int) string {
+	kmer := make([]byte, window)
+	for i := range kmer {
+		kmer[i] = "ACGT"[((x>>i)&1)<<1|(y>>i)&1]
+	}
+	return string(kmer)
+}
+
 func (dcth *DCTHasher) DCTII(worker int) {
 
 	cgrmatrix := dcth.cgrmatrix[worker]
-	hsize := dcth.hsize
-	dcth.dct.Transform2DToHash(worker, hsize, cgrmatrix)
+	dcth.dct.Transform2DToHash(worker, dcth.hashDim, cgrmatrix)
 }
 
 func (dcth *DCTHasher) Finalize(worker int) {
@@ -129,6 +231,13 @@ func (dcth *DCTHasher) Finalize(worker int) {
 	hash := dcth.cgrhash[worker]
 	hsize := dcth.hsize
 
+	if dcth.coefficients != nil {
+		for i, c := range dcth.coefficients {
+			hash[i] = cgrmatrix[c[0]][c[1]]
+		}
+		return
+	}
+
 	for i := 0; i < hsize; i++ {
 		tmp := cgrmatrix[i]
 		idx := i * hsize
@@ -138,6 +247,11 @@ func (dcth *DCTHasher) Finalize(worker int) {
 	}
 }
 
+// DCTHasherV2 is an alternate hasher mapping each nucleotide to its own 1D representation :
+// for each nucleotide c in {A, C, G, T}, a k-mer is mapped to the integer whose i-th bit is set if the
+// i-th base of the k-mer is compatible with c (IUPAC codes being compatible with several nucleotides).
+// The four histograms of 2^window bins are normalized and reshaped into the four quadrants of a square
+// matrix of side 2^(ceil(window/2)+1), of which the top left block of the 2D DCTII is the hash.
 type DCTHasherV2 struct {
 	nbGo       int
 	window     int
@@ -154,7 +268,18 @@ type DCTHasherV2 struct {
 
 func NewDCTHasherV2(nbGo, window, hashsqrtsize int, normalizer float64) *DCTHasherV2 {
 
-	dct := NewParallelDCTII(nbGo, 2*(1<<(window>>1)))
+	// Each quadrant has 2^ceil(window/2) rows and 2^floor(window/2) columns, padded to a square
+	logSide := 1 + (window+1)>>1
+
+	if 1<<logSide < 16 {
+		panic("window must be at least 5")
+	}
+
+	if hashsqrtsize > 1<<logSide {
+		panic("hash size larger than the FCGR matrix")
+	}
+
+	dct := NewParallelDCTII(nbGo, 1<<logSide)
 
 	pool := make([]CRGMatrix, nbGo)
 	mA := make([][]float64, nbGo)
@@ -162,7 +287,7 @@ func NewDCTHasherV2(nbGo, window, hashsqrtsize int, normalizer float64) *DCTHash
 	mG := make([][]float64, nbGo)
 	mT := make([][]float64, nbGo)
 	for i := range pool {
-		pool[i] = NewCRGMatrix(1 + (window >> 1))
+		pool[i] = NewCRGMatrix(logSide)
 		mA[i] = make([]float64, 1<<window)
 		mC[i] = make([]float64, 1<<window)
 		mG[i] = make([]float64, 1<<window)
@@ -179,17 +304,19 @@ func NewDCTHasherV2(nbGo, window, hashsqrtsize int, normalizer float64) *DCTHash
 		window:     window,
 		hsize:      hashsqrtsize,
 		normalizer: normalizer,
-		dct:        dct, cgrmatrix: pool,
-		mA:      mA,
-		mC:      mC,
-		mG:      mG,
-		mT:      mT,
-		cgrhash: hash}
+		dct:        dct,
+		cgrmatrix:  pool,
+		mA:         mA,
+		mC:         mC,
+		mG:         mG,
+		mT:         mT,
+		cgrhash:    hash}
 }
 
 func (dcth *DCTHasherV2) Hash(worker int, dna string) {
 	dcth.MapCGR(worker, dna)
 	dcth.DCTII(worker)
+	dcth.Finalize(worker)
 }
 
 func (dcth *DCTHasherV2) MapCGR(worker int, dna string) {
@@ -198,9 +325,9 @@ func (dcth *DCTHasherV2) MapCGR(worker int, dna string) {
 	cgrmatrix := dcth.cgrmatrix[worker]
 	normalizer := dcth.normalizer
 	mA := dcth.mA[worker]
-	mC := dcth.mA[worker]
-	mG := dcth.mA[worker]
-	mT := dcth.mA[worker]
+	mC := dcth.mC[worker]
+	mG := dcth.mG[worker]
+	mT := dcth.mT[worker]
 
 	for i := range mA {
 		mA[i] = 0.0
@@ -209,103 +336,87 @@ func (dcth *DCTHasherV2) MapCGR(worker int, dna string) {
 		mT[i] = 0.0
 	}
 
-	xA, xC, xG, xT := MapSubStringTo4x1D(dna[0 : 0+window])
+	if len(dna) >= window {
 
-	mA[xA]++
-	mC[xC]++
-	mG[xG]++
-	mT[xT]++
+		xA, xC, xG, xT := MapSubStringTo4x1D(dna[0:window])
+
+		mA[xA]++
+		mC[xC]++
+		mG[xG]++
+		mT[xT]++
 
-	mask := 1 << (window - 1)
+		mask := (1 << window) - 1
+		msb := 1 << (window - 1)
 
-	for j := window; j < len(dna); j++ {
+		for j := window; j < len(dna); j++ {
 
-		xA >>= 1
-		xC >>= 1
-		xG >>= 1
-		xT >>= 1
+			bA, bC, bG, bT := mapCharTo4x1D(dna[j])
 
-		char := dna[j]
+			xA = ((xA >> 1) | (bA * msb)) & mask
+			xC = ((xC >> 1) | (bC * msb)) & mask
+			xG = ((xG >> 1) | (bG * msb)) & mask
+			xT = ((xT >> 1) | (bT * msb)) & mask
 
-		if char == 'A' {
-			xA |= mask
-		} else if char == 'C' {
-			xC |= mask
-		} else if char == 'G' {
-			xG |= mask
-		} else if char == 'T' {
-			xT |= mask
-		} else if char == 'R' {
-			xA |= mask
-			xG |= mask
-		} else if char == 'Y' {
-			xC |= mask
-			xT |= mask
-		} else if char == 'K' {
-			xG |= mask
-			xT |= mask
-		} else if char == 'M' {
-			xA |= mask
-			xC |= mask
-		} else if char == 'S' {
-			xC |= mask
-			xG |= mask
-		} else if char == 'W' {
-			xA |= mask
-			xT |= mask
-		} else if char == 'N' {
-			xA |= mask
-			xC |= mask
-			xG |= mask
-			xT |= mask
+			mA[xA]++
+			mC[xC]++
+			mG[xG]++
+			mT[xT]++
 		}
-
-		mA[xA]++
-		mC[xC]++
-		mG[xG]++
-		mT[xT]++
 	}
 
-	maxA := maxSlice(mA)
-	maxC := maxSlice(mC)
-	maxG := maxSlice(mG)
-	maxT := maxSlice(mT)
+	normalizeSlice(mA, normalizer)
+	normalizeSlice(mC, normalizer)
+	normalizeSlice(mG, normalizer)
+	normalizeSlice(mT, normalizer)
 
-	for i := range mA {
-		mA[i] = math.Pow(mA[i]/maxA, normalizer)
+	for i := range cgrmatrix {
+		tmp := cgrmatrix[i]
+		for j := range tmp {
+			tmp[j] = 0.0
+		}
 	}
 
-	for i := range mA {
-		mC[i] = math.Pow(mC[i]/maxC, normalizer)
+	// Quadrants of 2^ceil(window/2) rows and 2^floor(window/2) columns
+	halfSize := len(cgrmatrix) >> 1
+	logCols := window >> 1
+	cols := 1 << logCols
+
+	for x := range mA {
+		i, j := x>>logCols, x&(cols-1)
+		cgrmatrix[i][j] = mA[x]
+		cgrmatrix[i][j+halfSize] = mC[x]
+		cgrmatrix[i+halfSize][j] = mG[x]
+		cgrmatrix[i+halfSize][j+halfSize] = mT[x]
 	}
+}
 
-	for i := range mA {
-		mG[i] = math.Pow(mG[i]/maxG, normalizer)
-	}
+// normalizeSlice applies x -> (x/max)^normalizer to the slice.
+func normalizeSlice(slice []float64, normalizer float64) {
 
-	for i := range mA {
-		mT[i] = math.Pow(mT[i]/maxT, normalizer)
-	}
+	max := maxSlice(slice)
 
-	halfSize := (1 << (window >> 1))
+	if max == 0 {
+		return
+	}
 
-	for i := 0; i < (1 << (window >> 1)); i++ {
-		for j := 0; j < (1 << (window >> 1)); j++ {
-			cgrmatrix[i][j] = mA[i*halfSize+j]
-			cgrmatrix[i][j+halfSize] = mC[i*halfSize+j]
-			cgrmatrix[i+halfSize][j] = mG[i*halfSize+j]
-			cgrmatrix[i+halfSize][j+halfSize] = mT[i*halfSize+j]
-		}
+	for i := range slice {
+		slice[i] = math.Pow(slice[i]/max, normalizer)
 	}
 }
 
 func (dcth *DCTHasherV2) DCTII(worker int) {
 
 	cgrmatrix := dcth.cgrmatrix[worker]
-	hash := dcth.cgrhash[worker]
 	hsize := dcth.hsize
 
 	dcth.dct.Transform2DToHash(worker, hsize, cgrmatrix)
+}
+
+func (dcth *DCTHasherV2) Finalize(worker int) {
+
+	cgrmatrix := dcth.cgrmatrix[worker]
+	hash := dcth.cgrhash[worker]
+	hsize := dcth.hsize
 
 	for i := 0; i < hsize; i++ {
 		tmp := cgrmatrix[i]
@@ -316,46 +427,39 @@ func (dcth *DCTHasherV2) DCTII(worker int) {
 	}
 }
 
+// MapSubStringTo4x1D maps the substring to its four 1D representations : the i-th bit of xA is set if the
+// i-th base of the substring is compatible with A, and likewise for C, G and T.
+// Characters that are not IUPAC nucleotide codes are treated as N.
 func MapSubStringTo4x1D(substring string) (xA, xC, xG, xT int) {
-	i := 1
-	for _, char := range substring {
-		if char == 'A' {
-			xA |= i
-		} else if char == 'C' {
-			xC |= i
-		} else if char == 'G' {
-			xG |= i
-		} else if char == 'T' {
-			xT |= i
-		} else if char == 'R' {
-			xA |= i
-			xG |= i
-		} else if char == 'Y' {
-			xC |= i
-			xT |= i
-		} else if char == 'K' {
-			xG |= i
-			xT |= i
-		} else if char == 'M' {
-			xA |= i
-			xC |= i
-		} else if char == 'S' {
-			xC |= i
-			xG |= i
-		} else if char == 'W' {
-			xA |= i
-			xT |= i
-		} else {
-			xA |= i
-			xC |= i
-			xG |= i
-			xT |= i
-		}
-		i <<= 1
+	for i := 0; i < len(substring); i++ {
+		bA, bC, bG, bT := mapCharTo4x1D(substring[i])
+		xA |= bA << i
+		xC |= bC << i
+		xG |= bG << i
+		xT |= bT << i
 	}
 	return
 }
 
+// mapCharTo4x1D returns, for each nucleotide, 1 if the character is compatible with it and 0 otherwise.
+// Characters that are not IUPAC nucleotide codes are treated as N.
+func mapCharTo4x1D(char byte) (bA, bC, bG, bT int) {
+	b := &iupacIndicators[char]
+	return b[baseA], b[baseC], b[baseG], b[baseT]
+}
+
+func (dcth *DCTHasherV2) NbWorkers() int {
+	return dcth.nbGo
+}
+
+func (dcth *DCTHasherV2) HashSize() int {
+	return dcth.hsize * dcth.hsize
+}
+
+func (dcth *DCTHasherV2) Name() string {
+	return "dct-v2"
+}
+
 func (dcth *DCTHasherV2) GetCGR(worker int) [][]float64 {
 	return dcth.cgrmatrix[worker]
 }
@@ -364,6 +468,52 @@ func (dcth *DCTHasherV2) GetHash(worker int) []float64 {
 	return dcth.cgrhash[worker]
 }
 
+func (dcth *DCTHasher) NbWorkers() int {
+	return dcth.nbGo
+}
+
+func (dcth *DCTHasher) HashSize() int {
+	return len(dcth.cgrhash[0])
+}
+
+func (dcth *DCTHasher) Name() string {
+	return "dct"
+}
+
+// Window returns the length of the k-mers of the FCGR matrix, which is of size 2^window x 2^window.
+func (dcth *DCTHasher) Window() int {
+	return dcth.window
+}
+
+// Coefficients returns the (row, column) indexes of the DCTII coefficients forming the hash, in that order.
+func (dcth *DCTHasher) Coefficients() [][2]int {
+	if dcth.coefficients == nil {
+		return SquareCoefficients(dcth.hsize)
+	}
+	return dcth.coefficients
+}
+
+// Reconstruct returns the approximate normalized FCGR matrix of a genome from its hash, the 2D DCTIII of the
+// matrix whose DCTII coefficients selected by the hasher are the hash and the others are zero. The cells of
+// the FCGR matrix are (c/max)^normalizer for c the count of the k-mer and max the count of the most frequent k-mer.
+func (dcth *DCTHasher) Reconstruct(worker int, hash []float64) CRGMatrix {
+
+	coefficients := dcth.Coefficients()
+
+	if len(hash) != len(coefficients) {
+		panic("hash size does not match the hasher")
+	}
+
+	matrix := NewCRGMatrix(dcth.window)
+	for i, c := range coefficients {
+		matrix[c[0]][c[1]] = hash[i]
+	}
+
+	dcth.dct.InverseTransform2D(worker, matrix)
+
+	return matrix
+}
+
 func (dcth *DCTHasher) GetCGR(worker int) [][]float64 {
 	return dcth.cgrmatrix[worker]
 }
@@ -372,6 +522,11 @@ func (dcth *DCTHasher) GetHash(worker int) []float64 {
 	return dcth.cgrhash[worker]
 }
 
+// GetAmbiguityStats returns the ambiguity statistics of the last genome mapped by the worker.
+func (dcth *DCTHasher) GetAmbiguityStats(worker int) AmbiguityStats {
+	return dcth.stats[worker]
+}
+
 func maxSlice(slice []float64) (max float64) {
 	max = 0.0
 	for _, v := range slice {
@@ -1,8 +1,13 @@
 package preprocessing
 
 import (
+	"fmt"
+	"math"
 	"math/rand"
+	"strings"
 	"testing"
+
+	"github.com/ardabasaran/go-fourier"
 )
 
 func BenchmarkProcessing(b *testing.B) {
@@ -42,3 +47,297 @@ func BenchmarkProcessing(b *testing.B) {
 
 	})
 }
+
+func sumDoubleSlice(doubleSlice [][]float64) (sum float64) {
+	for _, slice := range doubleSlice {
+		for _, v := range slice {
+			sum += v
+		}
+	}
+	return
+}
+
+func TestMapCGRAmbiguity(t *testing.T) {
+
+	dna := "ACGTNACGT-ACGT"
+
+	// Windows : ACGT, CGTN, GTNA, TNAC, NACG, ACGT, CGT-, GT-A, T-AC, -ACG, ACGT
+	xACGT, yACGT := MapSubString2D("ACGT")
+	xAACG, yAACG := MapSubString2D("AACG")
+
+	t.Run("Dropped", func(t *testing.T) {
+
+		hasher := NewDCTHasher(1, 4, 4, 1.0)
+		hasher.MapCGR(0, dna)
+
+		cgr := hasher.GetCGR(0)
+
+		if cgr[xACGT][yACGT] != 1 || sumDoubleSlice(cgr) != 1 {
+			t.Errorf("only the three ACGT k-mers should be counted")
+		}
+
+		want := AmbiguityStats{NbBases: 14, NbAmbiguousBases: 1, NbInvalidBases: 1, NbKmers: 3, NbExpandedKmers: 0, NbDroppedKmers: 8}
+		if stats := hasher.GetAmbiguityStats(0); stats != want {
+			t.Errorf("have %+v, want %+v", stats, want)
+		}
+	})
+
+	t.Run("Expanded", func(t *testing.T) {
+
+		hasher := NewDCTHasher(1, 4, 4, 1.0)
+		hasher.SetAmbiguityExpansion(4)
+		hasher.MapCGR(0, dna)
+
+		cgr := hasher.GetCGR(0)
+
+		// Normalized by the count of ACGT
+		if cgr[xACGT][yACGT] != 1 || math.Abs(sumDoubleSlice(cgr)-7.0/3.0) > 1e-12 {
+			t.Errorf("each of the four k-mers containing N should be spread with a total count of one")
+		}
+
+		if math.Abs(cgr[xAACG][yAACG]-0.25/3.0) > 1e-12 {
+			t.Errorf("NACG should count 1/4 for AACG")
+		}
+
+		want := AmbiguityStats{NbBases: 14, NbAmbiguousBases: 1, NbInvalidBases: 1, NbKmers: 3, NbExpandedKmers: 4, NbDroppedKmers: 4}
+		if stats := hasher.GetAmbiguityStats(0); stats != want {
+			t.Errorf("have %+v, want %+v", stats, want)
+		}
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+
+		hasher := NewDCTHasher(1, 4, 4, 1.0)
+		hasher.SetAmbiguityExpansion(3)
+		hasher.MapCGR(0, "ACGTRACGTN")
+
+		want := AmbiguityStats{NbBases: 10, NbAmbiguousBases: 2, NbInvalidBases: 0, NbKmers: 2, NbExpandedKmers: 4, NbDroppedKmers: 1}
+		if stats := hasher.GetAmbiguityStats(0); stats != want {
+			t.Errorf("have %+v, want %+v", stats, want)
+		}
+	})
+}
+
+// naiveMapCGRV2 is a reference implementation of DCTHasherV2.MapCGR.
+func naiveMapCGRV2(dna string, window int, normalizer float64) (matrix [][]float64) {
+
+	iupac := map[byte]string{
+		'A': "A", 'C': "C", 'G': "G", 'T': "T",
+		'R': "AG", 'Y': "CT", 'K': "GT", 'M': "AC", 'S': "CG", 'W': "AT",
+		'B': "CGT", 'D': "AGT", 'H': "ACT", 'V': "ACG", 'N': "ACGT",
+	}
+
+	compatible := func(char byte, nucleotide byte) bool {
+		bases, ok := iupac[char]
+		return !ok || strings.IndexByte(bases, nucleotide) != -1
+	}
+
+	side := 1 << (1 + (window+1)/2)
+	cols := 1 << (window / 2)
+
+	matrix = make([][]float64, side)
+	for i := range matrix {
+		matrix[i] = make([]float64, side)
+	}
+
+	for c, nucleotide := range []byte("ACGT") {
+
+		hist := make([]float64, 1<<window)
+		for j := 0; j+window <= len(dna); j++ {
+			x := 0
+			for p := 0; p < window; p++ {
+				if compatible(dna[j+p], nucleotide) {
+					x += 1 << p
+				}
+			}
+			hist[x]++
+		}
+
+		max := 0.0
+		for _, v := range hist {
+			max = math.Max(max, v)
+		}
+
+		rowOffset := (c >> 1) * side / 2
+		colOffset := (c & 1) * side / 2
+		for x, v := range hist {
+			matrix[rowOffset+x/cols][colOffset+x%cols] = math.Pow(v/max, normalizer)
+		}
+	}
+
+	return
+}
+
+func TestDCTHasherV2(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(1))
+
+	runes := []byte("ACGTACGTACGTACGTACGTRYKMSWBDHVN-")
+	d := make([]byte, 3000)
+	for i := range d {
+		d[i] = runes[prng.Intn(len(runes))]
+	}
+	dna := string(d)
+
+	hsize := 8
+
+	for _, window := range []int{5, 6, 7, 8} {
+
+		t.Run(fmt.Sprintf("Window=%d", window), func(t *testing.T) {
+
+			want := naiveMapCGRV2(dna, window, 1.0/5.0)
+
+			hasher := NewDCTHasherV2(2, window, hsize, 1.0/5.0)
+			hasher.MapCGR(1, dna)
+
+			have := hasher.GetCGR(1)
+
+			if len(have) != len(want) {
+				t.Fatalf("matrix of side %d, want %d", len(have), len(want))
+			}
+
+			for i := range want {
+				for j := range want[i] {
+					if math.Abs(have[i][j]-want[i][j]) > 1e-12 {
+						t.Fatalf("FCGR[%d][%d] : have %f, want %f", i, j, have[i][j], want[i][j])
+					}
+				}
+			}
+
+			wantDCT, _ := go_fourier.DCT2D(want)
+
+			hasher.Hash(1, dna)
+
+			hash := hasher.GetHash(1)
+			for i := 0; i < hsize; i++ {
+				for j := 0; j < hsize; j++ {
+					if math.Abs(hash[i*hsize+j]-wantDCT[i][j]) > 1e-9 {
+						t.Fatalf("hash[%d][%d] : have %f, want %f", i, j, hash[i*hsize+j], wantDCT[i][j])
+					}
+				}
+			}
+		})
+	}
+}
+
+// naiveMapCGR is the reference MapCGR, mapping every substring of the genome with MapSubString2D.
+func naiveMapCGR(cgrmatrix CRGMatrix, dna string, window, maxExpansion int, normalizer float64) (nbKmers, nbExpandedKmers int) {
+
+	for i := range cgrmatrix {
+		for j := range cgrmatrix[i] {
+			cgrmatrix[i][j] = 0
+		}
+	}
+
+	for j := 0; j < len(dna)-window+1; j++ {
+		substring := dna[j : j+window]
+		x, y := MapSubString2D(substring)
+		if x != -1 {
+			cgrmatrix[x][y] += 1.0
+			nbKmers++
+		} else if maxExpansion > 0 {
+			if expandSubString2D(cgrmatrix, substring, maxExpansion) {
+				nbExpandedKmers++
+			}
+		} else {
+			j += y
+		}
+	}
+
+	max := maxDoubleSlice(cgrmatrix)
+	for i := range cgrmatrix {
+		for j := range cgrmatrix[i] {
+			cgrmatrix[i][j] = math.Pow(cgrmatrix[i][j]/max, normalizer)
+		}
+	}
+
+	return
+}
+
+func TestMapCGRRolling(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	// Genomes with IUPAC ambiguity codes, invalid characters and runs of invalid characters
+	genomes := []string{"", "ACG", "NNNNNNNNNN", "ACGTNACGTACGTTTTANNNNACGTACGTACGT"}
+	for i := 0; i < 4; i++ {
+		dna := []byte(randomGenome(prng, 3000))
+		for j := 0; j < 30; j++ {
+			dna[prng.Intn(len(dna))] = "RYKMSWBDHVNacgt-*"[prng.Intn(17)]
+		}
+		for j := 0; j < 5; j++ {
+			start := prng.Intn(len(dna) - 20)
+			for k := start; k < start+prng.Intn(20); k++ {
+				dna[k] = 'N'
+			}
+		}
+		genomes = append(genomes, string(dna))
+	}
+
+	for window := 1; window <= 8; window++ {
+		for _, maxExpansion := range []int{0, 16} {
+
+			hasher := NewDCTHasher(1, window, 1, 1.0/5.0)
+			hasher.SetAmbiguityExpansion(maxExpansion)
+
+			want := NewCRGMatrix(window)
+
+			for _, dna := range genomes {
+
+				hasher.MapCGR(0, dna)
+				nbKmers, nbExpandedKmers := naiveMapCGR(want, dna, window, maxExpansion, 1.0/5.0)
+
+				stats := hasher.GetAmbiguityStats(0)
+				if stats.NbKmers != nbKmers || stats.NbExpandedKmers != nbExpandedKmers {
+					t.Fatalf("window=%d, expansion=%d: have %d k-mers and %d expanded k-mers, want %d and %d",
+						window, maxExpansion, stats.NbKmers, stats.NbExpandedKmers, nbKmers, nbExpandedKmers)
+				}
+
+				have := hasher.GetCGR(0)
+				for i := range want {
+					for j := range want[i] {
+						if have[i][j] != want[i][j] && !(math.IsNaN(have[i][j]) && math.IsNaN(want[i][j])) {
+							t.Fatalf("window=%d, expansion=%d: FCGR (%d, %d) = %f, want %f", window, maxExpansion, i, j, have[i][j], want[i][j])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSubString2D(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	for i := 0; i < 100; i++ {
+		kmer := randomGenome(prng, 7)
+		x, y := MapSubString2D(kmer)
+		if have := SubString2D(x, y, 7); have != kmer {
+			t.Fatalf("SubString2D(MapSubString2D(%s)) = %s", kmer, have)
+		}
+	}
+}
+
+func BenchmarkMapCGR(b *testing.B) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 30000)
+
+	for window := 6; window <= 12; window++ {
+
+		hasher := NewDCTHasher(1, window, 1, 1.0/5.0)
+
+		b.Run(fmt.Sprintf("Rolling/window=%d", window), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hasher.MapCGR(0, dna)
+			}
+		})
+
+		b.Run(fmt.Sprintf("Naive/window=%d", window), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				naiveMapCGR(hasher.cgrmatrix[0], dna, window, 0, 1.0/5.0)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package preprocessing
+
+import (
+	"math"
+	"sort"
+)
+
+// PrunedDCTII computes only the first h outputs of the orthonormal DCTII of size n, as the product
+// with the h x n matrix of the DCTII. It costs O(n*h) instead of O(n log n) for the full transform,
+// and O(nnz*h) for sparse inputs, which makes it practical for the FCGR matrices of large windows.
+type PrunedDCTII struct {
+	n, h int
+	cos  [][]float64
+}
+
+// NewPrunedDCTII creates a new PrunedDCTII computing the first h outputs of the DCTII of size n.
+func NewPrunedDCTII(n, h int) *PrunedDCTII {
+
+	if h > n {
+		panic("h larger than n")
+	}
+
+	cos := make([][]float64, h)
+	for u := range cos {
+		cos[u] = make([]float64, n)
+		for x := range cos[u] {
+			cos[u][x] = DCTIIBasis(n, u, x)
+		}
+	}
+
+	return &PrunedDCTII{n: n, h: h, cos: cos}
+}
+
+// DCTIIBasis returns the x-th value s_u * cos(pi * (2x+1) * u / 2n) of the u-th basis vector of the orthonormal
+// DCTII of size n, the angle being reduced modulo 2pi (4n) : the u-th DCTII coefficient of a vector v is the sum
+// of DCTIIBasis(n, u, x) * v[x].
+func DCTIIBasis(n, u, x int) float64 {
+
+	scaling := math.Sqrt(2 / float64(n))
+	if u == 0 {
+		scaling = math.Sqrt(1 / float64(n))
+	}
+
+	k := ((2*x + 1) * u) % (4 * n)
+
+	return scaling * math.Cos(math.Pi*float64(k)/float64(2*n))
+}
+
+// Transform1D sets out[u] to the u-th coefficient of the DCTII of in, for u < len(out) <= h.
+func (dct *PrunedDCTII) Transform1D(in, out []float64) {
+
+	if len(in) != dct.n || len(out) > dct.h {
+		panic("vector sizes do not match the PrunedDCTII parameters")
+	}
+
+	for u := range out {
+		var sum float64
+		for x, c := range dct.cos[u] {
+			sum += c * in[x]
+		}
+		out[u] = sum
+	}
+}
+
+// InverseTransform1D sets out to the DCTIII of the vector whose first len(in) <= h coefficients are in and
+// the others are zero, which is the vector reconstructed from its first len(in) DCTII coefficients.
+func (dct *PrunedDCTII) InverseTransform1D(in, out []float64) {
+
+	if len(in) > dct.h || len(out) != dct.n {
+		panic("vector sizes do not match the PrunedDCTII parameters")
+	}
+
+	for x := range out {
+		out[x] = 0
+	}
+
+	for u, c := range in {
+		for x, cos := range dct.cos[u] {
+			out[x] += c * cos
+		}
+	}
+}
+
+// Transform2DSparse sets out[u][v] to the (u, v) coefficient of the 2D DCTII of the n x n matrix whose coefficients
+// are given by the entries and are equal to background elsewhere, for u < len(out) <= h and v < len(out[0]) <= h.
+// The entries must be sorted by row and distinct. tmp is a buffer of size at least len(out[0]).
+//
+// The matrix is background times the all-ones matrix, whose DCTII is n * background at (0, 0) and zero elsewhere,
+// plus the sparse matrix of the entries minus background.
+func (dct *PrunedDCTII) Transform2DSparse(entries []SparseEntry, background float64, out [][]float64, tmp []float64) {
+
+	for u := range out {
+		for v := range out[u] {
+			out[u][v] = 0
+		}
+	}
+
+	if len(out) == 0 {
+		return
+	}
+
+	cols := len(out[0])
+	tmp = tmp[:cols]
+
+	for start := 0; start < len(entries); {
+
+		// DCTII of the row x along the columns
+		x := entries[start].X
+		for v := range tmp {
+			tmp[v] = 0
+		}
+
+		end := start
+		for ; end < len(entries) && entries[end].X == x; end++ {
+			y, value := entries[end].Y, entries[end].Value-background
+			for v := range tmp {
+				tmp[v] += value * dct.cos[v][y]
+			}
+		}
+
+		// DCTII along the rows
+		for u := range out {
+			c := dct.cos[u][x]
+			row := out[u]
+			for v, t := range tmp {
+				row[v] += c * t
+			}
+		}
+
+		start = end
+	}
+
+	if cols > 0 {
+		out[0][0] += background * float64(dct.n)
+	}
+}
+
+// SparseEntry is a non-zero coefficient of a sparse FCGR matrix.
+type SparseEntry struct {
+	X, Y  int
+	Value float64
+}
+
+type sparseEntries []SparseEntry
+
+func (s sparseEntries) Len() int      { return len(s) }
+func (s sparseEntries) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sparseEntries) Less(i, j int) bool {
+	return s[i].X < s[j].X || (s[i].X == s[j].X && s[i].Y < s[j].Y)
+}
+
+// SparseDCTHasher is a DCTHasher for large windows (10 to 20) : it stores the FCGR matrix as the list of its
+// non-zero coefficients, which are at most as many as the k-mers of the genome instead of 4^window, and computes
+// only the selected DCTII coefficients with a PrunedDCTII. For a positive normalizer, its hashes are equal
+// (up to the floating point rounding) to the hashes of the DCTHasher with the same parameters.
+type SparseDCTHasher struct {
+	nbGo          int
+	window        int
+	normalizer    float64
+	maxExpansion  int
+	strand        string
+	rcTable       []int
+	normalization string
+	idf           *IDF
+	empty         []float64
+	coefficients  [][2]int
+	dct           *PrunedDCTII
+	entries       [][]SparseEntry
+	block         [][][]float64
+	tmp           [][]float64
+	cgrhash       []DCTHash
+	stats         []AmbiguityStats
+}
+
+// NewSparseDCTHasher creates a new SparseDCTHasher with nbGo workers, whose hash is made of the DCTII
+// coefficients (row, column) of the FCGR matrix, in that order.
+func NewSparseDCTHasher(nbGo, window int, coefficients [][2]int, normalizer float64) *SparseDCTHasher {
+
+	if len(coefficients) == 0 {
+		panic("empty coefficient mask")
+	}
+
+	var rows, cols int
+	for _, c := range coefficients {
+		if c[0] >= 1<<window || c[1] >= 1<<window {
+			panic("coefficient outside of the FCGR matrix")
+		}
+		if c[0]+1 > rows {
+			rows = c[0] + 1
+		}
+		if c[1]+1 > cols {
+			cols = c[1] + 1
+		}
+	}
+
+	h := rows
+	if cols > h {
+		h = cols
+	}
+
+	block := make([][][]float64, nbGo)
+	tmp := make([][]float64, nbGo)
+	hash := make([]DCTHash, nbGo)
+	for i := range block {
+		block[i] = make([][]float64, rows)
+		for j := range block[i] {
+			block[i][j] = make([]float64, cols)
+		}
+		tmp[i] = make([]float64, cols)
+		hash[i] = make([]float64, len(coefficients))
+	}
+
+	return &SparseDCTHasher{
+		nbGo:          nbGo,
+		window:        window,
+		normalizer:    normalizer,
+		strand:        StrandForward,
+		normalization: NormalizationPower,
+		empty:         make([]float64, nbGo),
+		coefficients:  coefficients,
+		dct:           NewPrunedDCTII(1<<window, h),
+		entries:       make([][]SparseEntry, nbGo),
+		block:         block,
+		tmp:           tmp,
+		cgrhash:       hash,
+		stats:         make([]AmbiguityStats, nbGo)}
+}
+
+// SetAmbiguityExpansion enables the IUPAC ambiguity aware mapping if maxExpansion > 0 (see DCTHasher.SetAmbiguityExpansion).
+func (h *SparseDCTHasher) SetAmbiguityExpansion(maxExpansion int) {
+	h.maxExpansion = maxExpansion
+}
+
+// SetStrand sets the k-mers counted in the FCGR matrix (see DCTHasher.SetStrand).
+func (h *SparseDCTHasher) SetStrand(strand string) {
+	switch strand {
+	case StrandForward:
+		h.rcTable = nil
+	case StrandCanonical, StrandBoth:
+		h.rcTable = reverseComplementTable(h.window)
+	default:
+		panic("unknown strand mode " + strand)
+	}
+	h.strand = strand
+}
+
+// SetNormalization sets the normalization of the k-mer counts of the FCGR matrix (see DCTHasher.SetNormalization).
+func (h *SparseDCTHasher) SetNormalization(normalization string, idf *IDF) {
+	if err := checkNormalization(normalization, h.window, idf); err != nil {
+		panic(err)
+	}
+	h.normalization = normalization
+	h.idf = idf
+}
+
+func (h *SparseDCTHasher) Hash(worker int, dna string) {
+
+	h.MapCGR(worker, dna)
+
+	// The empty cells of the FCGR matrix have the normalized value of a zero count
+	block := h.block[worker]
+	h.dct.Transform2DSparse(h.entries[worker], h.empty[worker], block, h.tmp[worker])
+
+	hash := h.cgrhash[worker]
+	for i, c := range h.coefficients {
+		hash[i] = block[c[0]][c[1]]
+	}
+}
+
+// add adds the k-mer (x, y) with the given weight to the entries, according to the strand mode.
+func (h *SparseDCTHasher) add(entries []SparseEntry, x, y int, weight float64) []SparseEntry {
+
+	if h.strand == StrandForward {
+		return append(entries, SparseEntry{x, y, weight})
+	}
+
+	rx, ry := h.rcTable[x], h.rcTable[y]
+
+	if h.strand == StrandBoth {
+		return append(entries, SparseEntry{x, y, weight}, SparseEntry{rx, ry, weight})
+	}
+
+	if rx < x || (rx == x && ry < y) {
+		x, y = rx, ry
+	}
+
+	return append(entries, SparseEntry{x, y, weight})
+}
+
+// MapCGR computes the non-zero coefficients of the normalized FCGR matrix of the genome, sorted by row and column.
+func (h *SparseDCTHasher) MapCGR(worker int, dna string) {
+
+	window := h.window
+	entries := h.entries[worker][:0]
+
+	stats := &h.stats[worker]
+	stats.countBases(dna)
+	stats.NbKmers = 0
+	stats.NbExpandedKmers = 0
+
+	// Rolling k-mer index (see DCTHasher.MapCGR)
+	var x, y, run int
+	msb := uint(window - 1)
+	for i := 0; i < len(dna); i++ {
+
+		if b := baseCodes[dna[i]]; b >= 0 {
+			x = (x >> 1) | int(b>>1)<<msb
+			y = (y >> 1) | int(b&1)<<msb
+			run++
+		} else {
+			run = 0
+		}
+
+		if run >= window {
+			entries = h.add(entries, x, y, 1.0)
+			stats.NbKmers++
+		} else if h.maxExpansion > 0 && i >= window-1 {
+			if expandSubString(dna[i-window+1:i+1], h.maxExpansion, func(x, y int, weight float64) {
+				entries = h.add(entries, x, y, weight)
+			}) {
+				stats.NbExpandedKmers++
+			}
+		}
+	}
+
+	stats.NbDroppedKmers = 0
+	if len(dna) >= window {
+		stats.NbDroppedKmers = len(dna) - window + 1 - stats.NbKmers - stats.NbExpandedKmers
+	}
+
+	// Merges the counts of the same k-mers
+	sort.Sort(sparseEntries(entries))
+
+	n := 0
+	for i := range entries {
+		if n > 0 && entries[n-1].X == entries[i].X && entries[n-1].Y == entries[i].Y {
+			entries[n-1].Value += entries[i].Value
+		} else {
+			entries[n] = entries[i]
+			n++
+		}
+	}
+	entries = entries[:n]
+
+	h.empty[worker] = normalizeEntries(entries, 1<<window, window, h.normalization, h.normalizer, h.idf)
+
+	h.entries[worker] = entries
+}
+
+// GetEntries returns the non-zero coefficients of the normalized FCGR matrix of the last genome mapped by the worker.
+func (h *SparseDCTHasher) GetEntries(worker int) []SparseEntry {
+	return h.entries[worker]
+}
+
+// GetAmbiguityStats returns the ambiguity statistics of the last genome mapped by the worker.
+func (h *SparseDCTHasher) GetAmbiguityStats(worker int) AmbiguityStats {
+	return h.stats[worker]
+}
+
+// GetEmpty returns the normalized value of the empty cells of the FCGR matrix of the last genome mapped by the
+// worker (the value of a zero count), which is only non-zero for the CLR.
+func (h *SparseDCTHasher) GetEmpty(worker int) float64 {
+	return h.empty[worker]
+}
+
+// Window returns the length of the k-mers of the FCGR matrix, which is of size 2^window x 2^window.
+func (h *SparseDCTHasher) Window() int {
+	return h.window
+}
+
+// Coefficients returns the (row, column) indexes of the DCTII coefficients forming the hash, in that order.
+func (h *SparseDCTHasher) Coefficients() [][2]int {
+	return h.coefficients
+}
+
+func (h *SparseDCTHasher) GetHash(worker int) []float64 {
+	return h.cgrhash[worker]
+}
+
+func (h *SparseDCTHasher) NbWorkers() int {
+	return h.nbGo
+}
+
+func (h *SparseDCTHasher) HashSize() int {
+	return len(h.coefficients)
+}
+
+func (h *SparseDCTHasher) Name() string {
+	return "dct-sparse"
+}
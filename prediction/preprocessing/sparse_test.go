@@ -0,0 +1,171 @@
+package preprocessing
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/ardabasaran/go-fourier"
+)
+
+func TestPrunedDCTII(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	n, h := 64, 16
+
+	vec := make([]float64, n)
+	for i := range vec {
+		vec[i] = prng.Float64()
+	}
+
+	want, _ := go_fourier.DCT1D(vec)
+
+	have := make([]float64, h)
+	NewPrunedDCTII(n, h).Transform1D(vec, have)
+
+	for i := range have {
+		if math.Abs(have[i]-want[i]) > 1e-10 {
+			t.Fatalf("coefficient %d : have %f, want %f", i, have[i], want[i])
+		}
+	}
+}
+
+func TestSparseDCTHasher(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	dna := []byte(randomGenome(prng, 10000))
+	for j := 0; j < 30; j++ {
+		dna[prng.Intn(len(dna))] = "RYKMSWN-"[prng.Intn(8)]
+	}
+
+	for _, window := range []int{4, 5, 6, 7} {
+		for _, mask := range []string{MaskSquare, MaskZigZag, MaskTriangle} {
+			for _, strand := range []string{StrandForward, StrandCanonical, StrandBoth} {
+				for _, maxExpansion := range []int{0, 16} {
+
+					params := ExtractorParameters{
+						Window:             window,
+						HashSqrtSize:       8,
+						HashSize:           36,
+						Normalizer:         1.0 / 5.0,
+						AmbiguityExpansion: maxExpansion,
+						Strand:             strand,
+						Mask:               mask,
+					}
+
+					dense, err := NewFeatureExtractorByName("dct", 1, params)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					sparse, err := NewFeatureExtractorByName("dct-sparse", 1, params)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					name := fmt.Sprintf("window=%d/mask=%s/strand=%s/expansion=%d", window, mask, strand, maxExpansion)
+
+					dense.Hash(0, string(dna))
+					sparse.Hash(0, string(dna))
+
+					for i := range dense.GetHash(0) {
+						if math.Abs(dense.GetHash(0)[i]-sparse.GetHash(0)[i]) > 1e-9 {
+							t.Fatalf("%s: coefficient %d : have %f, want %f", name, i, sparse.GetHash(0)[i], dense.GetHash(0)[i])
+						}
+					}
+
+					if sparse.(*SparseDCTHasher).GetAmbiguityStats(0) != dense.(*DCTHasher).GetAmbiguityStats(0) {
+						t.Fatalf("%s: ambiguity statistics do not match", name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSparseEntries(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(1))
+	dna := randomGenome(prng, 3000)
+
+	params := ExtractorParameters{Window: 5, HashSqrtSize: 4, HashSize: 16, Normalizer: 1.0 / 5.0, Normalization: NormalizationCLR, Mask: MaskSquare}
+
+	dense, err := NewFeatureExtractorByName("dct", 1, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sparse, err := NewFeatureExtractorByName("dct-sparse", 1, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, s := dense.(*DCTHasher), sparse.(*SparseDCTHasher)
+
+	d.MapCGR(0, dna)
+	s.MapCGR(0, dna)
+
+	// The entries and the empty cells, which have the non-zero CLR of a zero count, form the dense normalized FCGR matrix
+	want := d.GetCGR(0)
+	have := NewCRGMatrix(params.Window)
+	for x := range have {
+		for y := range have[x] {
+			have[x][y] = s.GetEmpty(0)
+		}
+	}
+
+	for _, e := range s.GetEntries(0) {
+		have[e.X][e.Y] = e.Value
+	}
+
+	for x := range want {
+		for y := range want[x] {
+			if math.Abs(have[x][y]-want[x][y]) > 1e-12 {
+				t.Fatalf("FCGR (%d, %d) : have %f, want %f", x, y, have[x][y], want[x][y])
+			}
+		}
+	}
+
+	if s.GetEmpty(0) == 0 {
+		t.Fatal("zero CLR of the empty cells")
+	}
+
+	// DCTIIBasis is the basis of the DCTII
+	vec := make([]float64, 8)
+	for x := range vec {
+		vec[x] = prng.NormFloat64()
+	}
+
+	coefficients := append([]float64{}, vec...)
+	NewParallelDCTII(1, 8).Transform1D(0, coefficients)
+
+	for u := range coefficients {
+		var sum float64
+		for x := range vec {
+			sum += DCTIIBasis(8, u, x) * vec[x]
+		}
+		if math.Abs(sum-coefficients[u]) > 1e-12 {
+			t.Fatalf("coefficient %d : have %f, want %f", u, sum, coefficients[u])
+		}
+	}
+}
+
+func BenchmarkSparseDCTHasher(b *testing.B) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 30000)
+
+	for window := 6; window <= 14; window++ {
+
+		hasher := NewSparseDCTHasher(1, window, SquareCoefficients(16), 1.0/5.0)
+
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				hasher.Hash(0, dna)
+			}
+		})
+	}
+}
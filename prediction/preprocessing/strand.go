@@ -0,0 +1,86 @@
+package preprocessing
+
+// Strand modes selecting which k-mers are counted in the FCGR matrix of the DCTHasher
+const (
+	StrandForward   = "forward"   // K-mers of the forward strand only
+	StrandCanonical = "canonical" // Canonical k-mers, the smaller of a k-mer and its reverse complement
+	StrandBoth      = "both"      // K-mers of both strands
+)
+
+// iupacComplements maps each IUPAC nucleotide code to the code of the complementary bases.
+var iupacComplements = [256]byte{
+	'A': 'T', 'C': 'G', 'G': 'C', 'T': 'A',
+	'R': 'Y', 'Y': 'R', 'K': 'M', 'M': 'K', 'S': 'S', 'W': 'W',
+	'B': 'V', 'V': 'B', 'D': 'H', 'H': 'D', 'N': 'N',
+}
+
+// ReverseComplement returns the reverse complement of the genome. Characters that
+// are not IUPAC nucleotide codes are mapped to N.
+func ReverseComplement(dna string) string {
+	rc := make([]byte, len(dna))
+	for i := 0; i < len(dna); i++ {
+		c := iupacComplements[dna[len(dna)-1-i]]
+		if c == 0 {
+			c = 'N'
+		}
+		rc[i] = c
+	}
+	return string(rc)
+}
+
+// reverseComplementTable returns the table mapping a coordinate of the FCGR matrix of
+// the given window to the coordinate of the reverse complement : the bit i of a coordinate
+// is the bit of the i-th base of the k-mer, and complementing a base flips both of its bits
+// (A = (0, 0) <-> T = (1, 1), C = (0, 1) <-> G = (1, 0)).
+// The reverse complement of the k-mer at (x, y) is thus at (table[x], table[y]).
+func reverseComplementTable(window int) (table []int) {
+	mask := 1<<window - 1
+	table = make([]int, 1<<window)
+	for x := range table {
+		var r int
+		for i := 0; i < window; i++ {
+			r |= ((x >> i) & 1) << (window - 1 - i)
+		}
+		table[x] = r ^ mask
+	}
+	return
+}
+
+// applyStrand merges the counts of the forward k-mers of the FCGR matrix according to the strand mode.
+// A k-mer is canonical if its coordinate (x, y) is smaller than the coordinate of its reverse complement
+// in the order (x, y) -> x * 2^window + y.
+func applyStrand(cgrmatrix CRGMatrix, table []int, strand string) {
+
+	n := len(cgrmatrix)
+
+	for x := range cgrmatrix {
+		for y := range cgrmatrix[x] {
+
+			rx, ry := table[x], table[y]
+
+			key, rkey := x*n+y, rx*n+ry
+
+			if key > rkey {
+				continue
+			}
+
+			// Reverse palindromes
+			if key == rkey {
+				if strand == StrandBoth {
+					cgrmatrix[x][y] *= 2
+				}
+				continue
+			}
+
+			sum := cgrmatrix[x][y] + cgrmatrix[rx][ry]
+
+			cgrmatrix[x][y] = sum
+
+			if strand == StrandBoth {
+				cgrmatrix[rx][ry] = sum
+			} else {
+				cgrmatrix[rx][ry] = 0
+			}
+		}
+	}
+}
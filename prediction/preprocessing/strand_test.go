@@ -0,0 +1,109 @@
+package preprocessing
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestReverseComplement(t *testing.T) {
+	if have, want := ReverseComplement("AACGTRYKMSWBDHVN-"), "NNBDHVWSKMRYACGTT"; have != want {
+		t.Errorf("have %s, want %s", have, want)
+	}
+}
+
+func TestStrandInvariance(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+
+	// Genome with a few IUPAC ambiguity codes
+	dna := []byte(randomGenome(prng, 5000))
+	for i := 0; i < 20; i++ {
+		dna[prng.Intn(len(dna))] = "RYKMSWN"[prng.Intn(7)]
+	}
+
+	forward := string(dna)
+	reverse := ReverseComplement(forward)
+
+	for _, window := range []int{5, 6} {
+		for _, strand := range []string{StrandForward, StrandCanonical, StrandBoth} {
+			for _, maxExpansion := range []int{0, 16} {
+
+				hasher := NewDCTHasher(2, window, 8, 1.0/5.0)
+				hasher.SetAmbiguityExpansion(maxExpansion)
+				hasher.SetStrand(strand)
+
+				hasher.Hash(0, forward)
+				hasher.Hash(1, reverse)
+
+				var maxDiff float64
+				for i := range hasher.GetHash(0) {
+					maxDiff = math.Max(maxDiff, math.Abs(hasher.GetHash(0)[i]-hasher.GetHash(1)[i]))
+				}
+
+				if strand == StrandForward && maxDiff < 1e-3 {
+					t.Errorf("window=%d, strand=%s, expansion=%d: the hashes should differ", window, strand, maxExpansion)
+				}
+
+				if strand != StrandForward && maxDiff > 1e-12 {
+					t.Errorf("window=%d, strand=%s, expansion=%d: the hashes differ by %g", window, strand, maxExpansion, maxDiff)
+				}
+			}
+		}
+	}
+}
+
+func TestStrandCounts(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(0))
+	dna := randomGenome(prng, 3000)
+	window := 4
+
+	// Naive counts of the k-mers of both strands, as strings
+	forward := map[string]float64{}
+	both := map[string]float64{}
+	canonical := map[string]float64{}
+	for i := 0; i < len(dna)-window+1; i++ {
+		kmer := dna[i : i+window]
+		rc := ReverseComplement(kmer)
+		forward[kmer]++
+		both[kmer]++
+		both[rc]++
+		x, y := MapSubString2D(kmer)
+		rx, ry := MapSubString2D(rc)
+		if x<<window+y <= rx<<window+ry {
+			canonical[kmer]++
+		} else {
+			canonical[rc]++
+		}
+	}
+
+	for strand, counts := range map[string]map[string]float64{StrandForward: forward, StrandCanonical: canonical, StrandBoth: both} {
+
+		hasher := NewDCTHasher(1, window, 4, 1)
+		hasher.SetStrand(strand)
+		hasher.MapCGR(0, dna)
+
+		// MapCGR normalizes by the maximum count
+		var max float64
+		for _, c := range counts {
+			max = math.Max(max, c)
+		}
+
+		cgr := hasher.GetCGR(0)
+		for x := range cgr {
+			for y := range cgr[x] {
+
+				// Decodes the k-mer of the coordinate (x, y)
+				kmer := make([]byte, window)
+				for i := range kmer {
+					kmer[i] = "ACGT"[((x>>i)&1)<<1|(y>>i)&1]
+				}
+
+				if math.Abs(cgr[x][y]-counts[string(kmer)]/max) > 1e-12 {
+					t.Fatalf("strand=%s: k-mer %s has frequency %f, want %f", strand, kmer, cgr[x][y], counts[string(kmer)]/max)
+				}
+			}
+		}
+	}
+}
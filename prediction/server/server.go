@@ -4,12 +4,19 @@ import (
 	"github.com/ldsec/idash21_Task2/prediction/lib"
 	"github.com/ldsec/idash21_Task2/prediction/predictor"
 	"github.com/ldsec/lattigo/v2/ckks"
+	"github.com/ldsec/lattigo/v2/ring"
+	"log"
 	"sync"
 )
 
 type Server struct {
 	params    *ckks.Parameters
+	baseRing  *ring.Ring
 	predictor *predictor.Predictor
+	nbWorkers int
+	chunkSize int
+	pool      []*ring.Poly
+	partial   []*ckks.Ciphertext
 }
 
 func NewServer() (server *Server) {
@@ -17,31 +24,153 @@ func NewServer() (server *Server) {
 	predictor := predictor.NewPredictor(params)
 	predictor.LoadModel(lib.ModelPath)
 	//predictor.PrintModel()
-	return &Server{params: params, predictor: predictor}
+
+	baseRing, err := ring.NewRing(params.N(), params.Qi())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server = &Server{params: params, baseRing: baseRing, predictor: predictor}
+	server.SetWorkers(lib.NbPredictionWorkers, lib.PredictionChunkSize)
+	return
+}
+
+// SetWorkers sets the size of the worker pool and the number of hash coefficients
+// processed by each dot product task.
+func (s *Server) SetWorkers(nbWorkers, chunkSize int) {
+
+	if nbWorkers < 1 || chunkSize < 1 {
+		panic("the number of workers and the chunk size must be positive")
+	}
+
+	s.nbWorkers = nbWorkers
+	s.chunkSize = chunkSize
+
+	// Per worker accumulators, reused across all the tasks
+	s.pool = make([]*ring.Poly, nbWorkers)
+	s.partial = make([]*ckks.Ciphertext, nbWorkers)
+	for i := range s.pool {
+		s.pool[i] = s.baseRing.NewPoly()
+		s.partial[i] = ckks.NewCiphertext(s.params, 1, 0, lib.HashScale*lib.ModelScale)
+	}
 }
 
 func (s *Server) PredictBatch(batchIndex int) {
-	// Unmarchal batch to predict
-	ciphertexts := lib.UnmarshalBatchSeeded32(lib.EncryptedBatchIndexPath(batchIndex))
+	s.PredictBatches([]int{batchIndex})
+}
+
+// PredictBatches evaluates the prediction of the given batches, lib.NbBatchesPerPass batches at a time.
+// The dot products are split in tasks (batch, class, chunk of the hash coefficients) that are
+// evaluated by the worker pool. Each worker computes the partial sum of its task in its own
+// accumulator, which is then reduced on the result of the (batch, class).
+func (s *Server) PredictBatches(batchIndices []int) {
+
+	for start := 0; start < len(batchIndices); start += lib.NbBatchesPerPass {
+
+		end := start + lib.NbBatchesPerPass
+		if end > len(batchIndices) {
+			end = len(batchIndices)
+		}
+
+		s.predictPass(batchIndices[start:end])
+	}
+}
+
+type task struct {
+	batch, class, start, end int
+}
+
+func (s *Server) predictPass(batchIndices []int) {
+
+	nbBatches := len(batchIndices)
+
+	// Unmarchal batches to predict
+	ciphertexts := make([][]*ckks.Ciphertext, nbBatches)
+	s.run(nbBatches, func(worker, i int) {
+		ciphertexts[i] = lib.UnmarshalBatchSeeded32(lib.EncryptedBatchIndexPath(batchIndices[i]))
+	})
+
+	for i := range ciphertexts {
+		if len(ciphertexts[i]) != s.predictor.HashSize() {
+			log.Fatalf("batch %d has %d ciphertexts but the model expects hashes of size %d", batchIndices[i], len(ciphertexts[i]), s.predictor.HashSize())
+		}
+	}
 
 	// Allocates results
-	pred := make([]*ckks.Ciphertext, lib.NbStrains)
+	pred := make([][]*ckks.Ciphertext, nbBatches)
+	locks := make([][]sync.Mutex, nbBatches)
 	for i := range pred {
-		pred[i] = ckks.NewCiphertext(s.params, 1, 0, lib.HashScale*lib.ModelScale)
+		pred[i] = make([]*ckks.Ciphertext, lib.NbStrains)
+		for j := range pred[i] {
+			pred[i][j] = ckks.NewCiphertext(s.params, 1, 0, lib.HashScale*lib.ModelScale)
+		}
+		locks[i] = make([]sync.Mutex, lib.NbStrains)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(lib.NbStrains)
-	for i := 0; i < lib.NbStrains; i++ {
+	// Splits the dot products in tasks
+	tasks := []task{}
+	for i := range ciphertexts {
+		for j := 0; j < lib.NbStrains; j++ {
+			for k := 0; k < len(ciphertexts[i]); k += s.chunkSize {
+				end := k + s.chunkSize
+				if end > len(ciphertexts[i]) {
+					end = len(ciphertexts[i])
+				}
+				tasks = append(tasks, task{batch: i, class: j, start: k, end: end})
+			}
+		}
+	}
 
-		go func(worker int, pred *ckks.Ciphertext) {
-			s.predictor.DotProduct(ciphertexts, worker, pred)
-			wg.Done()
-		}(i, pred[i])
+	s.run(len(tasks), func(worker, i int) {
 
-	}
-	wg.Wait()
+		t := tasks[i]
+
+		partial := s.partial[worker]
+		partial.Value()[0].Zero()
+		partial.Value()[1].Zero()
+
+		s.predictor.DotProductRange(ciphertexts[t.batch], t.class, t.start, t.end, s.pool[worker], partial)
+
+		// Partial sum reduction
+		res := pred[t.batch][t.class]
+		locks[t.batch][t.class].Lock()
+		s.baseRing.Add(res.Value()[0], partial.Value()[0], res.Value()[0])
+		s.baseRing.Add(res.Value()[1], partial.Value()[1], res.Value()[1])
+		locks[t.batch][t.class].Unlock()
+	})
 
 	// Marchal prediction
-	lib.MarshalBatch32(lib.EncryptedBatchPredIndexPath(batchIndex), pred)
+	s.run(nbBatches, func(worker, i int) {
+		for j := range pred[i] {
+			s.predictor.AddBias(j, pred[i][j])
+		}
+		lib.MarshalBatch32(lib.EncryptedBatchPredIndexPath(batchIndices[i]), pred[i])
+	})
+}
+
+// run evaluates f(worker, i) for i in [0, n) on the worker pool.
+func (s *Server) run(n int, f func(worker, i int)) {
+
+	jobs := make(chan int, n)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	nbWorkers := s.nbWorkers
+	if nbWorkers > n {
+		nbWorkers = n
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(nbWorkers)
+	for g := 0; g < nbWorkers; g++ {
+		go func(worker int) {
+			for i := range jobs {
+				f(worker, i)
+			}
+			wg.Done()
+		}(g)
+	}
+	wg.Wait()
 }
@@ -1,36 +1,53 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/binary"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/eval"
 	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
 	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
-	"log"
+	"github.com/ldsec/idash21_Task2/training/trainer"
+	"github.com/ldsec/lattigo/v2/ckks"
 	"math"
 	"os"
-	"sync"
 	"time"
 )
 
 func main() {
 
+	// "go run main.go train" trains the model on the samples previously processed in X.binary and Y.binary
+	if len(os.Args) > 1 && os.Args[1] == "train" {
+		dataset, err := trainer.LoadDataset("./X.binary", "./Y.binary", lib.HashSize)
+		if err != nil {
+			panic(err)
+		}
+		info, err := predictor.LoadModelInfo("./" + predictor.ModelInfoFile)
+		if err != nil {
+			panic(err)
+		}
+		Train(dataset, info)
+		return
+	}
+
 	var err error
 
 	// Preprocessing for model training
 
 	nbSamples := 8000
-	hashsqrtsize := lib.HashSqrtSize
 	window := lib.Window         // SEE **** WARNING *****
 	normalizer := lib.Normalizer // applies x -> x^normalizer to the FCGR probability matrix
-	nbGo := 4
+	nbGo := lib.NbHashingWorkers
 
 	fmt.Printf("Pre-processing\n")
 	fmt.Printf("Samples : %d\n", nbSamples)
+	fmt.Printf("Feature extractor : %s\n", lib.FeatureExtractor)
 	fmt.Printf("Window : %d\n", window)
 	fmt.Printf("Normalizer : x^%f\n", normalizer)
-	fmt.Printf("Hashs Size : %d\n", hashsqrtsize*hashsqrtsize)
+	fmt.Printf("Hashs Size : %d\n", lib.HashSize)
 
 	// Writes the processing parameters for the .py file training
 	var fwParams *os.File
@@ -38,29 +55,66 @@ func main() {
 		panic(err)
 	}
 
-	fwParams.Write([]byte{uint8(hashsqrtsize)})
+	// Dimension of the hashes
+	buffParams := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buffParams, uint32(lib.HashSize))
+	fwParams.Write(buffParams)
 	fwParams.Close()
 
-	// ****** WARNING *****
+	ctx := context.Background()
 
-	// If choosing this hasher, then the FCGR matrix will be of size  **** 4^window ****
-	// For this option, window can be either even or odd
-	hasher := preprocessing.NewDCTHasher(nbGo, window, hashsqrtsize, normalizer)
+	// Computes the document frequencies of the k-mers of the samples for the tfidf normalization,
+	// which must then be copied in the model folder along with the weights
+	if lib.Normalization == preprocessing.NormalizationTFIDF {
+		fmt.Printf("Computing the background k-mer frequencies\n")
+		lib.BackgroundPath = "./background.csv"
+		LearnBackground(ctx, "./Challenge.fa", nbSamples, lib.BackgroundPath)
+	}
 
-	// If choosing this hasher then the FCGR matrix will of of size **** 2^(window+2) ****
-	// For this case window must ONLY be even
-	//hasher := preprocessing.NewDCTHasherV2(nbGo, window, hashsqrtsize, normalizer)
+	// Learns the HashSize DCTII coefficients of largest variance across the samples,
+	// which must then be copied in the model folder along with the weights
+	if lib.FeatureExtractor == "dct" && lib.CoefficientMask == preprocessing.MaskFile {
+		fmt.Printf("Learning the coefficient mask\n")
+		lib.CoefficientMaskPath = "./coefficients.csv"
+		LearnCoefficientMask(ctx, "./Challenge.fa", nbSamples, lib.HashSize, lib.CoefficientMaskPath)
+	}
 
-	file, err := os.Open("./Challenge.fa")
+	// ****** WARNING *****
+
+	// The feature extractor is selected by lib.FeatureExtractor
+	// "dct"    : the FCGR matrix will be of size  **** 4^window ****
+	//            For this option, window can be either even or odd
+	//            The DCTII coefficients forming the hash are selected by lib.CoefficientMask
+	//            and the k-mer counts are normalized as selected by lib.Normalization
+	// "dct-sparse" : same hashes as "dct" without the dense 4^window FCGR matrix, for windows 10 to 20
+	// "dct-v2" : the FCGR matrix will be of size **** 2^(ceil(window/2)+1) x 2^(ceil(window/2)+1) ****
+	//            For this option, window must be at least 5
+	hasher := preprocessing.NewFeatureExtractor(nbGo)
+
+	// Records the feature extractor with the model, the predictor checks
+	// that it matches the feature extractor of the client
+	extractor, err := lib.ConfiguredExtractorInfo()
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
+	}
+	info := predictor.ModelInfo{Extractor: extractor}
+	if err = info.Save("./" + predictor.ModelInfoFile); err != nil {
+		panic(err)
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	// Labels of the samples, the lineages of the genomes being given by lib.MetadataPath or by their ID
+	labeler, err := lib.ConfiguredLabeler()
+	if err != nil {
+		panic(err)
+	}
 
-	buffX := make([]byte, hashsqrtsize*hashsqrtsize*8)
-	buffY := make([]byte, nbGo)
+	counts := make([]int, labeler.Labels().Len())
+
+	// Reads the samples
+	records := preprocessing.ReadRecords(ctx, "./Challenge.fa", nbSamples)
+
+	buffX := make([]byte, hasher.HashSize()*8)
+	buffY := make([]byte, 1)
 
 	// Creates the files containing the processed samples
 	var fwX, fwY *os.File
@@ -87,81 +141,274 @@ func main() {
 	wY := csv.NewWriter(fwYCSV)
 	defer wY.Flush()
 
-	start := time.Now()
+	// Per-sample ambiguity statistics
+	var fwStatsCSV *os.File
+	if fwStatsCSV, err = os.Create("./ambiguity_stats.csv"); err != nil {
+		panic(err)
+	}
 
-	i := 0
-	dataX := make([]string, nbGo)
-	dataY := make([]string, nbGo)
-	dataCSV := make([]string, 256)
-	for scanner.Scan() {
+	wStats := csv.NewWriter(fwStatsCSV)
+	wStats.Write(preprocessing.AmbiguityStatsCSVHeader)
 
-		if i&1 == 0 {
-			dataY[(i>>1)%nbGo] = scanner.Text()
-			if i%200 == 0 {
-				fmt.Printf("\rProcessing samples: %4d/%d", i>>1, nbSamples)
-			}
-		}
+	start := time.Now()
 
-		if i&1 == 1 {
+	dataCSV := make([]string, hasher.HashSize())
 
-			dataX[(i>>1)%nbGo] = scanner.Text()
+	var nbProcessed int
 
-			if (i>>1)%nbGo == nbGo-1 {
+	dataset := &trainer.Dataset{}
 
-				var wg sync.WaitGroup
-				wg.Add(nbGo)
-				for g := 0; g < nbGo; g++ {
-					go func(worker int, strain string) {
-						hasher.MapCGR(worker, strain)
-						hasher.DCTII(worker)
-						hasher.Finalize(worker)
-						wg.Done()
-					}(g, dataX[g])
-				}
-				wg.Wait()
+	// Hashes the samples with all the workers of the hasher, the results are received in the order of the file
+	for res := range preprocessing.NewWorkerPool(hasher).HashAll(ctx, records) {
 
-				for g := 0; g < nbGo; g++ {
-					hash := hasher.GetHash(g)
-					for i := range hash {
-						binary.LittleEndian.PutUint64(buffX[i<<3:(i+1)<<3], math.Float64bits(hash[i]))
+		if res.Err != nil {
+			panic(res.Err)
+		}
 
-						dataCSV[i] = fmt.Sprintf("%f", hash[i])
-					}
+		if res.Index%100 == 0 {
+			fmt.Printf("\rProcessing samples: %4d/%d", res.Index, nbSamples)
+		}
 
-					buffY[g] = uint8(MatchStrainNameToLabel(dataY[g]))
+		hash := res.Hash
+		for i := range hash {
+			binary.LittleEndian.PutUint64(buffX[i<<3:(i+1)<<3], math.Float64bits(hash[i]))
 
-					fwX.Write(buffX)
+			dataCSV[i] = fmt.Sprintf("%f", hash[i])
+		}
 
-					wX.Write(dataCSV)
-					wY.Write([]string{fmt.Sprintf("%d", int(buffY[g]))})
-				}
+		label, err := labeler.Label(res.ID)
+		if err != nil {
+			panic(err)
+		}
 
-				fwY.Write(buffY)
-			}
+		buffY[0] = uint8(label)
+		counts[label]++
 
-			if (i >> 1) == nbSamples {
-				break
-			}
+		fwX.Write(buffX)
+		fwY.Write(buffY)
+
+		wX.Write(dataCSV)
+		wY.Write([]string{fmt.Sprintf("%d", int(buffY[0]))})
+		if res.Stats != nil {
+			wStats.Write(res.Stats.CSVRecord(res.ID))
 		}
-		i++
+
+		dataset.X = append(dataset.X, hash)
+		dataset.Y = append(dataset.Y, int(buffY[0]))
+
+		nbProcessed++
 	}
 
 	fwX.Close()
 	fwY.Close()
 
-	fmt.Printf("\rProcessing samples: %4d/%d (%s)\n", nbSamples, nbSamples, time.Since(start))
+	wStats.Flush()
+	if err = wStats.Error(); err != nil {
+		panic(err)
+	}
+	fwStatsCSV.Close()
+
+	fmt.Printf("\rProcessing samples: %4d/%d (%s)\n", nbProcessed, nbSamples, time.Since(start))
+
+	for label, name := range labeler.Labels().Names() {
+		fmt.Printf("%-8s : %d samples\n", name, counts[label])
+	}
+
+	Train(dataset, info)
 }
 
-func MatchStrainNameToLabel(substring string) (label int) {
+// Train trains the linear model on the processed samples with the hyper-parameters of trainer.DefaultConfig,
+// and writes its weights (weights_layer_0 and bias_layer_0) and its description (model.json, the feature
+// extractor being given by info), which must then be copied in the model folder.
+// The threshold of the detection of the genomes of unknown lineages and the temperature of the probabilities
+// are fitted on the calibration samples, and the accuracies of the float, quantized and encrypted predictions,
+// the open-set metrics and the calibration are reported on the validation samples.
+func Train(dataset *trainer.Dataset, info predictor.ModelInfo) {
+
+	config := trainer.DefaultConfig()
+
+	if lib.QuantizationAwareTraining {
+		config.HashScale, config.ModelScale = lib.HashScale, lib.ModelScale
+		fmt.Printf("Quantization-aware training : HashScale %g, ModelScale %g\n", config.HashScale, config.ModelScale)
+	}
+
+	fmt.Printf("Training : %s, learning rate %g, batch size %d, L1 %g, L2 %g, validation split %.2f, calibration split %.2f\n",
+		config.Optimizer, config.LearningRate, config.BatchSize, config.L1, config.L2, config.ValidationSplit, config.CalibrationSplit)
+
+	start := time.Now()
+
+	res, err := trainer.Train(config, dataset, lib.NbStrains)
+	if err != nil {
+		panic(err)
+	}
+
+	best := res.Best()
+	fmt.Printf("Epochs : %d, best epoch : %d (%s)\n", len(res.History), res.BestEpoch+1, time.Since(start))
+	fmt.Printf("Training loss : %.4f, accuracy : %.4f\n", best.Loss, best.Accuracy)
+	fmt.Printf("Validation loss : %.4f, accuracy : %.4f\n", best.ValidationLoss, best.ValidationAccuracy)
+
+	if err = res.Model.Save("./"); err != nil {
+		panic(err)
+	}
+
+	// Float, quantized and encrypted accuracies of the model written on disk
+	params, err := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	if err != nil {
+		panic(err)
+	}
+
+	if err = info.Save("./" + predictor.ModelInfoFile); err != nil {
+		panic(err)
+	}
+
+	p := predictor.NewPredictor(params)
+	p.LoadModel("./")
 
-	strain := ""
-	for _, c := range substring[1:] {
-		if string(c) != "_" {
-			strain += string(c)
-		} else {
-			break
+	// The temperature and the open-set threshold are fitted on the calibration samples, and all the reports
+	// are computed on the validation samples, which the calibration does not see
+	samples, calibration := res.Validation, res.Calibration
+	if samples.Len() == 0 {
+		samples = dataset
+		fmt.Println("Warning : no validation samples, the reports are computed on all the samples (in-sample)")
+	}
+	if calibration.Len() == 0 {
+		calibration = samples
+		fmt.Println("Warning : no calibration samples, the calibration is fitted on the samples of the reports (in-sample)")
+	}
+
+	fmt.Printf("Calibration samples : %d (temperature and open-set threshold), validation samples : %d (reports)\n", calibration.Len(), samples.Len())
+
+	report := trainer.NewQuantizationReport(p, res.FloatModel, samples)
+	fmt.Println(report)
+
+	trainingInfo := res.Info(config)
+	trainingInfo.Quantization = &report
+
+	// The quantized scores are the decrypted scores up to the encryption noise
+	scores := trainer.QuantizedScores(p, samples.X)
+	calibrationScores := trainer.QuantizedScores(p, calibration.X)
+
+	// Calibrates the detection of the genomes of unknown lineages
+	info.OpenSet = nil
+	if lib.OpenSetConfidence != "" {
+
+		if info.OpenSet, err = predictor.CalibrateOpenSet(lib.OpenSetConfidence, calibrationScores, lib.OpenSetAcceptance); err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Open set : %s confidence threshold %g (%.2f of the calibration samples accepted)\n",
+			info.OpenSet.Confidence, info.OpenSet.Threshold, info.OpenSet.Acceptance)
+
+		var unknown [][]float64
+		split := "Validation samples"
+		if lib.OpenSetEvaluationPath != "" {
+			unknown = trainer.QuantizedScores(p, HashGenomes(context.Background(), lib.OpenSetEvaluationPath))
+			split += " and " + lib.OpenSetEvaluationPath
+		}
+
+		openSetReport := eval.NewOpenSetReport(info.OpenSet, scores, samples.Y, unknown)
+		fmt.Printf("%s : %s\n", split, openSetReport)
+		trainingInfo.OpenSet = &openSetReport
+	}
+
+	// Calibrates the probabilities of the strains
+	info.Calibration = nil
+	if lib.CalibrateProbabilities {
+
+		if info.Calibration, err = predictor.FitTemperature(calibrationScores, calibration.Y); err != nil {
+			panic(err)
+		}
+
+		calibrationReport := trainer.NewCalibrationReport(info.Calibration, scores, samples.Y, lib.CalibrationBins)
+		fmt.Printf("Reliability diagram of the validation samples before calibration :\n%s\n", calibrationReport.Reliability)
+		fmt.Printf("Reliability diagram of the validation samples after calibration :\n%s\n", calibrationReport.CalibratedReliability)
+		fmt.Printf("Validation samples : %s\n", calibrationReport)
+		trainingInfo.Calibration = &calibrationReport
+
+		fw, err := os.Create("./reliability.csv")
+		if err != nil {
+			panic(err)
+		}
+
+		if err = calibrationReport.CalibratedReliability.WriteCSV(fw); err != nil {
+			panic(err)
+		}
+
+		if err = fw.Close(); err != nil {
+			panic(err)
+		}
+	}
+
+	if info.Training, err = json.Marshal(trainingInfo); err != nil {
+		panic(err)
+	}
+
+	if err = info.Save("./" + predictor.ModelInfoFile); err != nil {
+		panic(err)
+	}
+}
+
+// HashGenomes returns the hashes of all the genomes of the FASTA file, computed with the feature extractor of lib.
+func HashGenomes(ctx context.Context, path string) (hashes [][]float64) {
+	hasher := preprocessing.NewFeatureExtractor(lib.NbHashingWorkers)
+	for res := range preprocessing.NewWorkerPool(hasher).HashAll(ctx, preprocessing.ReadRecords(ctx, path, -1)) {
+		if res.Err != nil {
+			panic(res.Err)
+		}
+		hashes = append(hashes, res.Hash)
+	}
+	return
+}
+
+// LearnCoefficientMask computes the full 2D DCTII of the FCGR matrix of the first nbSamples genomes of the file
+// and writes the (row, column) indexes of the k coefficients of largest variance in the CSV file at maskPath.
+func LearnCoefficientMask(ctx context.Context, path string, nbSamples, k int, maskPath string) {
+
+	params := lib.ConfiguredParameters()
+	params.Mask = preprocessing.MaskSquare
+	params.HashSqrtSize = 1 << params.Window
+	params.HashSize = params.HashSqrtSize * params.HashSqrtSize
+
+	hasher, err := preprocessing.NewFeatureExtractorByName("dct", lib.NbHashingWorkers, params)
+	if err != nil {
+		panic(err)
+	}
+
+	variance := preprocessing.NewCoefficientVariance(params.HashSqrtSize)
+
+	records := preprocessing.ReadRecords(ctx, path, nbSamples)
+	for res := range preprocessing.NewWorkerPool(hasher).HashAll(ctx, records) {
+		if res.Err != nil {
+			panic(res.Err)
+		}
+		variance.Add(res.Hash)
+	}
+
+	if err = preprocessing.SaveCoefficients(maskPath, variance.TopK(k)); err != nil {
+		panic(err)
+	}
+}
+
+// LearnBackground computes the document frequencies of the k-mers of the first nbSamples genomes of the file,
+// counted with the window, strand mode and ambiguity expansion of lib, and writes them in the CSV file at backgroundPath.
+func LearnBackground(ctx context.Context, path string, nbSamples int, backgroundPath string) {
+
+	hasher := preprocessing.NewSparseDCTHasher(lib.NbHashingWorkers, lib.Window, preprocessing.SquareCoefficients(1), 1)
+	hasher.SetStrand(lib.Strand)
+	hasher.SetAmbiguityExpansion(lib.AmbiguityExpansion)
+
+	pool := preprocessing.NewWorkerPool(hasher)
+	pool.SetEntries(true)
+
+	idf := preprocessing.NewIDF(lib.Window)
+	for res := range pool.HashAll(ctx, preprocessing.ReadRecords(ctx, path, nbSamples)) {
+		if res.Err != nil {
+			panic(res.Err)
 		}
+		idf.Add(res.Entries)
 	}
 
-	return lib.StrainsMap[strain]
+	if err := idf.Save(backgroundPath); err != nil {
+		panic(err)
+	}
 }
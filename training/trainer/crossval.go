@@ -0,0 +1,85 @@
+package trainer
+
+import (
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"math"
+	"math/rand"
+)
+
+// Folds shuffles the indexes of n samples and splits them in k folds whose sizes differ by at most one.
+func Folds(n, k int, prng *rand.Rand) (folds [][]int) {
+	perm := prng.Perm(n)
+	folds = make([][]int, k)
+	for i, j := range perm {
+		folds[i%k] = append(folds[i%k], j)
+	}
+	return
+}
+
+// CrossValidation are the metrics of the models trained in a k-fold cross-validation, evaluated on their held-out fold.
+type CrossValidation struct {
+	FloatAccuracies     []float64 // Accuracies of the plaintext predictions of the float models on the float hashes
+	QuantizedAccuracies []float64 // Accuracies of the plaintext predictions with quantized hashes and weights
+	EncryptedAccuracies []float64 // Accuracies of the encrypted predictions
+	Disagreements       int       // Number of held-out samples whose quantized and encrypted predicted classes differ
+	Losses              []float64 // Cross-entropies of the float predictions
+	Epochs              []int     // Epochs of the models
+}
+
+// CrossValidate runs a k-fold cross-validation of the training with the given hyper-parameters : each fold
+// is held out in turn, a model is trained on the other folds (with config.ValidationSplit of them held out
+// for the early stopping), and evaluated on the held-out fold. The model is set in the predictor with
+// Predictor.SetModel, and the held-out fold is encrypted and predicted as by the client and the server
+// (see NewQuantizationReport).
+func CrossValidate(config Config, dataset *Dataset, nbClasses, k int, p *predictor.Predictor) (cv CrossValidation, err error) {
+
+	if k < 2 || k > dataset.Len() {
+		return cv, fmt.Errorf("cannot split %d samples in %d folds", dataset.Len(), k)
+	}
+
+	folds := Folds(dataset.Len(), k, rand.New(rand.NewSource(config.Seed)))
+
+	for i := range folds {
+
+		var indexes []int
+		for j := range folds {
+			if j != i {
+				indexes = append(indexes, folds[j]...)
+			}
+		}
+
+		var res *Result
+		if res, err = Train(config, dataset.Subset(indexes), nbClasses); err != nil {
+			return
+		}
+
+		heldOut := dataset.Subset(folds[i])
+
+		loss, _ := res.FloatModel.Evaluate(heldOut, 0, 0)
+
+		p.SetModel(res.Model.Weights, res.Model.Bias)
+		report := NewQuantizationReport(p, res.FloatModel, heldOut)
+
+		cv.FloatAccuracies = append(cv.FloatAccuracies, report.Float)
+		cv.QuantizedAccuracies = append(cv.QuantizedAccuracies, report.Quantized)
+		cv.EncryptedAccuracies = append(cv.EncryptedAccuracies, report.Encrypted)
+		cv.Disagreements += report.Disagreements
+		cv.Losses = append(cv.Losses, loss)
+		cv.Epochs = append(cv.Epochs, res.BestEpoch+1)
+	}
+
+	return
+}
+
+// MeanStd returns the mean and the (population) standard deviation of the values.
+func MeanStd(values []float64) (mean, std float64) {
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		std += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(values)))
+}
@@ -0,0 +1,64 @@
+package trainer
+
+import (
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestFolds(t *testing.T) {
+
+	folds := Folds(23, 5, rand.New(rand.NewSource(0)))
+
+	var all []int
+	for _, f := range folds {
+		if len(f) < 4 || len(f) > 5 {
+			t.Fatalf("fold of %d samples", len(f))
+		}
+		all = append(all, f...)
+	}
+
+	sort.Ints(all)
+	for i := range all {
+		if all[i] != i {
+			t.Fatal("the folds are not a partition of the samples")
+		}
+	}
+}
+
+func TestCrossValidate(t *testing.T) {
+
+	d := blobs(rand.New(rand.NewSource(7)), lib.NbStrains, 40, lib.HashSize, 1)
+
+	params, _ := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	p := predictor.NewPredictor(params)
+
+	config := DefaultConfig()
+	config.Epochs = 20
+	config.HashScale, config.ModelScale = lib.HashScale, lib.ModelScale
+
+	cv, err := CrossValidate(config, d, lib.NbStrains, 4, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cv.EncryptedAccuracies) != 4 || len(cv.QuantizedAccuracies) != 4 || len(cv.FloatAccuracies) != 4 || len(cv.Epochs) != 4 {
+		t.Fatalf("%d folds evaluated", len(cv.EncryptedAccuracies))
+	}
+
+	if mean, _ := MeanStd(cv.EncryptedAccuracies); mean < 0.9 {
+		t.Fatalf("cross-validated accuracy %f", mean)
+	}
+
+	// The encrypted predictions are the quantized predictions up to the encryption noise
+	if cv.Disagreements != 0 {
+		t.Fatalf("%d disagreements between the quantized and the encrypted predictions", cv.Disagreements)
+	}
+
+	if _, err = CrossValidate(config, d, lib.NbStrains, 1, p); err == nil {
+		t.Fatal("cross-validation with a single fold accepted")
+	}
+}
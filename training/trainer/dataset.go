@@ -0,0 +1,112 @@
+package trainer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"io/ioutil"
+	"math"
+	"math/rand"
+)
+
+// Dataset is a set of hashes and of their labels.
+type Dataset struct {
+	X [][]float64
+	Y []int
+}
+
+// LoadDataset reads the hashes of the given dimension in the file at xPath (little endian float64,
+// as written by training/main.go) and their labels in the file at yPath (one byte per hash).
+func LoadDataset(xPath, yPath string, nbFeatures int) (dataset *Dataset, err error) {
+
+	var bx, by []byte
+
+	if bx, err = ioutil.ReadFile(xPath); err != nil {
+		return
+	}
+
+	if by, err = ioutil.ReadFile(yPath); err != nil {
+		return
+	}
+
+	if len(bx) != len(by)*nbFeatures<<3 {
+		return nil, fmt.Errorf("%s has %d bytes but %s has %d labels of %d features", xPath, len(bx), yPath, len(by), nbFeatures)
+	}
+
+	dataset = &Dataset{X: make([][]float64, len(by)), Y: make([]int, len(by))}
+	for i := range dataset.X {
+		x := make([]float64, nbFeatures)
+		for j := range x {
+			x[j] = math.Float64frombits(binary.LittleEndian.Uint64(bx[(i*nbFeatures+j)<<3:]))
+		}
+		dataset.X[i] = x
+		dataset.Y[i] = int(by[i])
+	}
+
+	return
+}
+
+// Len returns the number of samples of the dataset.
+func (d *Dataset) Len() int {
+	return len(d.Y)
+}
+
+// NbFeatures returns the dimension of the hashes of the dataset.
+func (d *Dataset) NbFeatures() int {
+	if len(d.X) == 0 {
+		return 0
+	}
+	return len(d.X[0])
+}
+
+// Subset returns the dataset of the samples of the given indexes, which share the hashes of d.
+func (d *Dataset) Subset(indexes []int) *Dataset {
+	s := &Dataset{X: make([][]float64, len(indexes)), Y: make([]int, len(indexes))}
+	for i, j := range indexes {
+		s.X[i], s.Y[i] = d.X[j], d.Y[j]
+	}
+	return s
+}
+
+// Quantize returns the dataset of the hashes quantized as by the client, round(x * hashScale) / hashScale.
+func (d *Dataset) Quantize(hashScale float64) *Dataset {
+	q := &Dataset{X: make([][]float64, d.Len()), Y: d.Y}
+	for i, x := range d.X {
+		q.X[i] = make([]float64, len(x))
+		for j := range x {
+			q.X[i][j] = predictor.Quantize(x[j], hashScale) / hashScale
+		}
+	}
+	return q
+}
+
+// Split shuffles the samples and returns the first (1-fraction) of them as training samples and the
+// remaining ones as validation samples.
+func (d *Dataset) Split(fraction float64, prng *rand.Rand) (train, validation *Dataset) {
+	perm := prng.Perm(d.Len())
+	nbTrain := d.Len() - int(fraction*float64(d.Len()))
+	return d.Subset(perm[:nbTrain]), d.Subset(perm[nbTrain:])
+}
+
+// check returns an error if the hashes do not all have the same dimension or if a label is not a class.
+func (d *Dataset) check(nbClasses int) error {
+
+	if len(d.X) != len(d.Y) {
+		return fmt.Errorf("%d hashes but %d labels", len(d.X), len(d.Y))
+	}
+
+	if d.Len() == 0 {
+		return fmt.Errorf("empty dataset")
+	}
+
+	for i := range d.X {
+		if len(d.X[i]) != d.NbFeatures() {
+			return fmt.Errorf("sample %d has %d features instead of %d", i, len(d.X[i]), d.NbFeatures())
+		}
+		if d.Y[i] < 0 || d.Y[i] >= nbClasses {
+			return fmt.Errorf("sample %d has label %d but there are %d classes", i, d.Y[i], nbClasses)
+		}
+	}
+
+	return nil
+}
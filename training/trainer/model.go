@@ -0,0 +1,242 @@
+package trainer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"io/ioutil"
+	"math"
+	"math/rand"
+)
+
+// Model is a linear model with one weight vector and one bias per class. The scores of a hash x
+// are the logits w_c . x + b_c, and its class probabilities the softmax of the logits.
+type Model struct {
+	Weights [][]float64 // Weights[c][j] is the weight of the feature j for the class c
+	Bias    []float64
+}
+
+// NewModel creates a new model for the given number of classes and features. The weights are
+// drawn from the He normal distribution (truncated at two standard deviations) if prng is not nil,
+// and are zero otherwise. The bias is zero.
+func NewModel(nbClasses, nbFeatures int, prng *rand.Rand) (m *Model) {
+
+	m = &Model{Weights: make([][]float64, nbClasses), Bias: make([]float64, nbClasses)}
+
+	stddev := math.Sqrt(2 / float64(nbFeatures))
+
+	for c := range m.Weights {
+		m.Weights[c] = make([]float64, nbFeatures)
+		if prng != nil {
+			for j := range m.Weights[c] {
+				x := prng.NormFloat64()
+				for math.Abs(x) > 2 {
+					x = prng.NormFloat64()
+				}
+				m.Weights[c][j] = x * stddev
+			}
+		}
+	}
+
+	return
+}
+
+// NbClasses returns the number of classes of the model.
+func (m *Model) NbClasses() int {
+	return len(m.Weights)
+}
+
+// NbFeatures returns the dimension of the hashes of the model.
+func (m *Model) NbFeatures() int {
+	return len(m.Weights[0])
+}
+
+// Copy returns a deep copy of the model.
+func (m *Model) Copy() *Model {
+	c := NewModel(m.NbClasses(), m.NbFeatures(), nil)
+	for i := range m.Weights {
+		copy(c.Weights[i], m.Weights[i])
+	}
+	copy(c.Bias, m.Bias)
+	return c
+}
+
+// Logits writes the scores w_c . x + b_c of the hash x in out.
+func (m *Model) Logits(x, out []float64) {
+	for c, w := range m.Weights {
+		score := m.Bias[c]
+		for j := range w {
+			score += w[j] * x[j]
+		}
+		out[c] = score
+	}
+}
+
+// Probabilities writes the class probabilities of the hash x in out.
+func (m *Model) Probabilities(x, out []float64) {
+	m.Logits(x, out)
+	predictor.SoftMax(out)
+}
+
+// Predict returns the class of largest score of the hash x.
+func (m *Model) Predict(x []float64) int {
+	scores := make([]float64, m.NbClasses())
+	m.Logits(x, scores)
+	return predictor.MaxIndex(scores)
+}
+
+// Penalty returns the regularization l1 * sum(|w|) + l2 * sum(w^2) of the weights (the bias is not regularized).
+func (m *Model) Penalty(l1, l2 float64) (penalty float64) {
+	for _, w := range m.Weights {
+		for _, wi := range w {
+			penalty += l1*math.Abs(wi) + l2*wi*wi
+		}
+	}
+	return
+}
+
+// Evaluate returns the mean cross-entropy plus the regularization, and the accuracy, of the model on the dataset.
+func (m *Model) Evaluate(dataset *Dataset, l1, l2 float64) (loss, accuracy float64) {
+
+	probs := make([]float64, m.NbClasses())
+
+	var correct int
+	for i, x := range dataset.X {
+		m.Probabilities(x, probs)
+		loss += crossEntropy(probs, dataset.Y[i])
+		if predictor.MaxIndex(probs) == dataset.Y[i] {
+			correct++
+		}
+	}
+
+	n := float64(dataset.Len())
+
+	return loss/n + m.Penalty(l1, l2), float64(correct) / n
+}
+
+// gradient writes in grad the gradient, with respect to the parameters of the model, of the mean
+// cross-entropy over the samples of the given indexes.
+func (m *Model) gradient(dataset *Dataset, indexes []int, grad *Model, probs []float64) {
+
+	for c := range grad.Weights {
+		g := grad.Weights[c]
+		for j := range g {
+			g[j] = 0
+		}
+		grad.Bias[c] = 0
+	}
+
+	scale := 1 / float64(len(indexes))
+
+	for _, i := range indexes {
+
+		x := dataset.X[i]
+
+		m.Probabilities(x, probs)
+		probs[dataset.Y[i]]--
+
+		// d(-log p_y)/d logit_c = p_c - [c == y]
+		for c := range grad.Weights {
+			d := probs[c] * scale
+			axpy(d, x, grad.Weights[c])
+			grad.Bias[c] += d
+		}
+	}
+}
+
+// penaltyGradient adds the gradient of the regularization of the weights of the model to grad.
+func (m *Model) penaltyGradient(l1, l2 float64, grad *Model) {
+	for c := range grad.Weights {
+		g, w := grad.Weights[c], m.Weights[c]
+		for j := range g {
+			g[j] += l1*sign(w[j]) + 2*l2*w[j]
+		}
+	}
+}
+
+// Quantize returns the model whose weights and bias are quantized as by the predictor : round(w * modelScale) / modelScale
+// for the weights and round(b * hashScale * modelScale) / (hashScale * modelScale) for the bias.
+func (m *Model) Quantize(hashScale, modelScale float64) (q *Model) {
+	q = NewModel(m.NbClasses(), m.NbFeatures(), nil)
+	for c, w := range m.Weights {
+		for j := range w {
+			q.Weights[c][j] = predictor.Quantize(w[j], modelScale) / modelScale
+		}
+		q.Bias[c] = predictor.Quantize(m.Bias[c], hashScale*modelScale) / (hashScale * modelScale)
+	}
+	return
+}
+
+// Save writes the model in the format read by Predictor.LoadModel : the weights in path+"weights_layer_0"
+// and the bias in path+"bias_layer_0", as little endian float64, the weight of the feature j for the
+// class c being at index c + j * nbClasses.
+func (m *Model) Save(path string) (err error) {
+
+	nbClasses := m.NbClasses()
+
+	buff := make([]byte, nbClasses*m.NbFeatures()<<3)
+	for c, w := range m.Weights {
+		for j := range w {
+			binary.LittleEndian.PutUint64(buff[(c+j*nbClasses)<<3:], math.Float64bits(w[j]))
+		}
+	}
+
+	if err = ioutil.WriteFile(path+"weights_layer_0", buff, 0644); err != nil {
+		return
+	}
+
+	buff = make([]byte, nbClasses<<3)
+	for c := range m.Bias {
+		binary.LittleEndian.PutUint64(buff[c<<3:], math.Float64bits(m.Bias[c]))
+	}
+
+	return ioutil.WriteFile(path+"bias_layer_0", buff, 0644)
+}
+
+// LoadModel reads the model of the given number of classes written by Model.Save.
+func LoadModel(path string, nbClasses int) (m *Model, err error) {
+
+	var weights, bias []byte
+
+	if weights, err = ioutil.ReadFile(path + "weights_layer_0"); err != nil {
+		return
+	}
+
+	if bias, err = ioutil.ReadFile(path + "bias_layer_0"); err != nil {
+		return
+	}
+
+	if len(weights) == 0 || len(weights)%(nbClasses<<3) != 0 {
+		return nil, fmt.Errorf("weights_layer_0 has %d bytes, not a multiple of %d weights", len(weights), nbClasses)
+	}
+
+	if len(bias) != nbClasses<<3 {
+		return nil, fmt.Errorf("bias_layer_0 has %d bytes, expected %d", len(bias), nbClasses<<3)
+	}
+
+	m = NewModel(nbClasses, len(weights)/(nbClasses<<3), nil)
+	for c, w := range m.Weights {
+		for j := range w {
+			w[j] = math.Float64frombits(binary.LittleEndian.Uint64(weights[(c+j*nbClasses)<<3:]))
+		}
+		m.Bias[c] = math.Float64frombits(binary.LittleEndian.Uint64(bias[c<<3:]))
+	}
+
+	return
+}
+
+// crossEntropy returns -log(p_label), clipped as in Keras to avoid infinite losses.
+func crossEntropy(probs []float64, label int) float64 {
+	const epsilon = 1e-7
+	return -math.Log(math.Max(probs[label], epsilon))
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
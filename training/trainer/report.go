@@ -0,0 +1,119 @@
+package trainer
+
+import (
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/eval"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"math"
+)
+
+// QuantizationReport compares the accuracies of the predictions of a model on a dataset in plaintext
+// with float hashes and parameters, in plaintext with quantized hashes and parameters, and encrypted.
+type QuantizationReport struct {
+	Samples       int     `json:"samples"`
+	Float         float64 `json:"float_accuracy"`
+	Quantized     float64 `json:"quantized_accuracy"`
+	Encrypted     float64 `json:"encrypted_accuracy"`
+	Disagreements int     `json:"disagreements"`   // Number of samples whose quantized and encrypted predicted classes differ
+	MaxError      float64 `json:"max_score_error"` // Largest difference between a quantized and an encrypted score
+}
+
+// NewQuantizationReport evaluates on the dataset the float model, in plaintext on the float hashes, and the model
+// loaded by the predictor, in plaintext on the quantized hashes and encrypted. The float model is the float model
+// of the training result (see Result), which the model loaded by the predictor is quantized from.
+func NewQuantizationReport(p *predictor.Predictor, floatModel *Model, dataset *Dataset) (r QuantizationReport) {
+
+	r.Samples = dataset.Len()
+
+	encrypted := p.PredictEncrypted(dataset.X)
+
+	float := make([]float64, len(encrypted[0]))
+	quantized := make([]float64, len(encrypted[0]))
+
+	var nbFloat, nbQuantized, nbEncrypted int
+	for i, x := range dataset.X {
+
+		floatModel.Logits(x, float)
+		p.PredictQuantized(x, quantized)
+
+		label := dataset.Y[i]
+
+		if predictor.MaxIndex(float) == label {
+			nbFloat++
+		}
+
+		if predictor.MaxIndex(quantized) == label {
+			nbQuantized++
+		}
+
+		if predictor.MaxIndex(encrypted[i]) == label {
+			nbEncrypted++
+		}
+
+		if predictor.MaxIndex(quantized) != predictor.MaxIndex(encrypted[i]) {
+			r.Disagreements++
+		}
+
+		for c := range quantized {
+			r.MaxError = math.Max(r.MaxError, math.Abs(quantized[c]-encrypted[i][c]))
+		}
+	}
+
+	n := float64(r.Samples)
+	r.Float, r.Quantized, r.Encrypted = float64(nbFloat)/n, float64(nbQuantized)/n, float64(nbEncrypted)/n
+
+	return
+}
+
+func (r QuantizationReport) String() string {
+	return fmt.Sprintf("Accuracy on %d samples : float %.4f, quantized %.4f, encrypted %.4f (%d disagreements, max. score error %.2e)",
+		r.Samples, r.Float, r.Quantized, r.Encrypted, r.Disagreements, r.MaxError)
+}
+
+// QuantizedScores returns the quantized scores of the hashes computed by the predictor.
+func QuantizedScores(p *predictor.Predictor, hashes [][]float64) (scores [][]float64) {
+	scores = make([][]float64, len(hashes))
+	for i, x := range hashes {
+		scores[i] = make([]float64, p.NbStrains())
+		p.PredictQuantized(x, scores[i])
+	}
+	return
+}
+
+// CalibrationReport compares the probabilities of the strains before calibration, the softmax of the scores,
+// and after calibration.
+type CalibrationReport struct {
+	Temperature float64                 `json:"temperature"`
+	NLL         float64                 `json:"nll"` // Negative log-likelihood before calibration
+	ECE         float64                 `json:"ece"` // Expected calibration error before calibration
+	Reliability eval.ReliabilityDiagram `json:"reliability"`
+
+	CalibratedNLL         float64                 `json:"calibrated_nll"`
+	CalibratedECE         float64                 `json:"calibrated_ece"`
+	CalibratedReliability eval.ReliabilityDiagram `json:"calibrated_reliability"`
+}
+
+// NewCalibrationReport evaluates the calibration on the scores of genomes of the given labels,
+// with reliability diagrams of nbBins bins.
+func NewCalibrationReport(c *predictor.Calibration, scores [][]float64, labels []int, nbBins int) (r CalibrationReport) {
+
+	probs := eval.Probabilities(scores, nil)
+	calibrated := eval.Probabilities(scores, c)
+
+	r.Temperature = c.Temperature
+
+	r.NLL = predictor.NegativeLogLikelihood(scores, labels, 1)
+	r.Reliability = eval.NewReliabilityDiagram(probs, labels, nbBins)
+	r.ECE = r.Reliability.ECE()
+
+	r.CalibratedNLL = predictor.NegativeLogLikelihood(scores, labels, c.Temperature)
+	r.CalibratedReliability = eval.NewReliabilityDiagram(calibrated, labels, nbBins)
+	r.CalibratedECE = r.CalibratedReliability.ECE()
+
+	return
+}
+
+func (r CalibrationReport) String() string {
+	return fmt.Sprintf("Calibration : temperature %.4f, NLL %.4f -> %.4f, ECE %.4f -> %.4f",
+		r.Temperature, r.NLL, r.CalibratedNLL, r.ECE, r.CalibratedECE)
+}
@@ -0,0 +1,335 @@
+// Package trainer trains the linear model evaluated by the predictor : a multinomial logistic regression
+// (softmax and cross-entropy) with L1/L2 regularization of the weights, trained by mini-batch SGD or Adam
+// with early stopping on the validation loss.
+package trainer
+
+import (
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/eval"
+	"math"
+	"math/rand"
+)
+
+// Optimizers of the mini-batch gradient descent
+const (
+	OptimizerSGD  = "sgd"  // Plain SGD with constant learning rate
+	OptimizerAdam = "adam" // Adam, with the default parameters of Keras
+)
+
+// Config are the hyper-parameters of the training.
+type Config struct {
+	Optimizer        string  `json:"optimizer"`
+	LearningRate     float64 `json:"learning_rate"`
+	BatchSize        int     `json:"batch_size"`
+	Epochs           int     `json:"epochs"`                // Maximum number of epochs
+	L1               float64 `json:"l1"`                    // Weight of the L1 penalty sum(|w|) of the weights
+	L2               float64 `json:"l2"`                    // Weight of the L2 penalty sum(w^2) of the weights
+	ValidationSplit  float64 `json:"validation_split"`      // Fraction of the samples held out to monitor the training
+	CalibrationSplit float64 `json:"calibration_split"`     // Fraction of the samples held out from the training and the monitoring, to calibrate the predictions
+	Patience         int     `json:"patience"`              // Number of epochs without improvement of the monitored loss before stopping (0 disables the early stopping)
+	Seed             int64   `json:"seed"`                  // Seed of the initialization, of the split and of the shuffling
+	HashScale        float64 `json:"hash_scale,omitempty"`  // Quantization scale of the hashes (lib.HashScale), 0 for a float training
+	ModelScale       float64 `json:"model_scale,omitempty"` // Quantization scale of the weights (lib.ModelScale), 0 for a float training
+}
+
+// Quantized returns true if the training is quantization-aware.
+func (c Config) Quantized() bool {
+	return c.HashScale > 0 && c.ModelScale > 0
+}
+
+// DefaultConfig returns the hyper-parameters of training.py (Adam, batches of 32 samples, 100 epochs,
+// L1 = L2 = 1e-6), with 10% of the samples held out for the calibration and 20% of the others for the early stopping.
+func DefaultConfig() Config {
+	return Config{
+		Optimizer:        OptimizerAdam,
+		LearningRate:     0.001,
+		BatchSize:        32,
+		Epochs:           100,
+		L1:               1e-6,
+		L2:               1e-6,
+		ValidationSplit:  0.2,
+		CalibrationSplit: 0.1,
+		Patience:         10,
+		Seed:             0,
+	}
+}
+
+// Check returns an error if the hyper-parameters are invalid.
+func (c Config) Check() error {
+	switch c.Optimizer {
+	case OptimizerSGD, OptimizerAdam:
+	default:
+		return fmt.Errorf("unknown optimizer %s", c.Optimizer)
+	}
+	if c.LearningRate <= 0 {
+		return fmt.Errorf("learning rate must be positive")
+	}
+	if c.BatchSize < 1 || c.Epochs < 1 {
+		return fmt.Errorf("batch size and epochs must be at least 1")
+	}
+	if c.L1 < 0 || c.L2 < 0 {
+		return fmt.Errorf("regularization weights must be non-negative")
+	}
+	if c.ValidationSplit < 0 || c.ValidationSplit >= 1 {
+		return fmt.Errorf("validation split must be in [0, 1)")
+	}
+	if c.CalibrationSplit < 0 || c.CalibrationSplit >= 1 {
+		return fmt.Errorf("calibration split must be in [0, 1)")
+	}
+	if c.HashScale < 0 || c.ModelScale < 0 || (c.HashScale == 0) != (c.ModelScale == 0) {
+		return fmt.Errorf("the quantization scales must be both positive or both zero")
+	}
+	return nil
+}
+
+// EpochStats are the metrics of the model at the end of an epoch.
+type EpochStats struct {
+	Epoch              int
+	Loss               float64 // Cross-entropy plus penalties on the training samples
+	Accuracy           float64
+	ValidationLoss     float64 // Cross-entropy plus penalties on the validation samples (NaN without validation samples)
+	ValidationAccuracy float64
+}
+
+// Result is the outcome of a training.
+type Result struct {
+	Model       *Model
+	FloatModel  *Model // Float parameters of Model, which are those of Model for a float training
+	History     []EpochStats
+	BestEpoch   int      // Epoch of the returned model
+	Validation  *Dataset // Validation samples (without quantization)
+	Calibration *Dataset // Calibration samples, used neither for the training nor for the monitoring (without quantization)
+}
+
+// Best returns the metrics of the returned model.
+func (r *Result) Best() EpochStats {
+	return r.History[r.BestEpoch]
+}
+
+// Train trains a model on the dataset : a fraction config.CalibrationSplit of the samples is held out as
+// calibration samples, the others are split in training and validation samples according to
+// config.ValidationSplit, and the training stops once the validation loss (the training
+// loss without validation samples) has not decreased for config.Patience epochs. The returned model
+// is the one of lowest monitored loss.
+//
+// If config.Quantized(), the training is quantization-aware : the forward pass uses the hashes and the
+// parameters quantized as the encrypted prediction does (see predictor.Quantize), and the gradient with
+// respect to the quantized parameters is applied to the float parameters (straight-through estimator).
+// The returned model then has quantized parameters, so that its plaintext and encrypted predictions match,
+// and the float parameters it was quantized from are returned as the float model.
+func Train(config Config, dataset *Dataset, nbClasses int) (res *Result, err error) {
+
+	if err = config.Check(); err != nil {
+		return
+	}
+
+	if err = dataset.check(nbClasses); err != nil {
+		return
+	}
+
+	prng := rand.New(rand.NewSource(config.Seed))
+
+	calibration := &Dataset{}
+	if config.CalibrationSplit > 0 {
+		dataset, calibration = dataset.Split(config.CalibrationSplit, prng)
+	}
+
+	train, validation := dataset.Split(config.ValidationSplit, prng)
+
+	if train.Len() == 0 {
+		return nil, fmt.Errorf("no training samples")
+	}
+
+	if res, err = TrainValidation(config, train, validation, nbClasses, prng); err != nil {
+		return
+	}
+
+	res.Calibration = calibration
+
+	return
+}
+
+// TrainValidation trains a model on the training samples, monitoring the given validation samples
+// (which can be empty). config.ValidationSplit and config.CalibrationSplit are ignored, and the result
+// has no calibration samples.
+func TrainValidation(config Config, train, validation *Dataset, nbClasses int, prng *rand.Rand) (res *Result, err error) {
+
+	if err = config.Check(); err != nil {
+		return
+	}
+
+	model := NewModel(nbClasses, train.NbFeatures(), prng)
+	opt := newOptimizer(config, model)
+
+	grad := NewModel(nbClasses, train.NbFeatures(), nil)
+	probs := make([]float64, nbClasses)
+
+	order := make([]int, train.Len())
+	for i := range order {
+		order[i] = i
+	}
+
+	res = &Result{Validation: validation, Calibration: &Dataset{}}
+
+	quantized := config.Quantized()
+	if quantized {
+		train = train.Quantize(config.HashScale)
+		validation = validation.Quantize(config.HashScale)
+	}
+
+	// Model of the forward pass
+	forward := model
+
+	var best, bestFloat *Model
+	bestLoss := math.Inf(1)
+
+	for epoch := 0; epoch < config.Epochs; epoch++ {
+
+		prng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+
+		for start := 0; start < len(order); start += config.BatchSize {
+
+			end := start + config.BatchSize
+			if end > len(order) {
+				end = len(order)
+			}
+
+			if quantized {
+				forward = model.Quantize(config.HashScale, config.ModelScale)
+			}
+
+			forward.gradient(train, order[start:end], grad, probs)
+			model.penaltyGradient(config.L1, config.L2, grad)
+			opt.step(model, grad)
+		}
+
+		if quantized {
+			forward = model.Quantize(config.HashScale, config.ModelScale)
+		}
+
+		stats := EpochStats{Epoch: epoch}
+		stats.Loss, stats.Accuracy = forward.Evaluate(train, config.L1, config.L2)
+		stats.ValidationLoss, stats.ValidationAccuracy = math.NaN(), math.NaN()
+
+		monitored := stats.Loss
+		if validation.Len() > 0 {
+			stats.ValidationLoss, stats.ValidationAccuracy = forward.Evaluate(validation, config.L1, config.L2)
+			monitored = stats.ValidationLoss
+		}
+
+		res.History = append(res.History, stats)
+
+		if monitored < bestLoss {
+			bestLoss = monitored
+			best = forward.Copy()
+			bestFloat = best
+			if quantized {
+				bestFloat = model.Copy()
+			}
+			res.BestEpoch = epoch
+		} else if config.Patience > 0 && epoch-res.BestEpoch >= config.Patience {
+			break
+		}
+	}
+
+	// Diverged at the first epoch
+	if best == nil {
+		best, bestFloat = forward, model
+	}
+
+	res.Model, res.FloatModel = best, bestFloat
+
+	return
+}
+
+// optimizer updates the parameters of the model given the gradient of the loss.
+type optimizer struct {
+	config Config
+	t      int
+	m, v   *Model // First and second moments of Adam
+}
+
+func newOptimizer(config Config, model *Model) *optimizer {
+	opt := &optimizer{config: config}
+	if config.Optimizer == OptimizerAdam {
+		opt.m = NewModel(model.NbClasses(), model.NbFeatures(), nil)
+		opt.v = NewModel(model.NbClasses(), model.NbFeatures(), nil)
+	}
+	return opt
+}
+
+func (opt *optimizer) step(model, grad *Model) {
+
+	lr := opt.config.LearningRate
+
+	if opt.config.Optimizer == OptimizerSGD {
+		for c := range model.Weights {
+			axpy(-lr, grad.Weights[c], model.Weights[c])
+		}
+		axpy(-lr, grad.Bias, model.Bias)
+		return
+	}
+
+	// Adam with the bias correction folded in the learning rate, as in Keras
+	const beta1, beta2, epsilon = 0.9, 0.999, 1e-7
+
+	opt.t++
+	lrt := lr * math.Sqrt(1-math.Pow(beta2, float64(opt.t))) / (1 - math.Pow(beta1, float64(opt.t)))
+
+	update := func(w, g, m, v []float64) {
+		for i := range w {
+			m[i] = beta1*m[i] + (1-beta1)*g[i]
+			v[i] = beta2*v[i] + (1-beta2)*g[i]*g[i]
+			w[i] -= lrt * m[i] / (math.Sqrt(v[i]) + epsilon)
+		}
+	}
+
+	for c := range model.Weights {
+		update(model.Weights[c], grad.Weights[c], opt.m.Weights[c], opt.v.Weights[c])
+	}
+	update(model.Bias, grad.Bias, opt.m.Bias, opt.v.Bias)
+}
+
+// axpy computes y += a * x.
+func axpy(a float64, x, y []float64) {
+	for i := range y {
+		y[i] += a * x[i]
+	}
+}
+
+// Info summarizes a training for the description of the model.
+type Info struct {
+	Config             Config  `json:"config"`
+	Epochs             int     `json:"epochs"`     // Number of epochs run
+	BestEpoch          int     `json:"best_epoch"` // Epoch of the model
+	Loss               float64 `json:"loss"`
+	Accuracy           float64 `json:"accuracy"`
+	ValidationLoss     float64 `json:"validation_loss,omitempty"`
+	ValidationAccuracy float64 `json:"validation_accuracy,omitempty"`
+	ValidationSamples  int     `json:"validation_samples"`
+	CalibrationSamples int     `json:"calibration_samples,omitempty"`
+
+	// Reports of the validation samples, the open-set threshold and the temperature being fitted on the calibration samples
+	Quantization *QuantizationReport `json:"quantization,omitempty"` // Float, quantized and encrypted accuracies
+	OpenSet      *eval.OpenSetReport `json:"open_set,omitempty"`     // Detection of the genomes of unknown lineages
+	Calibration  *CalibrationReport  `json:"calibration,omitempty"`  // Calibration of the probabilities of the strains
+}
+
+// Info returns the summary of the training with the given hyper-parameters.
+func (r *Result) Info(config Config) (info Info) {
+	best := r.Best()
+	info = Info{
+		Config:    config,
+		Epochs:    len(r.History),
+		BestEpoch: r.BestEpoch,
+		Loss:      best.Loss,
+		Accuracy:  best.Accuracy,
+
+		ValidationSamples:  r.Validation.Len(),
+		CalibrationSamples: r.Calibration.Len(),
+	}
+	if !math.IsNaN(best.ValidationLoss) {
+		info.ValidationLoss, info.ValidationAccuracy = best.ValidationLoss, best.ValidationAccuracy
+	}
+	return
+}
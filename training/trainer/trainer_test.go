@@ -0,0 +1,366 @@
+package trainer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// blobs returns nbClasses Gaussian clusters of nbSamples hashes each, centered on random points.
+func blobs(prng *rand.Rand, nbClasses, nbSamples, nbFeatures int, spread float64) *Dataset {
+
+	centers := make([][]float64, nbClasses)
+	for c := range centers {
+		centers[c] = make([]float64, nbFeatures)
+		for j := range centers[c] {
+			centers[c][j] = prng.NormFloat64()
+		}
+	}
+
+	d := &Dataset{}
+	for i := 0; i < nbSamples; i++ {
+		for c := range centers {
+			x := make([]float64, nbFeatures)
+			for j := range x {
+				x[j] = centers[c][j] + spread*prng.NormFloat64()
+			}
+			d.X = append(d.X, x)
+			d.Y = append(d.Y, c)
+		}
+	}
+
+	return d
+}
+
+func TestGradient(t *testing.T) {
+
+	prng := rand.New(rand.NewSource(1))
+
+	d := blobs(prng, 4, 5, 7, 1)
+	m := NewModel(4, 7, prng)
+	for c := range m.Bias {
+		m.Bias[c] = prng.NormFloat64()
+	}
+
+	l1, l2 := 0.01, 0.02
+
+	indexes := make([]int, d.Len())
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	grad := NewModel(4, 7, nil)
+	m.gradient(d, indexes, grad, make([]float64, 4))
+	m.penaltyGradient(l1, l2, grad)
+
+	// Central finite differences of the loss
+	const h = 1e-6
+	numerical := func(param *float64) float64 {
+		v := *param
+		*param = v + h
+		lp, _ := m.Evaluate(d, l1, l2)
+		*param = v - h
+		lm, _ := m.Evaluate(d, l1, l2)
+		*param = v
+		return (lp - lm) / (2 * h)
+	}
+
+	for c := range m.Weights {
+		for j := range m.Weights[c] {
+			if g := numerical(&m.Weights[c][j]); math.Abs(g-grad.Weights[c][j]) > 1e-6 {
+				t.Fatalf("weight (%d, %d) : gradient %f, finite differences %f", c, j, grad.Weights[c][j], g)
+			}
+		}
+		if g := numerical(&m.Bias[c]); math.Abs(g-grad.Bias[c]) > 1e-6 {
+			t.Fatalf("bias %d : gradient %f, finite differences %f", c, grad.Bias[c], g)
+		}
+	}
+}
+
+func TestTrain(t *testing.T) {
+
+	d := blobs(rand.New(rand.NewSource(2)), 4, 100, 16, 0.5)
+
+	for _, optimizer := range []string{OptimizerSGD, OptimizerAdam} {
+
+		t.Run(optimizer, func(t *testing.T) {
+
+			config := DefaultConfig()
+			config.Optimizer = optimizer
+			config.LearningRate = 0.01
+			config.Epochs = 50
+
+			res, err := Train(config, d, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			best := res.Best()
+			if best.ValidationAccuracy < 0.95 {
+				t.Fatalf("validation accuracy %f", best.ValidationAccuracy)
+			}
+
+			// The returned model is the one of lowest validation loss
+			for _, stats := range res.History {
+				if stats.ValidationLoss < best.ValidationLoss {
+					t.Fatalf("epoch %d has a lower validation loss than the returned epoch %d", stats.Epoch, best.Epoch)
+				}
+			}
+
+			// Deterministic given the seed
+			res2, _ := Train(config, d, 4)
+			if res2.Model.Weights[3][5] != res.Model.Weights[3][5] {
+				t.Fatal("training is not deterministic")
+			}
+		})
+	}
+}
+
+func TestEarlyStopping(t *testing.T) {
+
+	// Random labels : the validation loss stops improving quickly
+	prng := rand.New(rand.NewSource(3))
+	d := blobs(prng, 4, 50, 16, 1)
+	for i := range d.Y {
+		d.Y[i] = prng.Intn(4)
+	}
+
+	config := DefaultConfig()
+	config.LearningRate = 0.1
+	config.Epochs = 1000
+	config.Patience = 5
+
+	res, err := Train(config, d, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.History) == config.Epochs || len(res.History) != res.BestEpoch+config.Patience+1 {
+		t.Fatalf("stopped after %d epochs, best epoch %d", len(res.History), res.BestEpoch)
+	}
+}
+
+func TestCalibrationSplit(t *testing.T) {
+
+	d := blobs(rand.New(rand.NewSource(4)), 4, 100, 16, 0.5)
+
+	config := DefaultConfig()
+	config.Epochs = 1
+
+	res, err := Train(config, d, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10% of the 400 samples for the calibration, then 20% of the 360 others for the validation
+	if res.Calibration.Len() != 40 || res.Validation.Len() != 72 {
+		t.Fatalf("%d calibration and %d validation samples", res.Calibration.Len(), res.Validation.Len())
+	}
+
+	validation := map[*float64]bool{}
+	for _, x := range res.Validation.X {
+		validation[&x[0]] = true
+	}
+
+	for _, x := range res.Calibration.X {
+		if validation[&x[0]] {
+			t.Fatal("a calibration sample is a validation sample")
+		}
+	}
+
+	if info := res.Info(config); info.CalibrationSamples != 40 || info.ValidationSamples != 72 {
+		t.Fatalf("info %d calibration and %d validation samples", info.CalibrationSamples, info.ValidationSamples)
+	}
+
+	config.CalibrationSplit = 0
+	if res, err = Train(config, d, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Calibration.Len() != 0 || res.Validation.Len() != 80 {
+		t.Fatalf("without calibration split : %d calibration and %d validation samples", res.Calibration.Len(), res.Validation.Len())
+	}
+}
+
+func TestQuantizationAwareTraining(t *testing.T) {
+
+	// Large hashes : the float weights are small and mostly rounded to zero by ModelScale
+	d := blobs(rand.New(rand.NewSource(6)), 4, 100, lib.HashSize, 3)
+	for i := range d.X {
+		for j := range d.X[i] {
+			d.X[i][j] *= 10
+		}
+	}
+
+	config := DefaultConfig()
+	config.Epochs = 30
+
+	res, err := Train(config, d, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, floatAccuracy := res.Model.Quantize(lib.HashScale, lib.ModelScale).Evaluate(res.Validation.Quantize(lib.HashScale), 0, 0)
+
+	config.HashScale, config.ModelScale = lib.HashScale, lib.ModelScale
+
+	resQAT, err := Train(config, d, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qatAccuracy := resQAT.Best().ValidationAccuracy
+
+	if res.FloatModel != res.Model {
+		t.Fatal("float model of a float training different from the model")
+	}
+
+	// The model is the quantization of the float model
+	if fmt.Sprint(resQAT.FloatModel.Quantize(lib.HashScale, lib.ModelScale)) != fmt.Sprint(resQAT.Model) {
+		t.Fatal("model different from the quantization of the float model")
+	}
+
+	if qatAccuracy <= floatAccuracy {
+		t.Fatalf("quantized accuracy %f after quantization-aware training, %f after float training", qatAccuracy, floatAccuracy)
+	}
+
+	// The parameters of the model are quantized
+	for _, w := range resQAT.Model.Weights {
+		for _, wi := range w {
+			if predictor.Quantize(wi, lib.ModelScale) != wi*lib.ModelScale {
+				t.Fatalf("weight %f is not a multiple of 1/%f", wi, lib.ModelScale)
+			}
+		}
+	}
+
+	// The encrypted accuracy is the accuracy reported by the training
+	dir, err := ioutil.TempDir("", "trainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = resQAT.Model.Save(dir + string(filepath.Separator)); err != nil {
+		t.Fatal(err)
+	}
+
+	extractor, err := lib.ConfiguredExtractorInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = (predictor.ModelInfo{Extractor: extractor}).Save(filepath.Join(dir, predictor.ModelInfoFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	params, _ := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	p := predictor.NewPredictor(params)
+	p.LoadModel(dir + string(filepath.Separator))
+
+	report := NewQuantizationReport(p, resQAT.FloatModel, resQAT.Validation)
+
+	if report.Quantized != qatAccuracy || report.Disagreements != 0 || report.Encrypted != qatAccuracy {
+		t.Fatalf("training accuracy %f, %s", qatAccuracy, report)
+	}
+
+	if _, accuracy := resQAT.FloatModel.Evaluate(resQAT.Validation, 0, 0); report.Float != accuracy {
+		t.Fatalf("float accuracy %f, %s", accuracy, report)
+	}
+}
+
+func TestTrainErrors(t *testing.T) {
+
+	d := blobs(rand.New(rand.NewSource(4)), 2, 10, 3, 1)
+
+	if _, err := Train(DefaultConfig(), d, 1); err == nil {
+		t.Fatal("label out of range accepted")
+	}
+
+	config := DefaultConfig()
+	config.Optimizer = "rmsprop"
+	if _, err := Train(config, d, 2); err == nil {
+		t.Fatal("unknown optimizer accepted")
+	}
+}
+
+func TestSaveLoadModel(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "trainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + string(filepath.Separator)
+
+	m := NewModel(4, 10, rand.New(rand.NewSource(5)))
+	m.Bias[2] = 0.5
+
+	if err = m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Layout of Predictor.LoadModel
+	buff, _ := ioutil.ReadFile(path + "weights_layer_0")
+	if w := math.Float64frombits(binary.LittleEndian.Uint64(buff[(1+7*4)<<3:])); w != m.Weights[1][7] {
+		t.Fatalf("weight (1, 7) written at the wrong index")
+	}
+
+	loaded, err := LoadModel(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for c := range m.Weights {
+		for j := range m.Weights[c] {
+			if loaded.Weights[c][j] != m.Weights[c][j] {
+				t.Fatalf("weight (%d, %d) : %f != %f", c, j, loaded.Weights[c][j], m.Weights[c][j])
+			}
+		}
+		if loaded.Bias[c] != m.Bias[c] {
+			t.Fatalf("bias %d : %f != %f", c, loaded.Bias[c], m.Bias[c])
+		}
+	}
+
+	if _, err = LoadModel(path, 3); err == nil {
+		t.Fatal("model loaded with the wrong number of classes")
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "trainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bx := make([]byte, 2*3*8)
+	for i := 0; i < 6; i++ {
+		binary.LittleEndian.PutUint64(bx[i<<3:], math.Float64bits(float64(i)))
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "X.binary"), bx, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "Y.binary"), []byte{3, 1}, 0644)
+
+	d, err := LoadDataset(filepath.Join(dir, "X.binary"), filepath.Join(dir, "Y.binary"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Len() != 2 || d.X[1][2] != 5 || d.Y[0] != 3 || d.Y[1] != 1 {
+		t.Fatalf("wrong dataset %v", d)
+	}
+
+	if _, err = LoadDataset(filepath.Join(dir, "X.binary"), filepath.Join(dir, "Y.binary"), 4); err == nil {
+		t.Fatal("dataset loaded with the wrong dimension")
+	}
+}
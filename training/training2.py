@@ -226,7 +226,7 @@ def load_samples(shuffle_samples):
     hash_size = 0
     with open('params.binary', "rb") as f:
         data = f.read()
-        hash_size = int(data[0])**2
+        hash_size = struct.unpack('<I', data[:4])[0]
     
     X = []
     Y = []
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ldsec/idash21_Task2/prediction/lib"
+	"github.com/ldsec/idash21_Task2/prediction/predictor"
+	"github.com/ldsec/idash21_Task2/prediction/preprocessing"
+	"github.com/ldsec/idash21_Task2/training/trainer"
+	"github.com/ldsec/lattigo/v2/ckks"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trial is a combination of pre-processing parameters and of regularization weights.
+type Trial struct {
+	Extractor    string  `json:"extractor"`
+	Window       int     `json:"window"`
+	HashSqrtSize int     `json:"hash_sqrt_size"`
+	Normalizer   float64 `json:"normalizer"`
+	L1           float64 `json:"l1"`
+	L2           float64 `json:"l2"`
+}
+
+// Entry is the cross-validated performance of a trial.
+type Entry struct {
+	Trial
+	HashSize      int     `json:"hash_size"`
+	Accuracy      float64 `json:"accuracy"`     // Mean accuracy of the encrypted predictions of the held-out folds
+	AccuracyStd   float64 `json:"accuracy_std"` // Standard deviation of the accuracies of the folds
+	FloatAccuracy float64 `json:"float_accuracy"`
+	Disagreements int     `json:"disagreements"` // Number of held-out samples whose quantized and encrypted predictions differ
+	Loss          float64 `json:"loss"`
+	Epochs        float64 `json:"epochs"`
+	Seconds       float64 `json:"seconds"`
+}
+
+// Tunes the pre-processing parameters (feature extractor, window, hash size and normalizer of lib/params.go) and the regularization
+// of the training by k-fold cross-validation of the quantization-aware training, over a grid or a random
+// search, and writes the leaderboard, the best parameters and the model trained with them on all the samples.
+//
+// $ go run tune/main.go -windows 5,6,7 -sizes 8,12,16 -normalizers 0.1,0.2,0.33 -l2 1e-6,1e-4
+func main() {
+
+	fasta := flag.String("fasta", "./Challenge.fa", "FASTA file of the labeled genomes")
+	nbSamples := flag.Int("samples", 8000, "number of genomes read from the FASTA file")
+	k := flag.Int("folds", 5, "number of folds of the cross-validation")
+	search := flag.String("search", "grid", "grid (all the combinations) or random (-trials combinations drawn from the grid)")
+	nbTrials := flag.Int("trials", 10, "number of combinations of the random search")
+	extractors := flag.String("extractors", lib.FeatureExtractor, "comma separated feature extractors (see lib.FeatureExtractor)")
+	windows := flag.String("windows", strconv.Itoa(lib.Window), "comma separated windows")
+	sizes := flag.String("sizes", strconv.Itoa(lib.HashSqrtSize), "comma separated hash sqrt sizes (hashes of size^2 coefficients)")
+	normalizers := flag.String("normalizers", strconv.FormatFloat(lib.Normalizer, 'g', -1, 64), "comma separated normalizers")
+	l1 := flag.String("l1", "1e-6", "comma separated L1 regularization weights")
+	l2 := flag.String("l2", "1e-6", "comma separated L2 regularization weights")
+	epochs := flag.Int("epochs", trainer.DefaultConfig().Epochs, "maximum number of epochs of each training")
+	seed := flag.Int64("seed", 0, "seed of the random search, of the folds and of the trainings")
+	out := flag.String("out", "./tuning", "output folder")
+	flag.Parse()
+
+	if lib.CoefficientMask == preprocessing.MaskFile || lib.Normalization == preprocessing.NormalizationTFIDF {
+		log.Fatalf("tune does not learn the coefficient mask nor the background of the tfidf normalization, which depend on the window")
+	}
+
+	var grid []Trial
+	for _, x := range strings.Split(*extractors, ",") {
+		for _, w := range parseInts(*windows) {
+			for _, s := range parseInts(*sizes) {
+				for _, n := range parseFloats(*normalizers) {
+					for _, a := range parseFloats(*l1) {
+						for _, b := range parseFloats(*l2) {
+							grid = append(grid, Trial{Extractor: strings.TrimSpace(x), Window: w, HashSqrtSize: s, Normalizer: n, L1: a, L2: b})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	trials := grid
+	switch *search {
+	case "grid":
+	case "random":
+		prng := rand.New(rand.NewSource(*seed))
+		prng.Shuffle(len(grid), func(i, j int) { grid[i], grid[j] = grid[j], grid[i] })
+		if *nbTrials < len(grid) {
+			trials = grid[:*nbTrials]
+		}
+	default:
+		log.Fatalf("unknown search %s", *search)
+	}
+
+	// Trials of the same pre-processing parameters share the hashes
+	sort.SliceStable(trials, func(i, j int) bool { return preprocessingKey(trials[i]) < preprocessingKey(trials[j]) })
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		panic(err)
+	}
+
+	params, err := ckks.NewParametersFromModuli(lib.LogN, &ckks.Moduli{Qi: lib.Q, Pi: []uint64{}})
+	if err != nil {
+		panic(err)
+	}
+	p := predictor.NewPredictor(params)
+
+	ctx := context.Background()
+
+	fmt.Printf("Tuning : %d trials, %d-fold cross-validation on %d samples\n", len(trials), *k, *nbSamples)
+
+	var entries []Entry
+	var dataset *trainer.Dataset
+	var hashErr error
+	var key string
+
+	for i, trial := range trials {
+
+		if preprocessingKey(trial) != key {
+			key = preprocessingKey(trial)
+			dataset, hashErr = hashSamples(ctx, *fasta, *nbSamples, trial)
+		}
+
+		if hashErr != nil {
+			fmt.Printf("Trial %3d/%d : %+v skipped : %s\n", i+1, len(trials), trial, hashErr)
+			continue
+		}
+
+		config := trainingConfig(trial, *epochs, *seed)
+
+		start := time.Now()
+
+		cv, err := trainer.CrossValidate(config, dataset, lib.NbStrains, *k, p)
+		if err != nil {
+			panic(err)
+		}
+
+		e := Entry{Trial: trial, HashSize: dataset.NbFeatures(), Seconds: time.Since(start).Seconds()}
+		e.Accuracy, e.AccuracyStd = trainer.MeanStd(cv.EncryptedAccuracies)
+		e.FloatAccuracy, _ = trainer.MeanStd(cv.FloatAccuracies)
+		e.Disagreements = cv.Disagreements
+		e.Loss, _ = trainer.MeanStd(cv.Losses)
+		for _, epoch := range cv.Epochs {
+			e.Epochs += float64(epoch) / float64(len(cv.Epochs))
+		}
+
+		fmt.Printf("Trial %3d/%d : %+v accuracy %.4f +/- %.4f (float %.4f, %d disagreements, %.1fs)\n", i+1, len(trials), trial, e.Accuracy, e.AccuracyStd, e.FloatAccuracy, e.Disagreements, e.Seconds)
+
+		entries = append(entries, e)
+	}
+
+	if len(entries) == 0 {
+		log.Fatalf("no valid trial")
+	}
+
+	// Ranks by accuracy, then by stability
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Accuracy != entries[j].Accuracy {
+			return entries[i].Accuracy > entries[j].Accuracy
+		}
+		return entries[i].AccuracyStd < entries[j].AccuracyStd
+	})
+
+	if err = writeLeaderboard(filepath.Join(*out, "leaderboard.csv"), entries); err != nil {
+		panic(err)
+	}
+
+	best := entries[0]
+
+	buff, err := json.MarshalIndent(best, "", "\t")
+	if err != nil {
+		panic(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(*out, "best.json"), append(buff, '\n'), 0644); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Best : %+v accuracy %.4f +/- %.4f\n", best.Trial, best.Accuracy, best.AccuracyStd)
+
+	trainBest(ctx, *fasta, *nbSamples, best.Trial, trainingConfig(best.Trial, *epochs, *seed), p, *out+string(filepath.Separator))
+
+	fmt.Printf("Set FeatureExtractor = %q, Window = %d, HashSqrtSize = %d and Normalizer = %g in lib/params.go and copy the model of %s in prediction/model/\n",
+		best.Extractor, best.Window, best.HashSqrtSize, best.Normalizer, *out)
+}
+
+// trainBest trains the model of the best trial on all the samples and writes it, with its description, in the output folder.
+func trainBest(ctx context.Context, fasta string, nbSamples int, trial Trial, config trainer.Config, p *predictor.Predictor, out string) {
+
+	// The feature extractor of the model is the one of lib
+	lib.FeatureExtractor = trial.Extractor
+	lib.Window, lib.HashSqrtSize, lib.HashSize, lib.Normalizer = trial.Window, trial.HashSqrtSize, trial.HashSqrtSize*trial.HashSqrtSize, trial.Normalizer
+
+	dataset, err := hashSamples(ctx, fasta, nbSamples, trial)
+	if err != nil {
+		panic(err)
+	}
+
+	res, err := trainer.Train(config, dataset, lib.NbStrains)
+	if err != nil {
+		panic(err)
+	}
+
+	if err = res.Model.Save(out); err != nil {
+		panic(err)
+	}
+
+	extractor, err := lib.ConfiguredExtractorInfo()
+	if err != nil {
+		panic(err)
+	}
+	info := predictor.ModelInfo{Extractor: extractor}
+	if err = info.Save(out + predictor.ModelInfoFile); err != nil {
+		panic(err)
+	}
+
+	p.LoadModel(out)
+	report := trainer.NewQuantizationReport(p, res.FloatModel, res.Validation)
+	fmt.Println(report)
+
+	trainingInfo := res.Info(config)
+	trainingInfo.Quantization = &report
+
+	if info.Training, err = json.Marshal(trainingInfo); err != nil {
+		panic(err)
+	}
+
+	if err = info.Save(out + predictor.ModelInfoFile); err != nil {
+		panic(err)
+	}
+}
+
+// trainingConfig returns the hyper-parameters of the training of the trial.
+func trainingConfig(trial Trial, epochs int, seed int64) (config trainer.Config) {
+	config = trainer.DefaultConfig()
+	config.L1, config.L2 = trial.L1, trial.L2
+	config.Epochs = epochs
+	config.Seed = seed
+	config.CalibrationSplit = 0 // The tuned models are not calibrated
+	if lib.QuantizationAwareTraining {
+		config.HashScale, config.ModelScale = lib.HashScale, lib.ModelScale
+	}
+	return
+}
+
+// hashSamples hashes the genomes of the FASTA file with the feature extractor and the pre-processing parameters of the trial,
+// the other parameters being those of lib.
+func hashSamples(ctx context.Context, path string, nbSamples int, trial Trial) (dataset *trainer.Dataset, err error) {
+
+	params := lib.ConfiguredParameters()
+	params.Window = trial.Window
+	params.HashSqrtSize = trial.HashSqrtSize
+	params.HashSize = trial.HashSqrtSize * trial.HashSqrtSize
+	params.Normalizer = trial.Normalizer
+
+	var hasher preprocessing.FeatureExtractor
+	if hasher, err = preprocessing.NewFeatureExtractorByName(trial.Extractor, lib.NbHashingWorkers, params); err != nil {
+		return
+	}
+
+	var labeler *lib.Labeler
+	if labeler, err = lib.ConfiguredLabeler(); err != nil {
+		return
+	}
+
+	// Stops the reading and the hashing of the genomes on an early return
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dataset = &trainer.Dataset{}
+	for res := range preprocessing.NewWorkerPool(hasher).HashAll(ctx, preprocessing.ReadRecords(ctx, path, nbSamples)) {
+
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		var label int
+		if label, err = labeler.Label(res.ID); err != nil {
+			return nil, err
+		}
+
+		dataset.X = append(dataset.X, res.Hash)
+		dataset.Y = append(dataset.Y, label)
+	}
+
+	return
+}
+
+func preprocessingKey(t Trial) string {
+	return fmt.Sprintf("%s %03d %05d %v", t.Extractor, t.Window, t.HashSqrtSize, t.Normalizer)
+}
+
+// writeLeaderboard writes the ranked entries in the CSV file at the given path.
+func writeLeaderboard(path string, entries []Entry) (err error) {
+
+	var fw *os.File
+	if fw, err = os.Create(path); err != nil {
+		return
+	}
+	defer fw.Close()
+
+	w := csv.NewWriter(fw)
+	w.Write([]string{"rank", "extractor", "window", "hash_sqrt_size", "hash_size", "normalizer", "l1", "l2", "accuracy", "accuracy_std", "float_accuracy", "disagreements", "loss", "epochs", "seconds"})
+
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) }
+
+	for i, e := range entries {
+		w.Write([]string{
+			strconv.Itoa(i + 1),
+			e.Extractor,
+			strconv.Itoa(e.Window),
+			strconv.Itoa(e.HashSqrtSize),
+			strconv.Itoa(e.HashSize),
+			f(e.Normalizer),
+			f(e.L1),
+			f(e.L2),
+			f(e.Accuracy),
+			f(e.AccuracyStd),
+			f(e.FloatAccuracy),
+			strconv.Itoa(e.Disagreements),
+			f(e.Loss),
+			f(e.Epochs),
+			f(e.Seconds),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+func parseInts(list string) (values []int) {
+	for _, s := range strings.Split(list, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			log.Fatalf("invalid integer %s", s)
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+func parseFloats(list string) (values []float64) {
+	for _, s := range strings.Split(list, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			log.Fatalf("invalid number %s", s)
+		}
+		values = append(values, v)
+	}
+	return
+}